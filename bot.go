@@ -0,0 +1,207 @@
+package botgo
+
+import (
+	"context"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/log"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/sessions/local"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket"
+	"github.com/tencent-connect/botgo/websocket/client"
+)
+
+// Bot 一个机器人实例，持有自己的 token，openapi，session manager，事件 handler，logger 与 websocket 实现
+// Bot 的事件 handler 不会回退到全局的 dto.DefaultHandlers，同一个进程内可以运行多个 Bot
+//
+//	bot, err := botgo.NewBot(token,
+//		botgo.WithHandlers(dto.NewEventParse().AtMessage(atMessageHandler)),
+//		botgo.WithLogger(logger),
+//	)
+//	go bot.Start(ctx)
+//	bot.OpenAPI().PostMessage(ctx, channelID, message)
+type Bot struct {
+	token          *token.Token
+	sandbox        bool
+	apiVersion     openapi.APIVersion
+	apiOptions     []openapi.Option
+	api            openapi.OpenAPI
+	sessionManager SessionManager
+	handlers       *dto.EventParse
+	logger         log.Logger
+	ws             websocket.WebSocket
+	sessionStore   manager.SessionStore
+	onFatal        manager.FatalHandler
+}
+
+// BotOption 创建 Bot 时的配置项
+type BotOption func(b *Bot)
+
+// WithSandbox 使用沙箱环境
+func WithSandbox() BotOption {
+	return func(b *Bot) {
+		b.sandbox = true
+	}
+}
+
+// WithAPIVersion 指定使用的 openapi 版本，不指定时使用 v1
+func WithAPIVersion(version openapi.APIVersion) BotOption {
+	return func(b *Bot) {
+		b.apiVersion = version
+	}
+}
+
+// WithOpenAPIOptions 创建 openapi 实例时使用的配置项，如 openapi.WithEndpoint
+func WithOpenAPIOptions(opts ...openapi.Option) BotOption {
+	return func(b *Bot) {
+		b.apiOptions = append(b.apiOptions, opts...)
+	}
+}
+
+// WithOpenAPI 使用已经创建好的 openapi 实例，设置后忽略 WithSandbox，WithAPIVersion 与 WithOpenAPIOptions
+func WithOpenAPI(api openapi.OpenAPI) BotOption {
+	return func(b *Bot) {
+		b.api = api
+	}
+}
+
+// WithSessionManager 指定 session manager，不指定时使用 Bot 独享的本地 session manager
+// 自定义的 session manager 需要自行使用 Bot 的 websocket 实现与 logger
+func WithSessionManager(m SessionManager) BotOption {
+	return func(b *Bot) {
+		b.sessionManager = m
+	}
+}
+
+// WithHandlers 指定事件 handler，Bot 使用 handlers 的副本并与全局的 DefaultHandlers 隔离，不修改 handlers 本身
+// 之后在 handlers 上注册的 handler 不会生效，请使用 Bot.Handlers 注册
+func WithHandlers(handlers *dto.EventParse) BotOption {
+	return func(b *Bot) {
+		b.handlers = handlers
+	}
+}
+
+// WithLogger 指定 Bot 使用的 logger，不指定时使用创建 Bot 时的 log.DefaultLogger
+func WithLogger(logger log.Logger) BotOption {
+	return func(b *Bot) {
+		b.logger = logger
+	}
+}
+
+// WithSessionStore 指定保存 session 的 store，Shutdown 时保存 session，下次启动时 resume，使用自定义的 session manager 时不生效
+func WithSessionStore(store manager.SessionStore) BotOption {
+	return func(b *Bot) {
+		b.sessionStore = store
+	}
+}
+
+// WithFatalHandler 指定遇到不能 identify 的错误时的处理方式，不指定时 Start 返回 manager.FatalError，使用自定义的 session manager 时不生效
+func WithFatalHandler(handler manager.FatalHandler) BotOption {
+	return func(b *Bot) {
+		b.onFatal = handler
+	}
+}
+
+// WithWebsocket 指定 websocket 实现，不指定时使用 Bot 独享的默认 client
+func WithWebsocket(ws websocket.WebSocket) BotOption {
+	return func(b *Bot) {
+		b.ws = ws
+	}
+}
+
+// NewBot 创建一个机器人实例
+func NewBot(token *token.Token, opts ...BotOption) (*Bot, error) {
+	b := &Bot{
+		token:      token,
+		apiVersion: openapi.APIv1,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.logger == nil {
+		b.logger = log.DefaultLogger
+	}
+	// 调用方的 handlers 可能同时用于全局的连接或者其他 Bot，隔离副本
+	if b.handlers == nil {
+		b.handlers = dto.NewEventParse()
+	} else {
+		b.handlers = b.handlers.Clone()
+	}
+	b.handlers.Isolate()
+	if b.ws == nil {
+		b.ws = client.New(client.WithLogger(b.logger))
+	}
+	if b.sessionManager == nil {
+		b.sessionManager = local.New(
+			local.WithWebsocket(b.ws), local.WithLogger(b.logger), local.WithSessionStore(b.sessionStore),
+			local.WithFatalHandler(b.onFatal),
+		)
+	}
+	if b.api == nil {
+		impl, ok := openapi.VersionMapping[b.apiVersion]
+		if !ok {
+			b.logger.Errorf("version %v openapi not found or setup", b.apiVersion)
+			return nil, errs.ErrNotFoundOpenAPI
+		}
+		apiOptions := append([]openapi.Option{openapi.WithLogger(b.logger)}, b.apiOptions...)
+		b.api = openapi.Setup(impl, token, b.sandbox, apiOptions...)
+	}
+	return b, nil
+}
+
+// Token 返回 Bot 的 token
+func (b *Bot) Token() *token.Token {
+	return b.token
+}
+
+// OpenAPI 返回 Bot 的 openapi 实例
+func (b *Bot) OpenAPI() openapi.OpenAPI {
+	return b.api
+}
+
+// Handlers 返回 Bot 的事件 handler，可以在 Start 之前继续注册
+func (b *Bot) Handlers() *dto.EventParse {
+	return b.handlers
+}
+
+// Logger 返回 Bot 使用的 logger
+func (b *Bot) Logger() log.Logger {
+	return b.logger
+}
+
+// Start 获取 websocket 接入点并启动连接，会阻塞到 ctx 结束或者 session manager 退出
+// 机器人被下架或者封禁等不能再连接的情况，返回 manager.FatalError，不会影响进程中的其他服务
+func (b *Bot) Start(ctx context.Context) error {
+	apInfo, err := b.api.WS(ctx, nil, "")
+	if err != nil {
+		b.logger.Errorf("get websocket access point failed, err: %v", err)
+		return err
+	}
+	return b.sessionManager.Start(ctx, apInfo, b.token, b.handlers)
+}
+
+// Stop 停止 Bot 的连接
+func (b *Bot) Stop() {
+	b.sessionManager.Stop()
+}
+
+// Reshard 调整 Bot 的 shard 数量，新旧两组 shard 同时在线期间过滤重复的事件，新的 shard 全部连接后关闭旧的 shard
+// session manager 不支持时返回 manager.ErrReshardNotSupported
+func (b *Bot) Reshard(ctx context.Context, shards uint32) error {
+	if m, ok := b.sessionManager.(ReshardableSessionManager); ok {
+		return m.Reshard(ctx, shards)
+	}
+	return manager.ErrReshardNotSupported
+}
+
+// Shutdown 优雅关闭 Bot 的连接，session manager 不支持优雅关闭时等同于 Stop
+func (b *Bot) Shutdown(ctx context.Context) error {
+	if m, ok := b.sessionManager.(GracefulSessionManager); ok {
+		return m.Shutdown(ctx)
+	}
+	b.sessionManager.Stop()
+	return nil
+}
@@ -0,0 +1,138 @@
+package botgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/openapi/openapitest"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+const botTestTimeout = 10 * time.Second
+
+type testBot struct {
+	bot      *Bot
+	api      *openapitest.Server
+	gateway  *websockettest.Server
+	ready    chan string
+	messages chan string
+}
+
+func newTestBot(t *testing.T, appID uint64, name string) *testBot {
+	tb := &testBot{
+		api:      openapitest.NewServer(),
+		gateway:  websockettest.NewServer(),
+		ready:    make(chan string, 10),
+		messages: make(chan string, 10),
+	}
+	tb.api.SetMe(&dto.User{ID: name, Username: name, Bot: true})
+	tb.api.SetGateway(&dto.WebsocketAP{
+		URL:               tb.gateway.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 1},
+	})
+	endpoint, err := openapi.ParseEndpoint(tb.api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := dto.NewEventParse().
+		Ready(func(event *dto.WSPayload, data *dto.WSReadyData) {
+			tb.ready <- name
+		}).
+		AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+			tb.messages <- name + ":" + data.Content
+			return nil
+		})
+	tb.bot, err = NewBot(token.BotToken(appID, name),
+		WithHandlers(handlers),
+		WithOpenAPIOptions(openapi.WithEndpoint(endpoint)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func (tb *testBot) close() {
+	tb.api.Close()
+	tb.gateway.Close()
+}
+
+func expect(t *testing.T, ch chan string, want string) {
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	case <-time.After(botTestTimeout):
+		t.Fatalf("timeout waiting for %v", want)
+	}
+}
+
+func TestBotsAreIsolated(t *testing.T) {
+	// 全局的 handler 不应该被 Bot 使用
+	globalReady := make(chan struct{}, 10)
+	defer func(ready dto.ReadyHandler) { dto.DefaultHandlers.Ready = ready }(dto.DefaultHandlers.Ready)
+	dto.DefaultHandlers.Ready = func(event *dto.WSPayload, data *dto.WSReadyData) {
+		globalReady <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*botTestTimeout)
+	defer cancel()
+	bots := []*testBot{newTestBot(t, 1, "alice"), newTestBot(t, 2, "bob")}
+	for _, tb := range bots {
+		defer tb.close()
+		go func(b *Bot) {
+			_ = b.Start(ctx)
+		}(tb.bot)
+	}
+
+	for _, tb := range bots {
+		name := tb.bot.Token().AccessToken
+		me, err := tb.bot.OpenAPI().Me(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if me.ID != name {
+			t.Errorf("Me() = %v, want %v", me.ID, name)
+		}
+		conn, err := tb.gateway.NextConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Identify() == nil || conn.Identify().Token != tb.bot.Token().GetString() {
+			t.Fatalf("%s identify with wrong token", name)
+		}
+		expect(t, tb.ready, name)
+		if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, tb.messages, name+":hi")
+	}
+	for _, tb := range bots {
+		if len(tb.ready) != 0 || len(tb.messages) != 0 {
+			t.Errorf("%s received events of other bots", tb.bot.Token().AccessToken)
+		}
+	}
+	if len(globalReady) != 0 {
+		t.Error("global ready handler should not be called")
+	}
+}
+
+func TestNewBotKeepsHandlers(t *testing.T) {
+	handlers := dto.NewEventParse()
+	b, err := NewBot(token.BotToken(1, "token"), WithHandlers(handlers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handlers.Isolated() {
+		t.Error("NewBot should not isolate the handlers passed by the caller")
+	}
+	if b.Handlers() == handlers || !b.Handlers().Isolated() {
+		t.Error("Bot should use an isolated copy of the handlers")
+	}
+}
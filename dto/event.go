@@ -6,13 +6,33 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// EventParseFunc 解析并处理事件的方法
 type EventParseFunc func(event *WSPayload, message []byte) error
 
+// EventFilter 在事件交给 handler 之前调用，返回 false 时丢弃事件，如过滤重复的事件
+type EventFilter func(event *WSPayload) bool
+
+// EventParse 连接级别的事件 handler 集合，每个 session 可以使用独立的 handler 与 intent，不依赖全局的 DefaultHandlers
+//
+//	handlers := dto.NewEventParse().
+//		Ready(readyHandler).
+//		AtMessage(atMessageHandler).
+//		GuildMember(memberHandler)
+//	intent := handlers.Intent()
+//
+// 没有在 EventParse 中注册的事件，会回退到全局的 DefaultHandlers，调用 Isolate 之后不再回退
 type EventParse struct {
-	funcMap map[OPCode]map[EventType]EventParseFunc
-	intent  Intent
+	funcMap  map[OPCode]map[EventType]EventParseFunc
+	intent   Intent
+	isolated bool // 不回退到全局的 DefaultHandlers
+
+	ready       ReadyHandler
+	errorNotify ErrorNotifyHandler
+	plain       PlainEventHandler
+	filters     []EventFilter
 }
 
+// NewEventParse 创建一个空的事件 handler 集合
 func NewEventParse() *EventParse {
 	return &EventParse{
 		funcMap: map[OPCode]map[EventType]EventParseFunc{
@@ -21,24 +41,242 @@ func NewEventParse() *EventParse {
 	}
 }
 
+// FuncMap 返回已经注册的事件处理方法
 func (e *EventParse) FuncMap() map[OPCode]map[EventType]EventParseFunc {
+	if e == nil {
+		return nil
+	}
 	return e.funcMap
 }
 
+// Intent 返回已经注册的事件对应的 intent
+func (e *EventParse) Intent() Intent {
+	if e == nil {
+		return IntentNone
+	}
+	return e.intent
+}
+
+// Isolate 不再回退到全局的 DefaultHandlers，未注册的事件与回调会被忽略，用于同一进程内运行多个机器人
+func (e *EventParse) Isolate() *EventParse {
+	e.isolated = true
+	return e
+}
+
+// Isolated 是否已经与全局的 DefaultHandlers 隔离
+func (e *EventParse) Isolated() bool {
+	return e != nil && e.isolated
+}
+
+// Clone 复制一份 handler 集合，用于在不修改原集合的情况下替换回调，如 session manager 需要监听 ready 事件
+// e 为空时 intent 为 IntentGuilds，与连接使用空的 handler 集合时的默认值一致
+func (e *EventParse) Clone() *EventParse {
+	c := NewEventParse()
+	if e == nil {
+		c.intent = IntentGuilds
+		return c
+	}
+	for op, handlers := range e.funcMap {
+		c.funcMap[op] = map[EventType]EventParseFunc{}
+		for event, handler := range handlers {
+			c.funcMap[op][event] = handler
+		}
+	}
+	c.intent = e.intent
+	c.isolated = e.isolated
+	c.ready = e.ready
+	c.errorNotify = e.errorNotify
+	c.plain = e.plain
+	c.filters = append([]EventFilter(nil), e.filters...)
+	return c
+}
+
+// register 为事件注册处理方法，并合并事件对应的 intent
+func (e *EventParse) register(handler EventParseFunc, events ...EventType) *EventParse {
+	for _, event := range events {
+		e.funcMap[WSDispatchEvent][event] = handler
+	}
+	e.intent = e.intent | EventToIntent(events...)
+	return e
+}
+
+// Guild 注册频道事件 handler
+func (e *EventParse) Guild(handler GuildEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSGuildData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventGuildCreate, EventGuildUpdate, EventGuildDelete)
+}
+
+// GuildMember 注册频道成员事件 handler
+func (e *EventParse) GuildMember(handler GuildMemberEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSGuildMemberData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventGuildMemberAdd, EventGuildMemberUpdate, EventGuildMemberRemove)
+}
+
+// Channel 注册子频道事件 handler
+func (e *EventParse) Channel(handler ChannelEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSChannelData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventChannelCreate, EventChannelUpdate, EventChannelDelete)
+}
+
+// Message 注册消息事件 handler，只有私域机器人能够收到
+func (e *EventParse) Message(handler MessageEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSMessageData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventMessageCreate)
+}
+
+// MessageReaction 注册表情表态事件 handler
+func (e *EventParse) MessageReaction(handler MessageReactionEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSMessageReactionData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventMessageReactionAdd, EventMessageReactionRemove)
+}
+
+// AtMessage 注册 at 机器人消息事件 handler
 func (e *EventParse) AtMessage(handler ATMessageEventHandler) *EventParse {
-	e.funcMap[WSDispatchEvent][EventAtMessageCreate] = func(event *WSPayload, message []byte) error {
+	return e.register(func(event *WSPayload, message []byte) error {
 		data := &WSATMessageData{}
 		if err := parseData(message, data); err != nil {
 			return err
 		}
 		return handler(event, data)
-	}
-	e.intent = e.intent | EventToIntent(EventAtMessageCreate)
+	}, EventAtMessageCreate)
+}
+
+// DirectMessage 注册私信消息事件 handler
+func (e *EventParse) DirectMessage(handler DirectMessageEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSDirectMessageData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventDirectMessageCreate)
+}
+
+// Audio 注册音频机器人事件 handler
+func (e *EventParse) Audio(handler AudioEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSAudioData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventAudioStart, EventAudioFinish, EventAudioOnMic, EventAudioOffMic)
+}
+
+// MessageAudit 注册消息审核事件 handler
+func (e *EventParse) MessageAudit(handler MessageAuditEventHandler) *EventParse {
+	return e.register(func(event *WSPayload, message []byte) error {
+		data := &WSMessageAuditData{}
+		if err := parseData(message, data); err != nil {
+			return err
+		}
+		return handler(event, data)
+	}, EventMessageAuditPass, EventMessageAuditReject)
+}
+
+// Ready 注册 ready 事件 handler，ready 事件不需要 intent
+func (e *EventParse) Ready(handler ReadyHandler) *EventParse {
+	e.ready = handler
 	return e
 }
 
-func (e *EventParse) Intent() Intent {
-	return e.intent
+// ErrorNotify 注册连接错误通知 handler
+func (e *EventParse) ErrorNotify(handler ErrorNotifyHandler) *EventParse {
+	e.errorNotify = handler
+	return e
+}
+
+// Plain 注册透传 handler，没有注册具体类型 handler 的事件会投递到这里
+func (e *EventParse) Plain(handler PlainEventHandler) *EventParse {
+	e.plain = handler
+	return e
+}
+
+// Filter 添加事件过滤器，按照添加的顺序调用，对具体类型的 handler 与透传 handler 都生效
+func (e *EventParse) Filter(filter EventFilter) *EventParse {
+	e.filters = append(e.filters, filter)
+	return e
+}
+
+// Accept 事件是否通过所有的过滤器
+func (e *EventParse) Accept(event *WSPayload) bool {
+	if e == nil {
+		return true
+	}
+	for _, filter := range e.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleReady 回调 ready handler，未注册时使用全局的 DefaultHandlers.Ready，隔离后不回退
+func (e *EventParse) HandleReady(event *WSPayload, data *WSReadyData) {
+	var handler ReadyHandler
+	if !e.Isolated() {
+		handler = DefaultHandlers.Ready
+	}
+	if e != nil && e.ready != nil {
+		handler = e.ready
+	}
+	if handler != nil {
+		handler(event, data)
+	}
+}
+
+// NotifyError 回调错误通知 handler，未注册时使用全局的 DefaultHandlers.ErrorNotify，隔离后不回退
+func (e *EventParse) NotifyError(err error) {
+	var handler ErrorNotifyHandler
+	if !e.Isolated() {
+		handler = DefaultHandlers.ErrorNotify
+	}
+	if e != nil && e.errorNotify != nil {
+		handler = e.errorNotify
+	}
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// HandlePlain 回调透传 handler，未注册时使用全局的 DefaultHandlers.Plain，隔离后不回退
+func (e *EventParse) HandlePlain(event *WSPayload, message []byte) error {
+	var handler PlainEventHandler
+	if !e.Isolated() {
+		handler = DefaultHandlers.Plain
+	}
+	if e != nil && e.plain != nil {
+		handler = e.plain
+	}
+	if handler != nil {
+		return handler(event, message)
+	}
+	return nil
 }
 
 func parseData(message []byte, target interface{}) error {
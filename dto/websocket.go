@@ -35,6 +35,8 @@ type Session struct {
 	LastSeq  uint32
 	Shards   ShardConfig
 	Handlers *EventParse
+	// FencingToken 分布式 session manager 中 shard 锁的 fencing token，每次获取锁递增，单机时为 0
+	FencingToken uint64 `json:"-"`
 }
 
 // String 输出session字符串
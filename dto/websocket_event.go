@@ -1,5 +1,7 @@
 package dto
 
+import "github.com/tidwall/gjson"
+
 func init() {
 	eventIntentMap = transposeIntentEventMap(intentEventMap)
 }
@@ -64,3 +66,21 @@ func EventToIntent(events ...EventType) Intent {
 	}
 	return i
 }
+
+// eventIDPath 事件中唯一标识一次事件的字段，其他事件的字段会在多次事件中重复，如频道 ID
+var eventIDPath = map[EventType]string{
+	EventMessageCreate:       "d.id",
+	EventAtMessageCreate:     "d.id",
+	EventDirectMessageCreate: "d.id",
+	EventMessageAuditPass:    "d.audit_id",
+	EventMessageAuditReject:  "d.audit_id",
+}
+
+// EventID 返回事件的自然 ID，如消息事件的消息 ID 与审核事件的审核 ID，没有唯一 ID 的事件返回空字符串
+func EventID(event *WSPayload) string {
+	path, ok := eventIDPath[event.Type]
+	if !ok {
+		return ""
+	}
+	return gjson.GetBytes(event.RawMessage, path).String()
+}
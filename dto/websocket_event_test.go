@@ -14,3 +14,23 @@ func Test_transposeIntentEventMap(t *testing.T) {
 		assert.Equal(t, re[EventChannelCreate], IntentGuilds)
 	})
 }
+
+func TestEventID(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *WSPayload
+		want  string
+	}{
+		{"message", &WSPayload{WSPayloadBase: WSPayloadBase{Type: EventAtMessageCreate},
+			RawMessage: []byte(`{"op":0,"t":"AT_MESSAGE_CREATE","d":{"id":"m1","channel_id":"c1"}}`)}, "m1"},
+		{"audit", &WSPayload{WSPayloadBase: WSPayloadBase{Type: EventMessageAuditPass},
+			RawMessage: []byte(`{"op":0,"t":"MESSAGE_AUDIT_PASS","d":{"audit_id":"a1","message_id":"m1"}}`)}, "a1"},
+		{"guild", &WSPayload{WSPayloadBase: WSPayloadBase{Type: EventGuildUpdate},
+			RawMessage: []byte(`{"op":0,"t":"GUILD_UPDATE","d":{"id":"g1"}}`)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EventID(tt.event))
+		})
+	}
+}
@@ -8,6 +8,8 @@ type WSPayload struct {
 	WSPayloadBase
 	Data       interface{} `json:"d,omitempty"`
 	RawMessage []byte      `json:"-"` // 原始的 message 数据
+	// FencingToken 收到事件的连接的 Session.FencingToken，写入外部存储时可以用于拒绝锁已经过期的实例的写入
+	FencingToken uint64 `json:"-"`
 }
 
 // WSPayloadBase 基础消息结构，排除了 data
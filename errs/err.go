@@ -8,6 +8,8 @@ import (
 var (
 	// ErrNeedReConnect reconnect
 	ErrNeedReConnect = New(CodeNeedReConnect, "need reconnect")
+	// ErrHeartbeatTimeout 连续多次没有收到心跳 ack，需要重连，允许 resume
+	ErrHeartbeatTimeout = New(CodeNeedReConnect, "heartbeat ack timeout")
 	// ErrInvalidSession 无效的 session
 	ErrInvalidSession = New(CodeConnCloseCantResume, "invalid session")
 	// ErrURLInvalid ws ap url 异常
@@ -19,6 +21,14 @@ var (
 	ErrNotFoundOpenAPI = New(CodeNotFoundOpenAPI, "not found openapi version")
 	// ErrPagerIsNil 分页器为空
 	ErrPagerIsNil = New(CodePagerIsNil, "pager is nil")
+	// ErrFileIsNil 上传的文件为空
+	ErrFileIsNil = New(CodeFileIsNil, "file is nil")
+	// ErrRateLimited 请求在 ctx 超时前无法获得限频令牌
+	ErrRateLimited = New(CodeRateLimited, "rate limited before context deadline")
+	// ErrNotFoundProfile 未找到对应名称的 openapi 环境
+	ErrNotFoundProfile = New(CodeNotFoundProfile, "not found openapi profile")
+	// ErrBuiltinProfile 内置的 openapi 环境不能被覆盖
+	ErrBuiltinProfile = New(CodeBuiltinProfile, "builtin openapi profile can not be overridden")
 )
 
 // sdk 错误码
@@ -35,6 +45,26 @@ const (
 	CodeConnCloseCantIdentify
 	// CodePagerIsNil 分页器为空
 	CodePagerIsNil
+	// CodeRateLimited 客户端限频
+	CodeRateLimited
+	// CodeFilterFailed 请求过滤器返回错误
+	CodeFilterFailed
+	// CodeParseRespFailed 解析回包失败
+	CodeParseRespFailed
+	// CodeNotFoundProfile 未找到对应名称的 openapi 环境
+	CodeNotFoundProfile
+	// CodeHandlerPanic 事件 handler 发生 panic，只影响当前事件
+	CodeHandlerPanic
+	// CodeEventQueueFull 事件队列已满，事件按照溢出策略被阻塞，丢弃或者溢出
+	CodeEventQueueFull
+	// CodeConnectFailed 建立连接或者发送鉴权失败，session 会按照退避时间重连
+	CodeConnectFailed
+	// CodeLeaseLost 分布式 session manager 的 shard 锁丢失，连接被关闭，shard 由其他实例接管
+	CodeLeaseLost
+	// CodeBuiltinProfile 内置的 openapi 环境不能被覆盖
+	CodeBuiltinProfile
+	// CodeFileIsNil 上传的文件为空
+	CodeFileIsNil
 )
 
 // Err sdk err
@@ -22,7 +22,8 @@ func main() {
 		log.Fatalln(err)
 	}
 	// 初始化 openapi，使用 NewSandboxOpenAPI 请求到沙箱环境
-	api := botgo.NewSandboxOpenAPI(botToken).WithTimeout(3 * time.Second)
+	// WithFilters 添加的过滤器只对当前实例生效
+	api := botgo.NewSandboxOpenAPI(botToken).WithTimeout(3 * time.Second).(openapi.FilterSetter).WithFilters(LatencyFilter)
 	// 获取 websocket 信息，如果 api 是请求到沙箱环境的，则获取到沙箱环境的 ws 地址
 	// websocket 的链接，以及事件处理，请参考其他 examples
 	wsInfo, err := api.WS(ctx, nil, "")
@@ -42,3 +43,11 @@ func RespFilter(req *http.Request, resp *http.Response) error {
 	log.Println("trace id return by openapi", resp.Header.Get(openapi.TraceIDKey))
 	return nil
 }
+
+// LatencyFilter 统计请求耗时
+func LatencyFilter(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	log.Printf("%s %s elapsed: %v", req.Method, req.URL.Path, time.Since(start))
+	return resp, err
+}
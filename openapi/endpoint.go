@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/log"
+	"github.com/tencent-connect/botgo/token"
+	"gopkg.in/yaml.v3"
+)
+
+// Endpoint openapi 的请求地址，最终请求的地址为 scheme://host/path_prefix/uri
+type Endpoint struct {
+	Scheme     string `yaml:"scheme"`      // 为空时使用 https
+	Host       string `yaml:"host"`        // 域名，可以带端口，如 127.0.0.1:8080
+	PathPrefix string `yaml:"path_prefix"` // 路径前缀，如通过出口代理转发时使用的 /qq
+}
+
+// URL 返回不带末尾 / 的地址前缀
+func (e Endpoint) URL() string {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	prefix := strings.Trim(e.PathPrefix, "/")
+	if prefix != "" {
+		prefix = "/" + prefix
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, e.Host, prefix)
+}
+
+// ParseEndpoint 从 url 中解析请求地址，如 http://127.0.0.1:8080/qq
+func ParseEndpoint(rawURL string) (Endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Endpoint{}, err
+	}
+	if u.Host == "" {
+		return Endpoint{}, fmt.Errorf("endpoint %q has no host", rawURL)
+	}
+	return Endpoint{Scheme: u.Scheme, Host: u.Host, PathPrefix: u.Path}, nil
+}
+
+// 内置的环境
+const (
+	ProfileProduction = "production"
+	ProfileSandbox    = "sandbox"
+)
+
+// builtinProfiles 内置的环境，不能被覆盖，未指定请求地址的 openapi 实例使用
+var builtinProfiles = map[string]Endpoint{
+	ProfileProduction: {Scheme: "https", Host: "api.sgroup.qq.com"},
+	ProfileSandbox:    {Scheme: "https", Host: "sandbox.api.sgroup.qq.com"},
+}
+
+var (
+	profileLock = sync.RWMutex{}
+	profiles    = map[string]Endpoint{}
+)
+
+// RegisterProfile 注册一个命名的环境，同名的环境会被覆盖，内置的环境不能被覆盖，返回 errs.ErrBuiltinProfile
+func RegisterProfile(name string, endpoint Endpoint) error {
+	if _, ok := builtinProfiles[name]; ok {
+		return errs.ErrBuiltinProfile
+	}
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	profiles[name] = endpoint
+	return nil
+}
+
+// ProfileEndpoint 获取命名环境的请求地址
+func ProfileEndpoint(name string) (Endpoint, error) {
+	if endpoint, ok := builtinProfiles[name]; ok {
+		return endpoint, nil
+	}
+	profileLock.RLock()
+	defer profileLock.RUnlock()
+	endpoint, ok := profiles[name]
+	if !ok {
+		return Endpoint{}, errs.ErrNotFoundProfile
+	}
+	return endpoint, nil
+}
+
+// LoadEndpointFromConfig 从配置中读取环境，返回 profile 指定的环境的请求地址，不会注册配置中的 profiles
+// profile 优先从配置中的 profiles 查找，然后是内置与通过 RegisterProfile 注册的环境，配置中不能覆盖内置的环境
+//
+//	profile: proxy
+//	profiles:
+//	  proxy:
+//	    scheme: http
+//	    host: egress.example.com:8080
+//	    path_prefix: /qq
+func LoadEndpointFromConfig(file string) (Endpoint, error) {
+	var conf struct {
+		Profile  string              `yaml:"profile"`
+		Profiles map[string]Endpoint `yaml:"profiles"`
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Errorf("read endpoint from file failed, err: %v", err)
+		return Endpoint{}, err
+	}
+	if err = yaml.Unmarshal(content, &conf); err != nil {
+		log.Errorf("parse config failed, err: %v", err)
+		return Endpoint{}, err
+	}
+	for name := range conf.Profiles {
+		if _, ok := builtinProfiles[name]; ok {
+			log.Errorf("profile %s in config is builtin", name)
+			return Endpoint{}, errs.ErrBuiltinProfile
+		}
+	}
+	if conf.Profile == "" {
+		conf.Profile = ProfileProduction
+	}
+	if endpoint, ok := conf.Profiles[conf.Profile]; ok {
+		return endpoint, nil
+	}
+	return ProfileEndpoint(conf.Profile)
+}
+
+// Options 创建 openapi 实例时的可选配置
+type Options struct {
+	Endpoint *Endpoint  // 为空时根据是否沙箱环境选择内置的环境
+	Logger   log.Logger // 为空时使用全局的 log.DefaultLogger
+}
+
+// Option 创建 openapi 实例时的配置项
+type Option func(o *Options)
+
+// WithEndpoint 指定请求地址，设置后忽略沙箱环境的配置
+func WithEndpoint(endpoint Endpoint) Option {
+	return func(o *Options) {
+		o.Endpoint = &endpoint
+	}
+}
+
+// WithLogger 指定实例使用的 logger，用于同一进程内的多个实例输出到不同的 logger
+func WithLogger(logger log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// OptionSetup 支持在创建实例时指定配置项的 openapi 实现，内置的 v1 实现支持
+// 单独声明，不修改 Base.Setup，已有的 openapi 实现不需要修改
+type OptionSetup interface {
+	// SetupWithOptions 创建实例，可以通过 WithEndpoint 指定请求地址，指定后忽略 inSandbox
+	SetupWithOptions(token *token.Token, inSandbox bool, opts ...Option) OpenAPI
+}
+
+// Setup 使用 impl 创建实例，impl 实现了 OptionSetup 时使用全部的配置项
+// 否则使用 Base.Setup 创建，WithEndpoint 指定的地址通过 BaseURLSetter 设置，其他配置项被忽略
+// 指定了地址但是实例不支持设置地址时 panic，避免请求发往默认的环境
+func Setup(impl OpenAPI, token *token.Token, inSandbox bool, opts ...Option) OpenAPI {
+	if s, ok := impl.(OptionSetup); ok {
+		return s.SetupWithOptions(token, inSandbox, opts...)
+	}
+	api := impl.Setup(token, inSandbox)
+	if options := NewOptions(opts...); options.Endpoint != nil {
+		s, ok := api.(BaseURLSetter)
+		if !ok {
+			panic(fmt.Sprintf("openapi: implementation does not support endpoint %s", options.Endpoint.URL()))
+		}
+		api = s.WithBaseURL(options.Endpoint.URL())
+	}
+	return api
+}
+
+// NewOptions 合并配置项
+func NewOptions(opts ...Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func TestEndpoint_URL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		want     string
+	}{
+		{"default scheme", Endpoint{Host: "api.sgroup.qq.com"}, "https://api.sgroup.qq.com"},
+		{"prefix", Endpoint{Scheme: "http", Host: "127.0.0.1:8080", PathPrefix: "qq/"}, "http://127.0.0.1:8080/qq"},
+		{"nested prefix", Endpoint{Host: "proxy", PathPrefix: "/a/b/"}, "https://proxy/a/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.URL(); got != tt.want {
+				t.Errorf("URL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseEndpoint("/no/host"); err == nil {
+		t.Error("ParseEndpoint() without host should fail")
+	}
+}
+
+func TestLoadEndpointFromConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := "profile: egress\nprofiles:\n  egress:\n    scheme: http\n    host: egress:8080\n    path_prefix: /qq\n"
+	if err := ioutil.WriteFile(file, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	endpoint, err := LoadEndpointFromConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := endpoint.URL(); got != "http://egress:8080/qq" {
+		t.Errorf("URL() = %v, want %v", got, "http://egress:8080/qq")
+	}
+	// 配置中的环境只对返回的请求地址生效，不会修改全局的环境
+	if _, err := ProfileEndpoint("egress"); err != errs.ErrNotFoundProfile {
+		t.Errorf("ProfileEndpoint() err = %v, want %v", err, errs.ErrNotFoundProfile)
+	}
+
+	content = "profile: production\nprofiles:\n  production:\n    host: egress:8080\n"
+	if err := ioutil.WriteFile(file, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEndpointFromConfig(file); err != errs.ErrBuiltinProfile {
+		t.Errorf("LoadEndpointFromConfig() err = %v, want %v", err, errs.ErrBuiltinProfile)
+	}
+	if err := RegisterProfile(ProfileSandbox, Endpoint{Host: "egress:8080"}); err != errs.ErrBuiltinProfile {
+		t.Errorf("RegisterProfile() err = %v, want %v", err, errs.ErrBuiltinProfile)
+	}
+	if endpoint, _ := ProfileEndpoint(ProfileSandbox); endpoint.Host != "sandbox.api.sgroup.qq.com" {
+		t.Errorf("builtin sandbox profile is overridden: %+v", endpoint)
+	}
+}
+
+// bareAPI 只实现了 Base 的 openapi 实现，不支持设置请求地址
+type bareAPI struct {
+	OpenAPI
+}
+
+func (a *bareAPI) Setup(_ *token.Token, _ bool) OpenAPI {
+	return &bareAPI{}
+}
+
+// legacyAPI 只实现了 Base.Setup 与 BaseURLSetter 的 openapi 实现
+type legacyAPI struct {
+	OpenAPI
+	baseURL string
+}
+
+func (a *legacyAPI) Setup(_ *token.Token, _ bool) OpenAPI {
+	return &legacyAPI{}
+}
+
+func (a *legacyAPI) WithBaseURL(baseURL string) OpenAPI {
+	a.baseURL = baseURL
+	return a
+}
+
+func TestSetup(t *testing.T) {
+	endpoint := Endpoint{Scheme: "http", Host: "127.0.0.1:8080"}
+	api := Setup(&legacyAPI{}, token.BotToken(1, "token"), false, WithEndpoint(endpoint))
+	if got := api.(*legacyAPI).baseURL; got != endpoint.URL() {
+		t.Errorf("base url = %v, want %v", got, endpoint.URL())
+	}
+}
+
+func TestSetupWithoutBaseURLSetter(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Setup() with endpoint should panic when the implementation can not set base url")
+		}
+	}()
+	Setup(&bareAPI{}, token.BotToken(1, "token"), false, WithEndpoint(Endpoint{Host: "127.0.0.1:8080"}))
+}
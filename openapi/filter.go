@@ -6,10 +6,16 @@ import (
 )
 
 // 提供一组过滤器支持，开发者可以通过请求过滤器和返回过滤器，实现模调上报，耗时监控等能力。
+// 通过 RegisterReqFilter，RegisterRespFilter 注册的过滤器对进程内所有的 openapi 实例生效，
+// 如果需要针对不同的实例使用不同的过滤器，请使用 FilterSetter.WithFilters。
 
 // HTTPFilter 请求过滤器
 type HTTPFilter func(req *http.Request, response *http.Response) error
 
+// RoundTripFilter 包裹一次完整 http 请求的过滤器，next 为后续的过滤器以及实际发送请求的 transport
+// 过滤器可以修改请求，统计耗时，也可以不调用 next 直接返回结果，此时返回的 response 需要包含 Body
+type RoundTripFilter func(req *http.Request, next http.RoundTripper) (*http.Response, error)
+
 var (
 	filterLock         = sync.RWMutex{}
 	reqFilterChainSet  = map[string]HTTPFilter{}
@@ -20,28 +26,30 @@ var (
 
 // RegisterReqFilter 注册请求过滤器
 func RegisterReqFilter(name string, filter HTTPFilter) {
+	filterLock.Lock()
+	defer filterLock.Unlock()
 	if _, ok := reqFilterChainSet[name]; ok {
 		return
 	}
-	filterLock.Lock()
-	defer filterLock.Unlock()
 	reqFilterChainSet[name] = filter
 	reqFilterChains = append(reqFilterChains, name)
 }
 
 // RegisterRespFilter 注册返回过滤器
 func RegisterRespFilter(name string, filter HTTPFilter) {
+	filterLock.Lock()
+	defer filterLock.Unlock()
 	if _, ok := respFilterChainSet[name]; ok {
 		return
 	}
-	filterLock.Lock()
-	defer filterLock.Unlock()
 	respFilterChainSet[name] = filter
 	respFilterChains = append(respFilterChains, name)
 }
 
 // DoReqFilterChains 按照注册顺序执行请求过滤器
 func DoReqFilterChains(req *http.Request, resp *http.Response) error {
+	filterLock.RLock()
+	defer filterLock.RUnlock()
 	for _, name := range reqFilterChains {
 		if _, ok := reqFilterChainSet[name]; !ok {
 			continue
@@ -55,6 +63,8 @@ func DoReqFilterChains(req *http.Request, resp *http.Response) error {
 
 // DoRespFilterChains 按照注册顺序执行返回过滤器
 func DoRespFilterChains(req *http.Request, resp *http.Response) error {
+	filterLock.RLock()
+	defer filterLock.RUnlock()
 	for _, name := range respFilterChains {
 		if _, ok := respFilterChainSet[name]; !ok {
 			continue
@@ -65,3 +75,51 @@ func DoRespFilterChains(req *http.Request, resp *http.Response) error {
 	}
 	return nil
 }
+
+// NewHTTPFilter 将请求过滤器与返回过滤器转换为 RoundTripFilter，便于将已有的过滤器挂载到指定的 openapi 实例上
+// 任意一个过滤器为空则跳过对应的阶段
+func NewHTTPFilter(reqFilter, respFilter HTTPFilter) RoundTripFilter {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		if reqFilter != nil {
+			if err := reqFilter(req, nil); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil || respFilter == nil {
+			return resp, err
+		}
+		if err := respFilter(req, resp); err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// FilterTransport 按照顺序执行 RoundTripFilter 的 transport，第一个过滤器在最外层
+type FilterTransport struct {
+	Base    http.RoundTripper
+	Filters []RoundTripFilter
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *FilterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next(0).RoundTrip(req)
+}
+
+func (t *FilterTransport) next(i int) http.RoundTripper {
+	if i >= len(t.Filters) {
+		return t.Base
+	}
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return t.Filters[i](req, t.next(i+1))
+	})
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip 实现 http.RoundTripper
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
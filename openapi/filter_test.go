@@ -0,0 +1,58 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFilterTransport(t *testing.T) {
+	var order []string
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "base:"+req.Header.Get("X-Filter"))
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	outer := func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		order = append(order, "outer")
+		req.Header.Set("X-Filter", "outer")
+		resp, err := next.RoundTrip(req)
+		order = append(order, "outer done")
+		return resp, err
+	}
+	inner := func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		order = append(order, "inner")
+		if req.URL.Path == "/cached" {
+			return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+		return next.RoundTrip(req)
+	}
+	transport := &FilterTransport{Base: base, Filters: []RoundTripFilter{outer, inner}}
+
+	t.Run("order", func(t *testing.T) {
+		order = nil
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		want := "outer,inner,base:outer,outer done"
+		if got := strings.Join(order, ","); got != want {
+			t.Errorf("order = %v, want %v", got, want)
+		}
+	})
+	t.Run("short circuit", func(t *testing.T) {
+		order = nil
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/cached", nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("StatusCode = %v, want %v", resp.StatusCode, http.StatusNoContent)
+		}
+		want := "outer,inner,outer done"
+		if got := strings.Join(order, ","); got != want {
+			t.Errorf("order = %v, want %v", got, want)
+		}
+	})
+}
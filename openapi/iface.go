@@ -2,6 +2,7 @@ package openapi
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/tencent-connect/botgo/dto"
@@ -29,15 +30,54 @@ type OpenAPI interface {
 // Base 基础能力接口
 type Base interface {
 	Version() APIVersion
+	// Setup 创建实例，需要指定配置项时使用 openapi.Setup
 	Setup(token *token.Token, inSandbox bool) OpenAPI
 	// WithTimeout 设置请求接口超时时间
 	WithTimeout(duration time.Duration) OpenAPI
 	// Transport 透传请求，如果 sdk 没有及时跟进新的接口的变更，可以使用该方法进行透传，openapi 实现时可以按需选择是否实现该接口
 	Transport(ctx context.Context, method, url string, body interface{}) ([]byte, error)
-	// TraceID 返回上一次请求的 trace id
+	// TraceID 返回上一次请求的 trace id，并发请求的场景下无法对应到具体的请求，请使用 WithTraceCollector 获取指定请求的 trace id
 	TraceID() string
 }
 
+// 以下能力单独声明，不修改 Base，已有的 openapi 实现不需要修改，内置的 v1 实现都支持
+// 使用时通过类型断言判断，如 api.(openapi.RetrySetter).WithRetry(policy)
+
+// BaseURLSetter 支持设置请求地址前缀的 openapi 实现
+type BaseURLSetter interface {
+	// WithBaseURL 设置请求地址前缀，如 http://127.0.0.1:8080，等同于 Setup 时使用 WithEndpoint
+	// url 无法解析时 panic，避免请求继续发往原来的地址，如默认的正式环境
+	WithBaseURL(baseURL string) OpenAPI
+}
+
+// RetrySetter 支持请求失败重试的 openapi 实现
+type RetrySetter interface {
+	// WithRetry 设置请求失败时的重试策略，默认只重试幂等的请求
+	WithRetry(policy RetryPolicy) OpenAPI
+}
+
+// RateLimitSetter 支持客户端限频的 openapi 实现
+type RateLimitSetter interface {
+	// WithRateLimit 开启客户端限频，按照路由与主要参数（channel_id，guild_id）分桶
+	WithRateLimit(policy RateLimitPolicy) OpenAPI
+}
+
+// FilterSetter 支持实例级别请求过滤器的 openapi 实现
+type FilterSetter interface {
+	// WithFilters 为当前实例追加请求过滤器，只对当前实例生效，先添加的过滤器在外层
+	WithFilters(filters ...RoundTripFilter) OpenAPI
+}
+
+// MultipartMessageAPI 支持使用 multipart/form-data 发消息并上传图片的 openapi 实现
+type MultipartMessageAPI interface {
+	// PostMessageMultipart 使用 multipart/form-data 发消息，同时上传 fileName 对应的图片，图片内容从 file 中读取
+	PostMessageMultipart(ctx context.Context,
+		channelID string, msg *dto.MessageToCreate, fileName string, file io.Reader) (*dto.Message, error)
+	// PostDirectMessageMultipart 使用 multipart/form-data 在私信频道内发消息，同时上传图片
+	PostDirectMessageMultipart(ctx context.Context,
+		dm *dto.DirectMessage, msg *dto.MessageToCreate, fileName string, file io.Reader) (*dto.Message, error)
+}
+
 // WebsocketAPI websocket 接入地址
 type WebsocketAPI interface {
 	WS(ctx context.Context, params map[string]string, body string) (*dto.WebsocketAP, error)
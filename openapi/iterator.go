@@ -0,0 +1,266 @@
+package openapi
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// 分页接口的最大分页大小，迭代器默认使用最大分页大小
+const (
+	MaxGuildMembersPageSize = 1000
+	MaxGuildsPageSize       = 100
+	MaxMessagesPageSize     = 20
+)
+
+// pageFetchFunc 拉取游标之后的一页数据，返回数据，数据对应的去重 id，以及下一页的游标，id 为空的数据不去重
+type pageFetchFunc func(ctx context.Context, cursor string) (items []interface{}, ids []string, next string, err error)
+
+// iterator 通用的翻页迭代器
+// 翻页接口可能会在相邻的页返回相同的数据，如游标对应的数据，所以会根据 id 过滤掉上一页已经返回过的数据
+// 只记录上一页的 id，遍历很多数据时不会占用越来越多的内存
+// 回包中全部是重复数据时继续从新的游标翻页，当回包为空，或者游标不再前进，回到已经请求过的位置的时候，认为已经遍历完毕，避免死循环
+type iterator struct {
+	fetch   pageFetchFunc
+	cursor  string
+	page    []interface{}
+	prev    map[string]bool // 上一页数据的 id
+	cursors map[string]bool // 已经请求过的游标，每页一个
+	current interface{}
+	err     error
+	done    bool
+}
+
+func (it *iterator) next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		it.fetchPage(ctx)
+	}
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+func (it *iterator) fetchPage(ctx context.Context) {
+	items, ids, next, err := it.fetch(ctx, it.cursor)
+	if err != nil {
+		it.err = err
+		return
+	}
+	if it.cursors == nil {
+		it.cursors = map[string]bool{}
+	}
+	it.cursors[it.cursor] = true
+	prev := it.prev
+	it.prev = make(map[string]bool, len(items))
+	for i, item := range items {
+		if id := ids[i]; id != "" {
+			it.prev[id] = true
+			if prev[id] {
+				continue
+			}
+		}
+		it.page = append(it.page, item)
+	}
+	if len(items) == 0 || next == "" || it.cursors[next] {
+		it.done = true
+	}
+	it.cursor = next
+}
+
+func pageSizeOrMax(pageSize, max int) string {
+	if pageSize <= 0 || pageSize > max {
+		pageSize = max
+	}
+	return strconv.Itoa(pageSize)
+}
+
+// GuildMembersIterator 遍历频道内的所有成员
+//
+//	it := openapi.NewGuildMembersIterator(api, guildID, 0)
+//	for it.Next(ctx) {
+//		member := it.Member()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type GuildMembersIterator struct {
+	it iterator
+}
+
+// NewGuildMembersIterator 创建频道成员迭代器，pageSize 为每页拉取的数量，小于等于 0 时使用最大值
+func NewGuildMembersIterator(api GuildAPI, guildID string, pageSize int) *GuildMembersIterator {
+	limit := pageSizeOrMax(pageSize, MaxGuildMembersPageSize)
+	return &GuildMembersIterator{
+		it: iterator{
+			fetch: func(ctx context.Context, cursor string) ([]interface{}, []string, string, error) {
+				members, err := api.GuildMembers(ctx, guildID, &dto.GuildMembersPager{After: cursor, Limit: limit})
+				if err != nil {
+					return nil, nil, "", err
+				}
+				items := make([]interface{}, 0, len(members))
+				ids := make([]string, 0, len(members))
+				next := cursor
+				for _, m := range members {
+					id := ""
+					if m.User != nil {
+						id = m.User.ID
+					}
+					items = append(items, m)
+					ids = append(ids, id)
+					// 没有 User 的成员不能作为游标，使用最后一个有 id 的成员
+					if id != "" {
+						next = id
+					}
+				}
+				return items, ids, next, nil
+			},
+		},
+	}
+}
+
+// Next 移动到下一个成员，遍历完毕或者发生错误时返回 false
+func (m *GuildMembersIterator) Next(ctx context.Context) bool {
+	return m.it.next(ctx)
+}
+
+// Member 返回当前成员
+func (m *GuildMembersIterator) Member() *dto.Member {
+	member, _ := m.it.current.(*dto.Member)
+	return member
+}
+
+// Err 返回遍历过程中发生的错误
+func (m *GuildMembersIterator) Err() error {
+	return m.it.err
+}
+
+// GuildsIterator 遍历当前用户加入的所有频道
+type GuildsIterator struct {
+	it iterator
+}
+
+// NewGuildsIterator 创建频道迭代器，pageSize 为每页拉取的数量，小于等于 0 时使用最大值
+func NewGuildsIterator(api UserAPI, pageSize int) *GuildsIterator {
+	limit := pageSizeOrMax(pageSize, MaxGuildsPageSize)
+	return &GuildsIterator{
+		it: iterator{
+			fetch: func(ctx context.Context, cursor string) ([]interface{}, []string, string, error) {
+				guilds, err := api.MeGuilds(ctx, &dto.GuildPager{After: cursor, Limit: limit})
+				if err != nil {
+					return nil, nil, "", err
+				}
+				items := make([]interface{}, 0, len(guilds))
+				ids := make([]string, 0, len(guilds))
+				next := cursor
+				for _, g := range guilds {
+					items = append(items, g)
+					ids = append(ids, g.ID)
+					next = g.ID
+				}
+				return items, ids, next, nil
+			},
+		},
+	}
+}
+
+// Next 移动到下一个频道，遍历完毕或者发生错误时返回 false
+func (g *GuildsIterator) Next(ctx context.Context) bool {
+	return g.it.next(ctx)
+}
+
+// Guild 返回当前频道
+func (g *GuildsIterator) Guild() *dto.Guild {
+	guild, _ := g.it.current.(*dto.Guild)
+	return guild
+}
+
+// Err 返回遍历过程中发生的错误
+func (g *GuildsIterator) Err() error {
+	return g.it.err
+}
+
+// MessagesIterator 遍历子频道内的消息
+type MessagesIterator struct {
+	it iterator
+}
+
+// NewMessagesIterator 创建消息迭代器，从 messageID 开始按照 pagerType 指定的方向遍历，messageID 为空时从最新的消息开始
+// pagerType 只支持 dto.MPTBefore 与 dto.MPTAfter，其他值按照 dto.MPTBefore 处理
+// pageSize 为每页拉取的数量，小于等于 0 时使用最大值
+func NewMessagesIterator(
+	api MessageAPI, channelID string, pagerType dto.MessagePagerType, messageID string, pageSize int,
+) *MessagesIterator {
+	if pagerType != dto.MPTAfter {
+		pagerType = dto.MPTBefore
+	}
+	limit := pageSizeOrMax(pageSize, MaxMessagesPageSize)
+	return &MessagesIterator{
+		it: iterator{
+			cursor: messageID,
+			fetch: func(ctx context.Context, cursor string) ([]interface{}, []string, string, error) {
+				messages, err := api.Messages(ctx, channelID, &dto.MessagesPager{
+					Type:  pagerType,
+					ID:    cursor,
+					Limit: limit,
+				})
+				if err != nil {
+					return nil, nil, "", err
+				}
+				items := make([]interface{}, 0, len(messages))
+				ids := make([]string, 0, len(messages))
+				for _, m := range messages {
+					items = append(items, m)
+					ids = append(ids, m.ID)
+				}
+				next := cursor
+				if edge := edgeMessage(messages, pagerType == dto.MPTBefore); edge != nil {
+					next = edge.ID
+				}
+				return items, ids, next, nil
+			},
+		},
+	}
+}
+
+// Next 移动到下一条消息，遍历完毕或者发生错误时返回 false
+func (m *MessagesIterator) Next(ctx context.Context) bool {
+	return m.it.next(ctx)
+}
+
+// Message 返回当前消息
+func (m *MessagesIterator) Message() *dto.Message {
+	message, _ := m.it.current.(*dto.Message)
+	return message
+}
+
+// Err 返回遍历过程中发生的错误
+func (m *MessagesIterator) Err() error {
+	return m.it.err
+}
+
+// edgeMessage 根据子频道内的消息 seq 找到一页消息的边界，oldest 为 true 时返回最早的一条，否则返回最新的一条
+// seq 无法解析的时候，使用最后一条消息
+func edgeMessage(messages []*dto.Message, oldest bool) *dto.Message {
+	if len(messages) == 0 {
+		return nil
+	}
+	edge := messages[len(messages)-1]
+	var edgeSeq uint64
+	for i, m := range messages {
+		seq, err := strconv.ParseUint(m.SeqInChannel, 10, 64)
+		if err != nil {
+			return messages[len(messages)-1]
+		}
+		if i == 0 || (oldest && seq < edgeSeq) || (!oldest && seq > edgeSeq) {
+			edge, edgeSeq = m, seq
+		}
+	}
+	return edge
+}
@@ -0,0 +1,152 @@
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// fakeMemberAPI 模拟成员分页接口，after 对应的成员也会返回，用于验证翻页边界去重
+type fakeMemberAPI struct {
+	GuildAPI
+	members []*dto.Member
+	repeat  bool // 总是返回第一页
+}
+
+func (f *fakeMemberAPI) GuildMembers(
+	_ context.Context, _ string, pager *dto.GuildMembersPager,
+) ([]*dto.Member, error) {
+	limit, _ := strconv.Atoi(pager.Limit)
+	start := 0
+	if !f.repeat {
+		for i, m := range f.members {
+			if m.User.ID == pager.After {
+				start = i
+			}
+		}
+	}
+	end := start + limit
+	if end > len(f.members) {
+		end = len(f.members)
+	}
+	return f.members[start:end], nil
+}
+
+// scriptedMemberAPI 按顺序返回指定的分页，记录每次请求的游标
+type scriptedMemberAPI struct {
+	GuildAPI
+	pages  [][]*dto.Member
+	afters []string
+}
+
+func (f *scriptedMemberAPI) GuildMembers(
+	_ context.Context, _ string, pager *dto.GuildMembersPager,
+) ([]*dto.Member, error) {
+	f.afters = append(f.afters, pager.After)
+	if len(f.afters) > len(f.pages) {
+		return nil, nil
+	}
+	return f.pages[len(f.afters)-1], nil
+}
+
+func membersOf(ids ...string) []*dto.Member {
+	members := make([]*dto.Member, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, &dto.Member{User: &dto.User{ID: id}})
+	}
+	return members
+}
+
+func newMembers(n int) []*dto.Member {
+	members := make([]*dto.Member, 0, n)
+	for i := 0; i < n; i++ {
+		members = append(members, &dto.Member{User: &dto.User{ID: strconv.Itoa(i + 1)}})
+	}
+	return members
+}
+
+func TestGuildMembersIterator(t *testing.T) {
+	tests := []struct {
+		name     string
+		api      *fakeMemberAPI
+		pageSize int
+		want     int
+	}{
+		{"boundary dedupe", &fakeMemberAPI{members: newMembers(10)}, 3, 10},
+		{"single page", &fakeMemberAPI{members: newMembers(2)}, 0, 2},
+		{"empty", &fakeMemberAPI{}, 3, 0},
+		{"repeated page", &fakeMemberAPI{members: newMembers(5), repeat: true}, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := NewGuildMembersIterator(tt.api, "guild", tt.pageSize)
+			seen := map[string]bool{}
+			for it.Next(context.Background()) {
+				id := it.Member().User.ID
+				if seen[id] {
+					t.Errorf("member %s returned twice", id)
+				}
+				seen[id] = true
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != tt.want {
+				t.Errorf("got %d members, want %d", len(seen), tt.want)
+			}
+		})
+	}
+	t.Run("scripted pages", func(t *testing.T) {
+		api := &scriptedMemberAPI{pages: [][]*dto.Member{
+			membersOf("1", "2", "3"),
+			append(membersOf("3", "5"), &dto.Member{Nick: "no user"}, &dto.Member{User: &dto.User{ID: "4"}}),
+			membersOf("5"),
+			membersOf("5", "6"),
+		}}
+		it := NewGuildMembersIterator(api, "guild", 3)
+		var got []string
+		for it.Next(context.Background()) {
+			if m := it.Member(); m.User != nil {
+				got = append(got, m.User.ID)
+			} else {
+				got = append(got, m.Nick)
+			}
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		// 没有 User 的成员不影响游标，上一页返回过的成员被过滤，全部重复的一页继续从新的游标翻页
+		if want := "[1 2 3 5 no user 4 6]"; fmt.Sprint(got) != want {
+			t.Errorf("members = %v, want %v", got, want)
+		}
+		if want := "[ 3 4 5 6]"; fmt.Sprint(api.afters) != want {
+			t.Errorf("cursors = %v, want %v", api.afters, want)
+		}
+	})
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		it := NewGuildMembersIterator(&fakeMemberAPI{members: newMembers(3)}, "guild", 1)
+		if it.Next(ctx) {
+			t.Error("Next() = true, want false")
+		}
+		if it.Err() != context.Canceled {
+			t.Errorf("Err() = %v, want %v", it.Err(), context.Canceled)
+		}
+	})
+}
+
+func TestEdgeMessage(t *testing.T) {
+	messages := []*dto.Message{
+		{ID: "b", SeqInChannel: "2"}, {ID: "c", SeqInChannel: "3"}, {ID: "a", SeqInChannel: "1"},
+	}
+	if got := edgeMessage(messages, true).ID; got != "a" {
+		t.Errorf("oldest = %v, want a", got)
+	}
+	if got := edgeMessage(messages, false).ID; got != "c" {
+		t.Errorf("newest = %v, want c", got)
+	}
+}
@@ -0,0 +1,888 @@
+package openapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// 分页接口在没有传入 limit 时的默认值
+const (
+	defaultMembersLimit  = 1
+	defaultGuildsLimit   = 100
+	defaultMessagesLimit = 20
+)
+
+// roleNumLimit 身份组数量上限
+const roleNumLimit = "30"
+
+// maxMultipartMemory 解析 multipart 请求时使用的最大内存
+const maxMultipartMemory = 32 << 20
+
+// registerRoutes 注册路由，与 openapi/v1/resource.go 中的 uri 一一对应
+func (s *Server) registerRoutes() {
+	s.handle(http.MethodGet, "/guilds/{guild_id}", s.getGuild)
+	s.handle(http.MethodGet, "/guilds/{guild_id}/members", s.listMembers)
+	s.handle(http.MethodGet, "/guilds/{guild_id}/members/{user_id}", s.getMember)
+	s.handle(http.MethodDelete, "/guilds/{guild_id}/members/{user_id}", s.deleteMember)
+	s.handle(http.MethodPatch, "/guilds/{guild_id}/mute", s.guildMute)
+	s.handle(http.MethodPatch, "/guilds/{guild_id}/members/{user_id}/mute", s.memberMute)
+
+	s.handle(http.MethodGet, "/guilds/{guild_id}/channels", s.listChannels)
+	s.handle(http.MethodPost, "/guilds/{guild_id}/channels", s.postChannel)
+	s.handle(http.MethodGet, "/channels/{channel_id}", s.getChannel)
+	s.handle(http.MethodPatch, "/channels/{channel_id}", s.patchChannel)
+	s.handle(http.MethodDelete, "/channels/{channel_id}", s.deleteChannel)
+
+	s.handle(http.MethodGet, "/channels/{channel_id}/members/{user_id}/permissions", s.getMemberPermissions)
+	s.handle(http.MethodPut, "/channels/{channel_id}/members/{user_id}/permissions", s.putMemberPermissions)
+	s.handle(http.MethodGet, "/channels/{channel_id}/roles/{role_id}/permissions", s.getRolePermissions)
+	s.handle(http.MethodPut, "/channels/{channel_id}/roles/{role_id}/permissions", s.putRolePermissions)
+
+	s.handle(http.MethodGet, "/channels/{channel_id}/messages", s.listMessages)
+	s.handle(http.MethodPost, "/channels/{channel_id}/messages", s.postMessage)
+	s.handle(http.MethodGet, "/channels/{channel_id}/messages/{message_id}", s.getMessage)
+	s.handle(http.MethodDelete, "/channels/{channel_id}/messages/{message_id}", s.deleteMessage)
+
+	s.handle(http.MethodGet, "/users/@me", s.getMe)
+	s.handle(http.MethodGet, "/users/@me/guilds", s.listMeGuilds)
+	s.handle(http.MethodPost, "/users/@me/dms", s.createDirectMessage)
+
+	s.handle(http.MethodGet, "/gateway", s.getGateway)
+	s.handle(http.MethodGet, "/gateway/bot", s.getGateway)
+
+	s.handle(http.MethodPost, "/channels/{channel_id}/audio", s.postAudio)
+
+	s.handle(http.MethodGet, "/guilds/{guild_id}/roles", s.listRoles)
+	s.handle(http.MethodPost, "/guilds/{guild_id}/roles", s.postRole)
+	s.handle(http.MethodPatch, "/guilds/{guild_id}/roles/{role_id}", s.patchRole)
+	s.handle(http.MethodDelete, "/guilds/{guild_id}/roles/{role_id}", s.deleteRole)
+
+	s.handle(http.MethodPut, "/guilds/{guild_id}/members/{user_id}/roles/{role_id}", s.addMemberRole)
+	s.handle(http.MethodDelete, "/guilds/{guild_id}/members/{user_id}/roles/{role_id}", s.deleteMemberRole)
+
+	s.handle(http.MethodPost, "/dms/{guild_id}/messages", s.postDirectMessage)
+	s.handle(http.MethodDelete, "/dms/{guild_id}/messages/{message_id}", s.deleteDirectMessage)
+
+	s.handle(http.MethodPost, "/channels/{channel_id}/announces", s.postChannelAnnounces)
+	s.handle(http.MethodDelete, "/channels/{channel_id}/announces/{message_id}", s.deleteChannelAnnounces)
+	s.handle(http.MethodPost, "/guilds/{guild_id}/announces", s.postGuildAnnounces)
+	s.handle(http.MethodDelete, "/guilds/{guild_id}/announces/{message_id}", s.deleteGuildAnnounces)
+
+	s.handle(http.MethodGet, "/channels/{channel_id}/schedules", s.listSchedules)
+	s.handle(http.MethodPost, "/channels/{channel_id}/schedules", s.postSchedule)
+	s.handle(http.MethodGet, "/channels/{channel_id}/schedules/{schedule_id}", s.getSchedule)
+	s.handle(http.MethodPatch, "/channels/{channel_id}/schedules/{schedule_id}", s.patchSchedule)
+	s.handle(http.MethodDelete, "/channels/{channel_id}/schedules/{schedule_id}", s.deleteSchedule)
+
+	s.handle(http.MethodGet, "/guilds/{guild_id}/api_permission", s.getAPIPermissions)
+	s.handle(http.MethodPost, "/guilds/{guild_id}/api_permission/demand", s.postAPIPermissionDemand)
+}
+
+func notFound(what string) (int, interface{}) {
+	return http.StatusNotFound, &errorBody{Code: http.StatusNotFound, Message: what + " not found"}
+}
+
+func badRequest(err error) (int, interface{}) {
+	return http.StatusBadRequest, &errorBody{Code: http.StatusBadRequest, Message: err.Error()}
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func limitParam(r *http.Request, def int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	return limit
+}
+
+func now() dto.Timestamp {
+	return dto.Timestamp(time.Now().Format(time.RFC3339))
+}
+
+func (s *Server) getGuild(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	guild := s.guild(params["guild_id"])
+	if guild == nil {
+		return notFound("guild")
+	}
+	return http.StatusOK, guild
+}
+
+func (s *Server) listMembers(r *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	members := s.members[params["guild_id"]]
+	start := 0
+	if after := r.URL.Query().Get("after"); after != "" && after != "0" {
+		i, _ := s.member(params["guild_id"], after)
+		start = i + 1
+	}
+	end := start + limitParam(r, defaultMembersLimit)
+	if end > len(members) {
+		end = len(members)
+	}
+	return http.StatusOK, append([]*dto.Member{}, members[start:end]...)
+}
+
+func (s *Server) getMember(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, member := s.member(params["guild_id"], params["user_id"])
+	if member == nil {
+		return notFound("member")
+	}
+	return http.StatusOK, member
+}
+
+func (s *Server) deleteMember(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	i, _ := s.member(guildID, params["user_id"])
+	if i < 0 {
+		return notFound("member")
+	}
+	s.members[guildID] = append(s.members[guildID][:i], s.members[guildID][i+1:]...)
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) guildMute(r *http.Request, params map[string]string) (int, interface{}) {
+	return s.saveMute(r, params["guild_id"], "")
+}
+
+func (s *Server) memberMute(r *http.Request, params map[string]string) (int, interface{}) {
+	return s.saveMute(r, params["guild_id"], params["user_id"])
+}
+
+func (s *Server) saveMute(r *http.Request, guildID, userID string) (int, interface{}) {
+	mute := &dto.UpdateGuildMute{}
+	if err := decode(r, mute); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.guild(guildID) == nil {
+		return notFound("guild")
+	}
+	s.mutes[muteKey(guildID, userID)] = mute
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) listChannels(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	channels := []*dto.Channel{}
+	for _, c := range s.channels {
+		if c.GuildID == params["guild_id"] {
+			channels = append(channels, c)
+		}
+	}
+	return http.StatusOK, channels
+}
+
+func (s *Server) postChannel(r *http.Request, params map[string]string) (int, interface{}) {
+	channel := &dto.Channel{GuildID: params["guild_id"]}
+	if err := decode(r, &channel.ChannelValueObject); err != nil {
+		return badRequest(err)
+	}
+	return http.StatusOK, s.AddChannel(channel)
+}
+
+func (s *Server) getChannel(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	channel := s.channel(params["channel_id"])
+	if channel == nil {
+		return notFound("channel")
+	}
+	return http.StatusOK, channel
+}
+
+func (s *Server) patchChannel(r *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channel := s.channel(params["channel_id"])
+	if channel == nil {
+		return notFound("channel")
+	}
+	// 只更新请求中带上的字段
+	if err := decode(r, &channel.ChannelValueObject); err != nil {
+		return badRequest(err)
+	}
+	return http.StatusOK, channel
+}
+
+func (s *Server) deleteChannel(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, c := range s.channels {
+		if c.ID == params["channel_id"] {
+			s.channels = append(s.channels[:i], s.channels[i+1:]...)
+			return http.StatusOK, c
+		}
+	}
+	return notFound("channel")
+}
+
+func (s *Server) getMemberPermissions(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return http.StatusOK, &dto.ChannelPermissions{
+		ChannelID:   params["channel_id"],
+		UserID:      params["user_id"],
+		Permissions: s.permission(params["channel_id"], "user", params["user_id"]),
+	}
+}
+
+func (s *Server) putMemberPermissions(r *http.Request, params map[string]string) (int, interface{}) {
+	return s.updatePermission(r, params["channel_id"], "user", params["user_id"])
+}
+
+func (s *Server) getRolePermissions(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return http.StatusOK, &dto.ChannelRolesPermissions{
+		ChannelID:   params["channel_id"],
+		RoleID:      params["role_id"],
+		Permissions: s.permission(params["channel_id"], "role", params["role_id"]),
+	}
+}
+
+func (s *Server) putRolePermissions(r *http.Request, params map[string]string) (int, interface{}) {
+	return s.updatePermission(r, params["channel_id"], "role", params["role_id"])
+}
+
+func permissionKey(channelID, kind, id string) string {
+	return channelID + "/" + kind + "/" + id
+}
+
+func (s *Server) permission(channelID, kind, id string) string {
+	if p, ok := s.permissions[permissionKey(channelID, kind, id)]; ok {
+		return p
+	}
+	return "0"
+}
+
+// updatePermission 按照位运算处理权限的增加与删除，先增加后删除
+func (s *Server) updatePermission(r *http.Request, channelID, kind, id string) (int, interface{}) {
+	update := &dto.UpdateChannelPermissions{}
+	if err := decode(r, update); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.channel(channelID) == nil {
+		return notFound("channel")
+	}
+	current, _ := strconv.ParseUint(s.permission(channelID, kind, id), 10, 64)
+	if update.Add != "" {
+		add, err := strconv.ParseUint(update.Add, 10, 64)
+		if err != nil {
+			return badRequest(err)
+		}
+		current |= add
+	}
+	if update.Remove != "" {
+		remove, err := strconv.ParseUint(update.Remove, 10, 64)
+		if err != nil {
+			return badRequest(err)
+		}
+		current &^= remove
+	}
+	s.permissions[permissionKey(channelID, kind, id)] = strconv.FormatUint(current, 10)
+	return http.StatusNoContent, nil
+}
+
+// listMessages 支持 before，after，around 三种拉取方式，不带消息 id 时返回最新的消息
+func (s *Server) listMessages(r *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	messages := s.messages[params["channel_id"]]
+	limit := limitParam(r, defaultMessagesLimit)
+	query := r.URL.Query()
+	start, end := len(messages)-limit, len(messages)
+	if pagerType, id := messagePager(query); id != "" {
+		i := messageIndex(messages, id)
+		if i < 0 {
+			return notFound("message")
+		}
+		switch pagerType {
+		case dto.MPTBefore:
+			start, end = i-limit, i
+		case dto.MPTAfter:
+			start, end = i+1, i+1+limit
+		default:
+			start, end = i-limit/2, i-limit/2+limit
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(messages) {
+		end = len(messages)
+	}
+	if start > end {
+		start = end
+	}
+	return http.StatusOK, append([]*dto.Message{}, messages[start:end]...)
+}
+
+func messagePager(query url.Values) (dto.MessagePagerType, string) {
+	for _, pagerType := range []dto.MessagePagerType{dto.MPTBefore, dto.MPTAfter, dto.MPTAround} {
+		if id := query.Get(string(pagerType)); id != "" {
+			return pagerType, id
+		}
+	}
+	return "", ""
+}
+
+func messageIndex(messages []*dto.Message, messageID string) int {
+	for i, m := range messages {
+		if m.ID == messageID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) postMessage(r *http.Request, params map[string]string) (int, interface{}) {
+	message, err := s.readMessage(r)
+	if err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channel := s.channel(params["channel_id"])
+	if channel == nil {
+		return notFound("channel")
+	}
+	message.GuildID = channel.GuildID
+	return http.StatusOK, s.addMessage(channel.ID, message)
+}
+
+// readMessage 解析 json 或者 multipart/form-data 格式的发消息请求
+func (s *Server) readMessage(r *http.Request) (*dto.Message, error) {
+	toCreate := &dto.MessageToCreate{}
+	var attachments []*dto.MessageAttachment
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return nil, err
+		}
+		toCreate.Content = r.FormValue("content")
+		toCreate.Image = r.FormValue("image")
+		toCreate.MsgID = r.FormValue("msg_id")
+		for _, field := range []struct {
+			name  string
+			value interface{}
+		}{
+			{"embed", &toCreate.Embed},
+			{"ark", &toCreate.Ark},
+			{"message_reference", &toCreate.MessageReference},
+			{"markdown", &toCreate.Markdown},
+		} {
+			if v := r.FormValue(field.name); v != "" {
+				if err := json.Unmarshal([]byte(v), field.value); err != nil {
+					return nil, fmt.Errorf("invalid field %s: %v", field.name, err)
+				}
+			}
+		}
+		for _, files := range r.MultipartForm.File {
+			for _, f := range files {
+				attachments = append(attachments, &dto.MessageAttachment{URL: f.Filename})
+			}
+		}
+	} else if err := decode(r, toCreate); err != nil {
+		return nil, err
+	}
+	if toCreate.Image != "" {
+		attachments = append(attachments, &dto.MessageAttachment{URL: toCreate.Image})
+	}
+	s.lock.RLock()
+	author := s.me
+	s.lock.RUnlock()
+	message := &dto.Message{
+		Content:     toCreate.Content,
+		Timestamp:   now(),
+		Author:      author,
+		Attachments: attachments,
+		Ark:         toCreate.Ark,
+	}
+	if toCreate.Embed != nil {
+		message.Embeds = []*dto.Embed{toCreate.Embed}
+	}
+	return message, nil
+}
+
+func (s *Server) getMessage(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	messages := s.messages[params["channel_id"]]
+	i := messageIndex(messages, params["message_id"])
+	if i < 0 {
+		return notFound("message")
+	}
+	return http.StatusOK, messages[i]
+}
+
+func (s *Server) deleteMessage(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channelID := params["channel_id"]
+	i := messageIndex(s.messages[channelID], params["message_id"])
+	if i < 0 {
+		return notFound("message")
+	}
+	s.messages[channelID] = append(s.messages[channelID][:i], s.messages[channelID][i+1:]...)
+	return http.StatusOK, nil
+}
+
+func (s *Server) getMe(_ *http.Request, _ map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return http.StatusOK, s.me
+}
+
+func (s *Server) listMeGuilds(r *http.Request, _ map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	limit := limitParam(r, defaultGuildsLimit)
+	start, end := 0, limit
+	query := r.URL.Query()
+	if after := query.Get("after"); after != "" {
+		start = s.guildIndex(after) + 1
+		end = start + limit
+	} else if before := query.Get("before"); before != "" {
+		end = s.guildIndex(before)
+		start = end - limit
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > len(s.guilds) {
+		end = len(s.guilds)
+	}
+	if start > end {
+		start = end
+	}
+	return http.StatusOK, append([]*dto.Guild{}, s.guilds[start:end]...)
+}
+
+func (s *Server) guildIndex(guildID string) int {
+	for i, g := range s.guilds {
+		if g.ID == guildID {
+			return i
+		}
+	}
+	return -1
+}
+
+// createDirectMessage 同一个用户与同一个源频道只会创建一个私信会话
+func (s *Server) createDirectMessage(r *http.Request, _ map[string]string) (int, interface{}) {
+	toCreate := &dto.DirectMessageToCreate{}
+	if err := decode(r, toCreate); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := toCreate.SourceGuildID + "/" + toCreate.RecipientID
+	if dm, ok := s.dms[key]; ok {
+		return http.StatusOK, dm
+	}
+	dm := &dto.DirectMessage{
+		GuildID:    s.nextID(),
+		ChannelID:  s.nextID(),
+		CreateTime: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	s.dms[key] = dm
+	return http.StatusOK, dm
+}
+
+func (s *Server) postDirectMessage(r *http.Request, params map[string]string) (int, interface{}) {
+	message, err := s.readMessage(r)
+	if err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	var dm *dto.DirectMessage
+	for _, d := range s.dms {
+		if d.GuildID == guildID {
+			dm = d
+		}
+	}
+	if dm == nil {
+		return notFound("direct message session")
+	}
+	message.ID = s.nextID()
+	message.GuildID = guildID
+	message.ChannelID = dm.ChannelID
+	message.DirectMessage = true
+	message.SeqInChannel = strconv.Itoa(len(s.directMessages[guildID]) + 1)
+	s.directMessages[guildID] = append(s.directMessages[guildID], message)
+	return http.StatusOK, message
+}
+
+func (s *Server) deleteDirectMessage(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	i := messageIndex(s.directMessages[guildID], params["message_id"])
+	if i < 0 {
+		return notFound("message")
+	}
+	s.directMessages[guildID] = append(s.directMessages[guildID][:i], s.directMessages[guildID][i+1:]...)
+	return http.StatusOK, nil
+}
+
+func (s *Server) getGateway(r *http.Request, _ map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.gateway != nil {
+		return http.StatusOK, s.gateway
+	}
+	return http.StatusOK, &dto.WebsocketAP{
+		URL:    "ws://" + r.Host + "/websocket",
+		Shards: 1,
+		SessionStartLimit: dto.SessionStartLimit{
+			Total:          1000,
+			Remaining:      1000,
+			MaxConcurrency: 1,
+		},
+	}
+}
+
+func (s *Server) postAudio(r *http.Request, params map[string]string) (int, interface{}) {
+	control := &dto.AudioControl{}
+	if err := decode(r, control); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.channel(params["channel_id"]) == nil {
+		return notFound("channel")
+	}
+	s.audio[params["channel_id"]] = control
+	return http.StatusOK, control
+}
+
+func (s *Server) listRoles(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	guildID := params["guild_id"]
+	if s.guild(guildID) == nil {
+		return notFound("guild")
+	}
+	return http.StatusOK, &dto.GuildRoles{
+		GuildID:  guildID,
+		Roles:    append([]*dto.Role{}, s.roles[guildID]...),
+		NumLimit: roleNumLimit,
+	}
+}
+
+func (s *Server) postRole(r *http.Request, params map[string]string) (int, interface{}) {
+	update := &dto.UpdateRole{}
+	if err := decode(r, update); err != nil {
+		return badRequest(err)
+	}
+	if update.Update == nil {
+		update.Update = &dto.Role{}
+	}
+	guildID := params["guild_id"]
+	if s.Guild(guildID) == nil {
+		return notFound("guild")
+	}
+	role := s.AddRole(guildID, update.Update)
+	return http.StatusOK, &dto.UpdateResult{RoleID: role.ID, GuildID: guildID, Role: role}
+}
+
+func (s *Server) patchRole(r *http.Request, params map[string]string) (int, interface{}) {
+	update := &dto.UpdateRole{}
+	if err := decode(r, update); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	_, role := s.role(guildID, dto.RoleID(params["role_id"]))
+	if role == nil {
+		return notFound("role")
+	}
+	if update.Update != nil {
+		if update.Filter == nil || update.Filter.Name == 1 {
+			role.Name = update.Update.Name
+		}
+		if update.Filter == nil || update.Filter.Color == 1 {
+			role.Color = update.Update.Color
+		}
+		if update.Filter == nil || update.Filter.Hoist == 1 {
+			role.Hoist = update.Update.Hoist
+		}
+	}
+	return http.StatusOK, &dto.UpdateResult{RoleID: role.ID, GuildID: guildID, Role: role}
+}
+
+func (s *Server) deleteRole(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	i, _ := s.role(guildID, dto.RoleID(params["role_id"]))
+	if i < 0 {
+		return notFound("role")
+	}
+	s.roles[guildID] = append(s.roles[guildID][:i], s.roles[guildID][i+1:]...)
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) role(guildID string, roleID dto.RoleID) (int, *dto.Role) {
+	for i, r := range s.roles[guildID] {
+		if r.ID == roleID {
+			return i, r
+		}
+	}
+	return -1, nil
+}
+
+func (s *Server) addMemberRole(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	member, roleID, ok := s.memberAndRole(params)
+	if !ok {
+		return notFound("member or role")
+	}
+	for _, id := range member.Roles {
+		if id == roleID {
+			return http.StatusNoContent, nil
+		}
+	}
+	member.Roles = append(member.Roles, roleID)
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) deleteMemberRole(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	member, roleID, ok := s.memberAndRole(params)
+	if !ok {
+		return notFound("member or role")
+	}
+	for i, id := range member.Roles {
+		if id == roleID {
+			member.Roles = append(member.Roles[:i], member.Roles[i+1:]...)
+			break
+		}
+	}
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) memberAndRole(params map[string]string) (*dto.Member, string, bool) {
+	guildID := params["guild_id"]
+	_, member := s.member(guildID, params["user_id"])
+	_, role := s.role(guildID, dto.RoleID(params["role_id"]))
+	if member == nil || role == nil {
+		return nil, "", false
+	}
+	return member, string(role.ID), true
+}
+
+func (s *Server) postChannelAnnounces(r *http.Request, params map[string]string) (int, interface{}) {
+	toCreate := &dto.ChannelAnnouncesToCreate{}
+	if err := decode(r, toCreate); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channel := s.channel(params["channel_id"])
+	if channel == nil {
+		return notFound("channel")
+	}
+	if messageIndex(s.messages[channel.ID], toCreate.MessageID) < 0 {
+		return notFound("message")
+	}
+	announces := &dto.Announces{GuildID: channel.GuildID, ChannelID: channel.ID, MessageID: toCreate.MessageID}
+	s.channelAnnounces[channel.ID] = announces
+	return http.StatusOK, announces
+}
+
+// deleteChannelAnnounces message_id 为 all 时删除所有公告
+func (s *Server) deleteChannelAnnounces(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channelID, messageID := params["channel_id"], params["message_id"]
+	announces, ok := s.channelAnnounces[channelID]
+	if !ok || (messageID != "all" && announces.MessageID != messageID) {
+		return notFound("announces")
+	}
+	delete(s.channelAnnounces, channelID)
+	return http.StatusOK, announces
+}
+
+func (s *Server) postGuildAnnounces(r *http.Request, params map[string]string) (int, interface{}) {
+	toCreate := &dto.GuildAnnouncesToCreate{}
+	if err := decode(r, toCreate); err != nil {
+		return badRequest(err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID := params["guild_id"]
+	if s.guild(guildID) == nil {
+		return notFound("guild")
+	}
+	if messageIndex(s.messages[toCreate.ChannelID], toCreate.MessageID) < 0 {
+		return notFound("message")
+	}
+	announces := &dto.Announces{GuildID: guildID, ChannelID: toCreate.ChannelID, MessageID: toCreate.MessageID}
+	s.guildAnnounces[guildID] = announces
+	return http.StatusOK, announces
+}
+
+// deleteGuildAnnounces message_id 为 all 时删除所有公告
+func (s *Server) deleteGuildAnnounces(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	guildID, messageID := params["guild_id"], params["message_id"]
+	announces, ok := s.guildAnnounces[guildID]
+	if !ok || (messageID != "all" && announces.MessageID != messageID) {
+		return notFound("announces")
+	}
+	delete(s.guildAnnounces, guildID)
+	return http.StatusOK, announces
+}
+
+// listSchedules 返回开始时间不早于 since（毫秒时间戳）的日程
+func (s *Server) listSchedules(r *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	schedules := []*dto.Schedule{}
+	for _, schedule := range s.schedules[params["channel_id"]] {
+		start, _ := strconv.ParseUint(schedule.StartTimestamp, 10, 64)
+		if start >= since {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return http.StatusOK, schedules
+}
+
+func (s *Server) postSchedule(r *http.Request, params map[string]string) (int, interface{}) {
+	wrapper := &dto.ScheduleWrapper{}
+	if err := decode(r, wrapper); err != nil {
+		return badRequest(err)
+	}
+	if wrapper.Schedule == nil {
+		return badRequest(fmt.Errorf("schedule is required"))
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channelID := params["channel_id"]
+	if s.channel(channelID) == nil {
+		return notFound("channel")
+	}
+	schedule := wrapper.Schedule
+	schedule.ID = s.nextID()
+	schedule.Creator = &dto.Member{User: s.me}
+	s.schedules[channelID] = append(s.schedules[channelID], schedule)
+	return http.StatusOK, schedule
+}
+
+func (s *Server) getSchedule(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, schedule := s.schedule(params["channel_id"], params["schedule_id"])
+	if schedule == nil {
+		return notFound("schedule")
+	}
+	return http.StatusOK, schedule
+}
+
+func (s *Server) patchSchedule(r *http.Request, params map[string]string) (int, interface{}) {
+	wrapper := &dto.ScheduleWrapper{}
+	if err := decode(r, wrapper); err != nil {
+		return badRequest(err)
+	}
+	if wrapper.Schedule == nil {
+		return badRequest(fmt.Errorf("schedule is required"))
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	i, old := s.schedule(params["channel_id"], params["schedule_id"])
+	if old == nil {
+		return notFound("schedule")
+	}
+	schedule := wrapper.Schedule
+	schedule.ID = old.ID
+	schedule.Creator = old.Creator
+	s.schedules[params["channel_id"]][i] = schedule
+	return http.StatusOK, schedule
+}
+
+func (s *Server) deleteSchedule(_ *http.Request, params map[string]string) (int, interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channelID := params["channel_id"]
+	i, _ := s.schedule(channelID, params["schedule_id"])
+	if i < 0 {
+		return notFound("schedule")
+	}
+	s.schedules[channelID] = append(s.schedules[channelID][:i], s.schedules[channelID][i+1:]...)
+	return http.StatusNoContent, nil
+}
+
+func (s *Server) schedule(channelID, scheduleID string) (int, *dto.Schedule) {
+	for i, schedule := range s.schedules[channelID] {
+		if schedule.ID == scheduleID {
+			return i, schedule
+		}
+	}
+	return -1, nil
+}
+
+// getAPIPermissions 模拟服务中所有接口都已授权
+func (s *Server) getAPIPermissions(_ *http.Request, params map[string]string) (int, interface{}) {
+	if s.Guild(params["guild_id"]) == nil {
+		return notFound("guild")
+	}
+	permissions := &dto.APIPermissions{}
+	for _, rt := range s.routes {
+		permissions.APIList = append(permissions.APIList, &dto.APIPermission{
+			Path:       strings.Join(rt.parts, "/"),
+			Method:     rt.method,
+			AuthStatus: 1,
+		})
+	}
+	return http.StatusOK, permissions
+}
+
+func (s *Server) postAPIPermissionDemand(r *http.Request, params map[string]string) (int, interface{}) {
+	toCreate := &dto.APIPermissionDemandToCreate{}
+	if err := decode(r, toCreate); err != nil {
+		return badRequest(err)
+	}
+	if s.Guild(params["guild_id"]) == nil {
+		return notFound("guild")
+	}
+	return http.StatusOK, &dto.APIPermissionDemand{
+		GuildID:     params["guild_id"],
+		ChannelID:   toCreate.ChannelID,
+		APIIdentify: toCreate.APIIdentify,
+		Desc:        toCreate.Desc,
+	}
+}
@@ -0,0 +1,354 @@
+// Package openapitest 提供一个进程内的 openapi 模拟服务，用于在没有网络的环境下对基于 openapi.OpenAPI 的业务逻辑进行测试。
+//
+//	server := openapitest.NewServer()
+//	defer server.Close()
+//	guild := server.AddGuild(&dto.Guild{Name: "test"})
+//	api := botgo.NewOpenAPI(token).(openapi.BaseURLSetter).WithBaseURL(server.URL)
+package openapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// Server openapi 模拟服务，数据保存在内存中
+type Server struct {
+	*httptest.Server
+
+	idSeq  uint64
+	routes []*route
+
+	lock             sync.RWMutex
+	me               *dto.User
+	gateway          *dto.WebsocketAP
+	guilds           []*dto.Guild
+	channels         []*dto.Channel
+	members          map[string][]*dto.Member // guild id -> members
+	roles            map[string][]*dto.Role   // guild id -> roles
+	messages         map[string][]*dto.Message
+	dms              map[string]*dto.DirectMessage // source guild id + recipient id -> 私信会话
+	directMessages   map[string][]*dto.Message     // dm guild id -> messages
+	schedules        map[string][]*dto.Schedule
+	channelAnnounces map[string]*dto.Announces
+	guildAnnounces   map[string]*dto.Announces
+	permissions      map[string]string // channel id + user id 或者 role id -> 权限
+	mutes            map[string]*dto.UpdateGuildMute
+	audio            map[string]*dto.AudioControl
+}
+
+// NewServer 创建并启动一个模拟服务，使用完毕后需要调用 Close
+func NewServer() *Server {
+	s := &Server{
+		me: &dto.User{
+			ID:       "10000",
+			Username: "fake-bot",
+			Bot:      true,
+		},
+		members:          map[string][]*dto.Member{},
+		roles:            map[string][]*dto.Role{},
+		messages:         map[string][]*dto.Message{},
+		dms:              map[string]*dto.DirectMessage{},
+		directMessages:   map[string][]*dto.Message{},
+		schedules:        map[string][]*dto.Schedule{},
+		channelAnnounces: map[string]*dto.Announces{},
+		guildAnnounces:   map[string]*dto.Announces{},
+		permissions:      map[string]string{},
+		mutes:            map[string]*dto.UpdateGuildMute{},
+		audio:            map[string]*dto.AudioControl{},
+	}
+	s.registerRoutes()
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// ServeHTTP 实现 http.Handler，校验鉴权头后按照路由分发请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(openapi.TraceIDKey, s.nextID())
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "authorization is required")
+		return
+	}
+	for _, rt := range s.routes {
+		params, ok := rt.match(r.Method, r.URL.Path)
+		if !ok {
+			continue
+		}
+		status, body := rt.handler(r, params)
+		s.writeBody(w, status, body)
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("route %s %s not found", r.Method, r.URL.Path))
+}
+
+func (s *Server) nextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&s.idSeq, 1)+10000, 10)
+}
+
+// SetMe 设置 /users/@me 返回的用户信息
+func (s *Server) SetMe(user *dto.User) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.me = user
+}
+
+// SetGateway 设置 /gateway 与 /gateway/bot 返回的接入点信息，可以指向 websocket 的模拟网关
+func (s *Server) SetGateway(ap *dto.WebsocketAP) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.gateway = ap
+}
+
+// AddGuild 添加频道，ID 为空时自动生成
+func (s *Server) AddGuild(guild *dto.Guild) *dto.Guild {
+	if guild.ID == "" {
+		guild.ID = s.nextID()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.guilds = append(s.guilds, guild)
+	return guild
+}
+
+// AddChannel 添加子频道，ID 为空时自动生成
+func (s *Server) AddChannel(channel *dto.Channel) *dto.Channel {
+	if channel.ID == "" {
+		channel.ID = s.nextID()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.channels = append(s.channels, channel)
+	return channel
+}
+
+// AddMember 添加频道成员，成员需要包含 User
+func (s *Server) AddMember(guildID string, member *dto.Member) *dto.Member {
+	member.GuildID = guildID
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.members[guildID] = append(s.members[guildID], member)
+	return member
+}
+
+// AddRole 添加身份组，ID 为空时自动生成
+func (s *Server) AddRole(guildID string, role *dto.Role) *dto.Role {
+	if role.ID == "" {
+		role.ID = dto.RoleID(s.nextID())
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.roles[guildID] = append(s.roles[guildID], role)
+	return role
+}
+
+// AddMessage 添加子频道消息，ID 与 seq 为空时自动生成
+func (s *Server) AddMessage(channelID string, message *dto.Message) *dto.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addMessage(channelID, message)
+}
+
+func (s *Server) addMessage(channelID string, message *dto.Message) *dto.Message {
+	if message.ID == "" {
+		message.ID = s.nextID()
+	}
+	message.ChannelID = channelID
+	if message.SeqInChannel == "" {
+		message.SeqInChannel = strconv.Itoa(len(s.messages[channelID]) + 1)
+	}
+	s.messages[channelID] = append(s.messages[channelID], message)
+	return message
+}
+
+// Guild 获取频道
+func (s *Server) Guild(guildID string) *dto.Guild {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.guild(guildID)
+}
+
+// Channel 获取子频道
+func (s *Server) Channel(channelID string) *dto.Channel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.channel(channelID)
+}
+
+// Members 获取频道成员列表
+func (s *Server) Members(guildID string) []*dto.Member {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dto.Member(nil), s.members[guildID]...)
+}
+
+// Roles 获取频道身份组列表
+func (s *Server) Roles(guildID string) []*dto.Role {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dto.Role(nil), s.roles[guildID]...)
+}
+
+// Messages 获取子频道消息列表，按照发送顺序排列
+func (s *Server) Messages(channelID string) []*dto.Message {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dto.Message(nil), s.messages[channelID]...)
+}
+
+// DirectMessages 获取私信频道消息列表，按照发送顺序排列
+func (s *Server) DirectMessages(guildID string) []*dto.Message {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dto.Message(nil), s.directMessages[guildID]...)
+}
+
+// Schedules 获取子频道日程列表
+func (s *Server) Schedules(channelID string) []*dto.Schedule {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dto.Schedule(nil), s.schedules[channelID]...)
+}
+
+// ChannelAnnounces 获取子频道公告，没有公告时返回 nil
+func (s *Server) ChannelAnnounces(channelID string) *dto.Announces {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.channelAnnounces[channelID]
+}
+
+// GuildAnnounces 获取频道全局公告，没有公告时返回 nil
+func (s *Server) GuildAnnounces(guildID string) *dto.Announces {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.guildAnnounces[guildID]
+}
+
+// Mute 获取禁言设置，userID 为空时获取全员禁言设置
+func (s *Server) Mute(guildID, userID string) *dto.UpdateGuildMute {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.mutes[muteKey(guildID, userID)]
+}
+
+// Audio 获取子频道最后一次的音频控制
+func (s *Server) Audio(channelID string) *dto.AudioControl {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.audio[channelID]
+}
+
+func (s *Server) guild(guildID string) *dto.Guild {
+	for _, g := range s.guilds {
+		if g.ID == guildID {
+			return g
+		}
+	}
+	return nil
+}
+
+func (s *Server) channel(channelID string) *dto.Channel {
+	for _, c := range s.channels {
+		if c.ID == channelID {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) member(guildID, userID string) (int, *dto.Member) {
+	for i, m := range s.members[guildID] {
+		if m.User != nil && m.User.ID == userID {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+func muteKey(guildID, userID string) string {
+	return guildID + "/" + userID
+}
+
+// errorBody 与 openapi 错误回包的结构保持一致
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &errorBody{Code: status, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeBody 写入 handler 的回包，回包可能引用服务中的数据，在读锁内编码，避免与修改数据的请求竞争
+func (s *Server) writeBody(w http.ResponseWriter, status int, body interface{}) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	s.lock.RLock()
+	data, err := json.Marshal(body)
+	s.lock.RUnlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// route 路由，pattern 与 openapi 的 uri 定义保持一致，如 /channels/{channel_id}/messages
+type route struct {
+	method  string
+	parts   []string
+	handler handlerFunc
+}
+
+// handlerFunc 返回状态码与需要 json 编码的回包，回包为 nil 时只返回状态码
+type handlerFunc func(r *http.Request, params map[string]string) (int, interface{})
+
+func (s *Server) handle(method, pattern string, handler handlerFunc) {
+	s.routes = append(s.routes, &route{
+		method:  method,
+		parts:   strings.Split(pattern, "/"),
+		handler: handler,
+	})
+}
+
+func (rt *route) match(method, path string) (map[string]string, bool) {
+	if method != rt.method {
+		return nil, false
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != len(rt.parts) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, part := range rt.parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[strings.Trim(part, "{}")] = parts[i]
+			continue
+		}
+		if part != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
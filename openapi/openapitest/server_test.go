@@ -0,0 +1,178 @@
+package openapitest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tencent-connect/botgo"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/openapi/openapitest"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func newAPI(t *testing.T) (*openapitest.Server, openapi.OpenAPI) {
+	s := openapitest.NewServer()
+	t.Cleanup(s.Close)
+	return s, botgo.NewOpenAPI(token.BotToken(1, "fake")).(openapi.BaseURLSetter).WithBaseURL(s.URL)
+}
+
+func TestServer(t *testing.T) {
+	s, api := newAPI(t)
+	ctx := context.Background()
+	guild := s.AddGuild(&dto.Guild{Name: "guild"})
+	channel := s.AddChannel(&dto.Channel{GuildID: guild.ID, ChannelValueObject: dto.ChannelValueObject{Name: "text"}})
+
+	t.Run("guild and channels", func(t *testing.T) {
+		got, err := api.Guild(ctx, guild.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != guild.Name {
+			t.Errorf("Name = %v, want %v", got.Name, guild.Name)
+		}
+		if _, err := api.PostChannel(ctx, guild.ID, &dto.ChannelValueObject{Name: "voice"}); err != nil {
+			t.Fatal(err)
+		}
+		channels, err := api.Channels(ctx, guild.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(channels) != 2 {
+			t.Errorf("got %d channels, want 2", len(channels))
+		}
+	})
+	t.Run("not found", func(t *testing.T) {
+		_, err := api.Guild(ctx, "missing")
+		if e, ok := err.(*errs.Err); !ok || e.Code() != http.StatusNotFound {
+			t.Errorf("err = %v, want status %d", err, http.StatusNotFound)
+		}
+	})
+	t.Run("messages", func(t *testing.T) {
+		for i := 0; i < 25; i++ {
+			s.AddMessage(channel.ID, &dto.Message{Content: "seed"})
+		}
+		msg, err := api.PostMessage(ctx, channel.ID, &dto.MessageToCreate{Content: "hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		multipart := api.(openapi.MultipartMessageAPI)
+		if _, err := multipart.PostMessageMultipart(
+			ctx, channel.ID, &dto.MessageToCreate{Content: "image"}, "a.png", strings.NewReader("png"),
+		); err != nil {
+			t.Fatal(err)
+		}
+		_, err = multipart.PostMessageMultipart(ctx, channel.ID, &dto.MessageToCreate{}, "a.png", nil)
+		if err != errs.ErrFileIsNil {
+			t.Errorf("err = %v, want %v", err, errs.ErrFileIsNil)
+		}
+		messages := s.Messages(channel.ID)
+		if last := messages[len(messages)-1]; last.Content != "image" || len(last.Attachments) != 1 {
+			t.Errorf("last message = %+v, want multipart message with attachment", last)
+		}
+		if err := api.RetractMessage(ctx, channel.ID, msg.ID); err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		it := openapi.NewMessagesIterator(api, channel.ID, dto.MPTBefore, "", 0)
+		for it.Next(ctx) {
+			count++
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if count != 26 {
+			t.Errorf("iterated %d messages, want 26", count)
+		}
+	})
+	t.Run("roles and members", func(t *testing.T) {
+		s.AddMember(guild.ID, &dto.Member{User: &dto.User{ID: "1"}})
+		result, err := api.PostRole(ctx, guild.ID, &dto.Role{Name: "admin"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := api.MemberAddRole(ctx, guild.ID, result.RoleID, "1", nil); err != nil {
+			t.Fatal(err)
+		}
+		member, err := api.GuildMember(ctx, guild.ID, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(member.Roles) != 1 || member.Roles[0] != string(result.RoleID) {
+			t.Errorf("Roles = %v, want [%v]", member.Roles, result.RoleID)
+		}
+	})
+	t.Run("direct message", func(t *testing.T) {
+		dm, err := api.CreateDirectMessage(ctx, &dto.DirectMessageToCreate{SourceGuildID: guild.ID, RecipientID: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.PostDirectMessage(ctx, dm, &dto.MessageToCreate{Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		multipart := api.(openapi.MultipartMessageAPI)
+		if _, err := multipart.PostDirectMessageMultipart(
+			ctx, dm, &dto.MessageToCreate{Content: "image"}, "a.png", strings.NewReader("png"),
+		); err != nil {
+			t.Fatal(err)
+		}
+		messages := s.DirectMessages(dm.GuildID)
+		if len(messages) != 2 {
+			t.Fatalf("got %d direct messages, want 2", len(messages))
+		}
+		if last := messages[1]; last.Content != "image" || len(last.Attachments) != 1 {
+			t.Errorf("last direct message = %+v, want multipart message with attachment", last)
+		}
+		_, err = multipart.PostDirectMessageMultipart(ctx, dm, &dto.MessageToCreate{}, "a.png", nil)
+		if err != errs.ErrFileIsNil {
+			t.Errorf("err = %v, want %v", err, errs.ErrFileIsNil)
+		}
+	})
+	t.Run("announces and schedules", func(t *testing.T) {
+		msg := s.AddMessage(channel.ID, &dto.Message{Content: "announce"})
+		if _, err := api.CreateChannelAnnounces(
+			ctx, channel.ID, &dto.ChannelAnnouncesToCreate{MessageID: msg.ID},
+		); err != nil {
+			t.Fatal(err)
+		}
+		if err := api.CleanChannelAnnounces(ctx, channel.ID); err != nil {
+			t.Fatal(err)
+		}
+		if s.ChannelAnnounces(channel.ID) != nil {
+			t.Error("announces not cleaned")
+		}
+		schedule, err := api.CreateSchedule(ctx, channel.ID, &dto.Schedule{Name: "meeting", StartTimestamp: "100"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		schedules, err := api.ListSchedules(ctx, channel.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(schedules) != 1 || schedules[0].ID != schedule.ID {
+			t.Errorf("schedules = %v, want [%v]", schedules, schedule.ID)
+		}
+	})
+	t.Run("concurrent patch and get", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = api.PatchChannel(ctx, channel.ID, &dto.ChannelValueObject{Name: fmt.Sprintf("text-%d", i)})
+			}(i)
+			go func() {
+				defer wg.Done()
+				if _, err := api.Channel(ctx, channel.ID); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
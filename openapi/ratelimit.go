@@ -0,0 +1,25 @@
+package openapi
+
+// RateLimit 令牌桶参数
+type RateLimit struct {
+	// Rate 每秒补充的令牌数，小于等于 0 表示不做预设限制，只根据服务端返回的限频头进行限制
+	Rate float64
+	// Burst 桶容量，最小为 1
+	Burst int
+}
+
+// RateLimitPolicy 客户端限频策略，每个路由模板与主要参数（channel_id，guild_id）的组合使用独立的令牌桶
+type RateLimitPolicy struct {
+	// Default 默认的令牌桶参数
+	Default RateLimit
+	// Routes 针对指定路由的令牌桶参数，key 为路由模板，如 /channels/{channel_id}/messages
+	Routes map[string]RateLimit
+}
+
+// Limit 获取路由对应的令牌桶参数，未单独配置的路由使用默认参数
+func (p RateLimitPolicy) Limit(route string) RateLimit {
+	if l, ok := p.Routes[route]; ok {
+		return l
+	}
+	return p.Default
+}
@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy openapi 请求的重试策略，重试间隔为带随机抖动的指数退避
+// 如果服务端返回了 Retry-After 头，则优先按照 Retry-After 的时间等待，但不会超过 MaxWaitTime
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数，包含首次请求，小于等于 1 时不重试
+	MaxAttempts int
+	// WaitTime 首次重试前的基础等待时间，之后每次翻倍
+	WaitTime time.Duration
+	// MaxWaitTime 单次重试的最大等待时间
+	MaxWaitTime time.Duration
+}
+
+// DefaultRetryPolicy 默认的重试策略，最多尝试 3 次
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	WaitTime:    200 * time.Millisecond,
+	MaxWaitTime: 5 * time.Second,
+}
+
+// idempotentMethods 默认允许重试的幂等方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+type retryableKey struct{}
+
+// WithRetryable 标记本次调用允许重试，用于 PostMessage 这类非幂等的 POST 请求
+// 调用方需要自行确认重复请求不会带来副作用，比如发送被动消息时会带上 msg_id
+func WithRetryable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryableKey{}, true)
+}
+
+// IsRetryable 判断请求是否允许重试，幂等方法默认允许，其他方法需要通过 WithRetryable 显式开启
+func IsRetryable(ctx context.Context, method string) bool {
+	if idempotentMethods[method] {
+		return true
+	}
+	flag, _ := ctx.Value(retryableKey{}).(bool)
+	return flag
+}
+
+// IsRetryableStatus 是否是需要重试的状态码，包括频率限制与服务端错误
+func IsRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,42 @@
+package openapi
+
+import (
+	"context"
+	"sync"
+)
+
+type traceCollectorKey struct{}
+
+// traceCollector 收集使用同一个 ctx 发起的请求的 trace id
+type traceCollector struct {
+	lock    sync.Mutex
+	traceID string
+}
+
+// WithTraceCollector 返回一个带有 trace id 收集器的 ctx，使用该 ctx 发起请求之后，可以通过 TraceIDFromContext 获取本次请求的 trace id
+// 如果同一个 ctx 发起了多次请求，获取到的是最后一次收到回包的请求的 trace id
+func WithTraceCollector(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceCollectorKey{}, &traceCollector{})
+}
+
+// TraceIDFromContext 获取使用 WithTraceCollector 返回的 ctx 发起的请求的 trace id
+func TraceIDFromContext(ctx context.Context) string {
+	c, ok := ctx.Value(traceCollectorKey{}).(*traceCollector)
+	if !ok {
+		return ""
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.traceID
+}
+
+// SaveTraceID 将 trace id 写入 ctx 中的收集器，没有收集器的时候不做任何处理，供 openapi 的实现调用
+func SaveTraceID(ctx context.Context, traceID string) {
+	c, ok := ctx.Value(traceCollectorKey{}).(*traceCollector)
+	if !ok {
+		return
+	}
+	c.lock.Lock()
+	c.traceID = traceID
+	c.lock.Unlock()
+}
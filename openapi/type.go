@@ -2,3 +2,13 @@ package openapi
 
 // TraceIDKey 机器人openapi返回的链路追踪ID
 const TraceIDKey = "X-Tps-trace-ID"
+
+// 频率限制相关的返回头，客户端限频会根据这些头更新对应路由的令牌桶
+const (
+	// RateLimitLimitKey 当前时间窗口内允许的请求数
+	RateLimitLimitKey = "X-RateLimit-Limit"
+	// RateLimitRemainingKey 当前时间窗口内剩余的请求数
+	RateLimitRemainingKey = "X-RateLimit-Remaining"
+	// RateLimitResetAfterKey 距离时间窗口重置的秒数，可以是小数
+	RateLimitResetAfterKey = "X-RateLimit-Reset-After"
+)
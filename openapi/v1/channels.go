@@ -2,7 +2,6 @@ package v1
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/tencent-connect/botgo/dto"
 )
@@ -30,7 +29,7 @@ func (o *openAPI) Channels(ctx context.Context, guildID string) ([]*dto.Channel,
 	}
 
 	channels := make([]*dto.Channel, 0)
-	if err := json.Unmarshal(resp.Body(), &channels); err != nil {
+	if err := unmarshal(resp, &channels); err != nil {
 		return nil, err
 	}
 
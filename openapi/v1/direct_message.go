@@ -2,8 +2,10 @@ package v1
 
 import (
 	"context"
+	"io"
 
 	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
 )
 
 // CreateDirectMessage 创建私信频道
@@ -32,6 +34,28 @@ func (o *openAPI) PostDirectMessage(ctx context.Context,
 	return resp.Result().(*dto.Message), nil
 }
 
+// PostDirectMessageMultipart 使用 multipart/form-data 在私信频道内发消息，并上传图片
+func (o *openAPI) PostDirectMessageMultipart(ctx context.Context, dm *dto.DirectMessage, msg *dto.MessageToCreate,
+	fileName string, file io.Reader) (*dto.Message, error) {
+	if file == nil {
+		return nil, errs.ErrFileIsNil
+	}
+	formData, err := messageFormData(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.request(ctx).
+		SetResult(dto.Message{}).
+		SetPathParam("guild_id", dm.GuildID).
+		SetMultipartFormData(formData).
+		SetFileReader(fileImageField, fileName, file).
+		Post(o.getURL(dmsURI))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result().(*dto.Message), nil
+}
+
 // RetractDMMessage 撤回私信消息
 func (o *openAPI) RetractDMMessage(ctx context.Context, guildID, msgID string) error {
 	_, err := o.request(ctx).
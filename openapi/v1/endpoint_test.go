@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func TestEndpoint(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer server.Close()
+	endpoint, err := openapi.ParseEndpoint(server.URL + "/proxy/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		api  openapi.OpenAPI
+	}{
+		{"setup option", (&openAPI{}).SetupWithOptions(token.BotToken(1, "token"), true, openapi.WithEndpoint(endpoint))},
+		{"base url", (&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI).WithBaseURL(server.URL + "/proxy")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.api.Me(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if want := "/proxy" + string(userMeURI); path != want {
+				t.Errorf("path = %v, want %v", path, want)
+			}
+		})
+	}
+	t.Run("invalid base url", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithBaseURL() with invalid url should panic")
+			}
+		}()
+		(&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI).WithBaseURL("127.0.0.1:8080")
+	})
+	t.Run("sandbox profile", func(t *testing.T) {
+		api := (&openAPI{}).Setup(token.BotToken(1, "token"), true).(*openAPI)
+		if !strings.HasPrefix(api.getURL(userMeURI), "https://sandbox.") {
+			t.Errorf("getURL() = %v, want sandbox domain", api.getURL(userMeURI))
+		}
+	})
+}
@@ -2,7 +2,6 @@ package v1
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/errs"
@@ -33,7 +32,7 @@ func (o *openAPI) MeGuilds(ctx context.Context, pager *dto.GuildPager) ([]*dto.G
 	}
 
 	guilds := make([]*dto.Guild, 0)
-	if err := json.Unmarshal(resp.Body(), &guilds); err != nil {
+	if err := unmarshal(resp, &guilds); err != nil {
 		return nil, err
 	}
 
@@ -2,7 +2,6 @@ package v1
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/errs"
@@ -73,7 +72,7 @@ func (o *openAPI) GuildMembers(
 	}
 
 	members := make([]*dto.Member, 0)
-	if err := json.Unmarshal(resp.Body(), &members); err != nil {
+	if err := unmarshal(resp, &members); err != nil {
 		return nil, err
 	}
 
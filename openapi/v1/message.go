@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"encoding/json"
+	"io"
 
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/errs"
@@ -36,7 +37,7 @@ func (o *openAPI) Messages(ctx context.Context, channelID string, pager *dto.Mes
 	}
 
 	messages := make([]*dto.Message, 0)
-	if err := json.Unmarshal(resp.Body(), &messages); err != nil {
+	if err := unmarshal(resp, &messages); err != nil {
 		return nil, err
 	}
 
@@ -57,6 +58,29 @@ func (o *openAPI) PostMessage(ctx context.Context, channelID string, msg *dto.Me
 	return resp.Result().(*dto.Message), nil
 }
 
+// PostMessageMultipart 使用 multipart/form-data 发消息，并上传图片
+func (o *openAPI) PostMessageMultipart(ctx context.Context, channelID string, msg *dto.MessageToCreate,
+	fileName string, file io.Reader) (*dto.Message, error) {
+	if file == nil {
+		return nil, errs.ErrFileIsNil
+	}
+	formData, err := messageFormData(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.request(ctx).
+		SetResult(dto.Message{}).
+		SetPathParam("channel_id", channelID).
+		SetMultipartFormData(formData).
+		SetFileReader(fileImageField, fileName, file).
+		Post(o.getURL(messagesURI))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Result().(*dto.Message), nil
+}
+
 // RetractMessage 撤回消息
 func (o *openAPI) RetractMessage(ctx context.Context, channelID, msgID string) error {
 	_, err := o.request(ctx).
@@ -65,3 +89,41 @@ func (o *openAPI) RetractMessage(ctx context.Context, channelID, msgID string) e
 		Delete(o.getURL(messageURI))
 	return err
 }
+
+// messageFormData 将消息转换为 multipart/form-data 的字段，结构体类型的字段使用 json 编码
+func messageFormData(msg *dto.MessageToCreate) (map[string]string, error) {
+	formData := map[string]string{}
+	if msg == nil {
+		return formData, nil
+	}
+	if msg.Content != "" {
+		formData["content"] = msg.Content
+	}
+	if msg.Image != "" {
+		formData["image"] = msg.Image
+	}
+	if msg.MsgID != "" {
+		formData["msg_id"] = msg.MsgID
+	}
+	jsonFields := []struct {
+		name  string
+		value interface{}
+		isSet bool
+	}{
+		{"embed", msg.Embed, msg.Embed != nil},
+		{"ark", msg.Ark, msg.Ark != nil},
+		{"message_reference", msg.MessageReference, msg.MessageReference != nil},
+		{"markdown", msg.Markdown, msg.Markdown != nil},
+	}
+	for _, field := range jsonFields {
+		if !field.isSet {
+			continue
+		}
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		formData[field.name] = string(data)
+	}
+	return formData, nil
+}
@@ -0,0 +1,33 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+func TestMessageFormData(t *testing.T) {
+	formData, err := messageFormData(&dto.MessageToCreate{
+		Content: "hello",
+		MsgID:   "123",
+		MessageReference: &dto.MessageReference{
+			MessageID: "456",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"content":           "hello",
+		"msg_id":            "123",
+		"message_reference": `{"message_id":"456","ignore_get_message_error":false}`,
+	}
+	if len(formData) != len(want) {
+		t.Errorf("messageFormData() = %v, want %v", formData, want)
+	}
+	for k, v := range want {
+		if formData[k] != v {
+			t.Errorf("messageFormData()[%s] = %v, want %v", k, formData[k], v)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2" // resty 是一个优秀的 rest api 客户端，可以极大的减少开发基于 rest 标准接口求请求的封装工作量
@@ -20,15 +21,30 @@ import (
 // MaxIdleConns 默认指定空闲连接池大小
 const MaxIdleConns = 3000
 
+var (
+	_ openapi.OptionSetup         = (*openAPI)(nil)
+	_ openapi.BaseURLSetter       = (*openAPI)(nil)
+	_ openapi.RetrySetter         = (*openAPI)(nil)
+	_ openapi.RateLimitSetter     = (*openAPI)(nil)
+	_ openapi.FilterSetter        = (*openAPI)(nil)
+	_ openapi.MultipartMessageAPI = (*openAPI)(nil)
+)
+
 type openAPI struct {
-	token   *token.Token
-	timeout time.Duration
+	token       *token.Token
+	timeout     time.Duration
+	retryPolicy openapi.RetryPolicy
+	limiter     *rateLimiter // 客户端限频，为空时不限频
+	filters     []openapi.RoundTripFilter
+	logger      log.Logger
 
-	sandbox     bool   // 请求沙箱环境
-	debug       bool   // debug 模式，调试sdk时候使用
-	lastTraceID string // lastTraceID id
+	endpoint    string       // 请求地址前缀，不带末尾的 /
+	debug       bool         // debug 模式，调试sdk时候使用
+	traceLock   sync.RWMutex // 保护 lastTraceID
+	lastTraceID string       // lastTraceID id
 
-	restyClient *resty.Client // resty client 复用
+	transport   http.RoundTripper // 实际发送请求的 transport，过滤器包裹在它的外层
+	restyClient *resty.Client     // resty client 复用
 }
 
 // Setup 注册
@@ -41,28 +57,74 @@ func (o *openAPI) Version() openapi.APIVersion {
 	return openapi.APIv1
 }
 
-// TraceID 获取 lastTraceID id
+// TraceID 获取 lastTraceID id，获取指定请求的 trace id 请使用 openapi.WithTraceCollector
 func (o *openAPI) TraceID() string {
+	o.traceLock.RLock()
+	defer o.traceLock.RUnlock()
 	return o.lastTraceID
 }
 
 // Setup 生成一个实例
 func (o *openAPI) Setup(token *token.Token, inSandbox bool) openapi.OpenAPI {
+	return o.SetupWithOptions(token, inSandbox)
+}
+
+// SetupWithOptions 使用配置项生成一个实例
+func (o *openAPI) SetupWithOptions(token *token.Token, inSandbox bool, opts ...openapi.Option) openapi.OpenAPI {
+	options := openapi.NewOptions(opts...)
 	api := &openAPI{
-		token:   token,
-		timeout: 3 * time.Second,
-		sandbox: inSandbox,
+		token:    token,
+		timeout:  3 * time.Second,
+		endpoint: defaultEndpoint(inSandbox).URL(),
+		logger:   log.DefaultLogger,
+	}
+	if options.Endpoint != nil {
+		api.endpoint = options.Endpoint.URL()
+	}
+	if options.Logger != nil {
+		api.logger = options.Logger
 	}
 	api.setupClient() // 初始化可复用的 client
 	return api
 }
 
+// WithBaseURL 设置请求地址前缀，url 无法解析时 panic
+func (o *openAPI) WithBaseURL(baseURL string) openapi.OpenAPI {
+	endpoint, err := openapi.ParseEndpoint(baseURL)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: invalid base url %q: %v", baseURL, err))
+	}
+	o.endpoint = endpoint.URL()
+	return o
+}
+
 // WithTimeout 设置请求接口超时时间
 func (o *openAPI) WithTimeout(duration time.Duration) openapi.OpenAPI {
 	o.restyClient.SetTimeout(duration)
 	return o
 }
 
+// WithRetry 设置请求重试策略
+func (o *openAPI) WithRetry(policy openapi.RetryPolicy) openapi.OpenAPI {
+	o.retryPolicy = policy
+	o.setupRetry()
+	return o
+}
+
+// WithRateLimit 开启客户端限频
+func (o *openAPI) WithRateLimit(policy openapi.RateLimitPolicy) openapi.OpenAPI {
+	o.limiter = newRateLimiter(policy)
+	return o
+}
+
+// WithFilters 为当前实例追加请求过滤器
+func (o *openAPI) WithFilters(filters ...openapi.RoundTripFilter) openapi.OpenAPI {
+	// 复制一份，避免与之前设置的 transport 共享底层数组
+	o.filters = append(o.filters[:len(o.filters):len(o.filters)], filters...)
+	o.restyClient.SetTransport(&openapi.FilterTransport{Base: o.transport, Filters: o.filters})
+	return o
+}
+
 // Transport 透传请求
 func (o *openAPI) Transport(ctx context.Context, method, url string, body interface{}) ([]byte, error) {
 	resp, err := o.request(ctx).SetBody(body).Execute(method, url)
@@ -71,16 +133,32 @@ func (o *openAPI) Transport(ctx context.Context, method, url string, body interf
 
 // 初始化 client
 func (o *openAPI) setupClient() {
+	o.transport = createTransport(nil, MaxIdleConns)
 	o.restyClient = resty.New().
-		SetTransport(createTransport(nil, MaxIdleConns)). // 自定义 transport
-		SetLogger(log.DefaultLogger).
+		SetTransport(o.transport). // 自定义 transport
+		SetLogger(o.logger).
 		SetDebug(o.debug).
 		SetTimeout(o.timeout).
 		SetAuthToken(o.token.GetString()).
 		SetAuthScheme(string(o.token.Type)).
 		SetHeader("User-Agent", version.String()).
+		OnBeforeRequest(
+			func(client *resty.Client, request *resty.Request) error {
+				// 限频需要用到未替换路径参数的路由模板，所以在 `OnBeforeRequest` 中记录下来
+				if o.limiter != nil {
+					o.limiter.saveRoute(request, o.endpoint)
+				}
+				deferResult(request)
+				return nil
+			},
+		).
 		SetPreRequestHook(
 			func(client *resty.Client, request *http.Request) error {
+				if o.limiter != nil {
+					if err := o.limiter.wait(request); err != nil {
+						return err
+					}
+				}
 				// 执行请求前过滤器
 				// 由于在 `OnBeforeRequest` 的时候，request 还没生成，所以 filter 不能使用，所以放到 `PreRequestHook`
 				return openapi.DoReqFilterChains(request, nil)
@@ -89,22 +167,75 @@ func (o *openAPI) setupClient() {
 		// 设置请求之后的钩子，打印日志，判断状态码
 		OnAfterResponse(
 			func(client *resty.Client, resp *resty.Response) error {
-				log.Infof("%v", respInfo(resp))
+				o.logger.Infof("%v", respInfo(resp))
+				traceID := o.saveTraceID(resp)
+				if o.limiter != nil {
+					o.limiter.afterResponse(resp)
+				}
 				// 执行请求后过滤器
 				if err := openapi.DoRespFilterChains(resp.Request.RawRequest, resp.RawResponse); err != nil {
-					return err
+					return errs.New(errs.CodeFilterFailed, err.Error(), traceID)
 				}
-				traceID := resp.Header().Get(openapi.TraceIDKey)
-				o.lastTraceID = traceID
 				// 非成功含义的状态码，需要返回 error 供调用方识别
 				if !openapi.IsSuccessStatus(resp.StatusCode()) {
 					return errs.New(resp.StatusCode(), string(resp.Body()), traceID)
 				}
-				return nil
+				return parseResult(resp)
+			},
+		).
+		OnError(
+			func(request *resty.Request, err error) {
+				// 读取回包失败的时候不会执行 `OnAfterResponse`，这里补充记录 trace id
+				if e, ok := err.(*resty.ResponseError); ok {
+					o.saveTraceID(e.Response)
+				}
 			},
 		)
 }
 
+// saveTraceID 记录回包中的 trace id，同时写入请求 ctx 中的 trace id 收集器
+func (o *openAPI) saveTraceID(resp *resty.Response) string {
+	traceID := resp.Header().Get(openapi.TraceIDKey)
+	openapi.SaveTraceID(resp.Request.Context(), traceID)
+	o.traceLock.Lock()
+	o.lastTraceID = traceID
+	o.traceLock.Unlock()
+	return traceID
+}
+
+// unmarshal 解析回包，解析失败时返回带有本次请求 trace id 的错误
+func unmarshal(resp *resty.Response, v interface{}) error {
+	if err := json.Unmarshal(resp.Body(), v); err != nil {
+		return errs.New(errs.CodeParseRespFailed, err.Error(), resp.Header().Get(openapi.TraceIDKey))
+	}
+	return nil
+}
+
+type resultKey struct{}
+
+// deferResult 取出请求的 Result，改为在 `OnAfterResponse` 中由 parseResult 解析
+// resty 在执行 `OnAfterResponse` 之前解析 Result，解析失败时返回的错误不带 trace id
+func deferResult(request *resty.Request) {
+	if request.Result == nil {
+		return
+	}
+	request.SetContext(context.WithValue(request.Context(), resultKey{}, request.Result))
+	request.Result = nil
+}
+
+// parseResult 解析成功的 json 回包到请求的 Result 中，与 resty 一样跳过其他类型的回包
+func parseResult(resp *resty.Response) error {
+	result := resp.Request.Context().Value(resultKey{})
+	if result == nil {
+		return nil
+	}
+	resp.Request.Result = result
+	if resp.StatusCode() == http.StatusNoContent || !resty.IsJSONType(resp.Header().Get("Content-Type")) {
+		return nil
+	}
+	return unmarshal(resp, result)
+}
+
 // request 每个请求，都需要创建一个 request
 func (o *openAPI) request(ctx context.Context) *resty.Request {
 	return o.restyClient.R().SetContext(ctx)
@@ -0,0 +1,250 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+// bucketIdleTimeout 令牌桶超过这个时间没有使用，并且不在服务端限频中时被清理，避免每个频道与 guild 的令牌桶一直保留
+const bucketIdleTimeout = 10 * time.Minute
+
+// majorParams 主要参数，相同路由下不同的主要参数使用不同的令牌桶，优先级按照顺序
+var majorParams = []string{"channel_id", "guild_id"}
+
+type routeKey struct{}
+
+// rateLimiter 客户端限频器，按照路由模板与主要参数分桶
+type rateLimiter struct {
+	policy      openapi.RateLimitPolicy
+	idleTimeout time.Duration
+	lock        sync.Mutex
+	buckets     map[string]*bucket
+	sweptAt     time.Time // 上一次清理空闲令牌桶的时间
+}
+
+func newRateLimiter(policy openapi.RateLimitPolicy) *rateLimiter {
+	return &rateLimiter{
+		policy:      policy,
+		idleTimeout: bucketIdleTimeout,
+		buckets:     map[string]*bucket{},
+		sweptAt:     time.Now(),
+	}
+}
+
+// bucket 令牌桶，同时记录服务端返回的限频状态
+type bucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	usedAt time.Time // 最近一次等待令牌的时间
+
+	// 服务端返回的限频状态，resetAt 之前最多还能发送 remaining 个请求
+	remaining int
+	resetAt   time.Time
+}
+
+func newBucket(limit openapi.RateLimit) *bucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		usedAt: time.Now(),
+	}
+}
+
+// saveRoute 在替换路径参数之前，将路由模板记录到请求的 ctx 中，路由模板不包含 endpoint 的路径前缀，与 RateLimitPolicy.Routes 的 key 一致
+// 重试时 resty 会再次执行 `OnBeforeRequest`，只在第一次记录，重试与第一次请求使用同一个令牌桶，不会绕过已经记录的限频状态
+func (l *rateLimiter) saveRoute(req *resty.Request, endpoint string) {
+	if _, ok := req.Context().Value(routeKey{}).(string); ok {
+		return
+	}
+	req.SetContext(context.WithValue(req.Context(), routeKey{}, routeTemplate(strings.TrimPrefix(req.URL, endpoint))))
+}
+
+// wait 请求发出之前，等待对应令牌桶中的令牌，如果在 ctx 超时之前无法获得令牌，则立即返回错误
+func (l *rateLimiter) wait(req *http.Request) error {
+	route, ok := req.Context().Value(routeKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return l.getBucket(bucketKey(route, req.URL.Path), route).wait(req.Context())
+}
+
+// afterResponse 根据返回的限频头更新令牌桶
+func (l *rateLimiter) afterResponse(resp *resty.Response) {
+	req := resp.Request.RawRequest
+	if req == nil {
+		return
+	}
+	route, ok := req.Context().Value(routeKey{}).(string)
+	if !ok {
+		return
+	}
+	l.lock.Lock()
+	b, ok := l.buckets[bucketKey(route, req.URL.Path)]
+	l.lock.Unlock()
+	if !ok {
+		return
+	}
+	b.update(resp.StatusCode(), resp.Header())
+}
+
+func (l *rateLimiter) getBucket(key, route string) *bucket {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now := time.Now(); now.Sub(l.sweptAt) >= l.idleTimeout {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(l.policy.Limit(route))
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// sweep 清理空闲的令牌桶，调用方需要持有 l.lock
+func (l *rateLimiter) sweep(now time.Time) {
+	l.sweptAt = now
+	for key, b := range l.buckets {
+		if b.idle(now, l.idleTimeout) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// idle 令牌桶超过 timeout 没有使用，并且服务端的限频已经重置
+func (b *bucket) idle(now time.Time, timeout time.Duration) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return now.Sub(b.usedAt) >= timeout && !now.Before(b.resetAt)
+}
+
+// wait 预留一个令牌，并等待到令牌可用
+func (b *bucket) wait(ctx context.Context) error {
+	b.lock.Lock()
+	now := time.Now()
+	b.usedAt = now
+	delay := b.delay(now)
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		b.lock.Unlock()
+		return errs.ErrRateLimited
+	}
+	b.reserve(now)
+	b.lock.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delay 计算获得下一个令牌需要等待的时间，取本地令牌桶与服务端限频状态中较长的一个
+func (b *bucket) delay(now time.Time) time.Duration {
+	var delay time.Duration
+	if b.rate > 0 {
+		tokens := b.tokensAt(now)
+		if tokens < 1 {
+			delay = time.Duration((1 - tokens) / b.rate * float64(time.Second))
+		}
+	}
+	if b.remaining <= 0 && now.Before(b.resetAt) {
+		if d := b.resetAt.Sub(now); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// reserve 消耗一个令牌，令牌数可以为负，表示已经被预留的令牌
+func (b *bucket) reserve(now time.Time) {
+	if b.rate > 0 {
+		b.tokens = b.tokensAt(now) - 1
+		b.last = now
+	}
+	if now.Before(b.resetAt) {
+		b.remaining--
+	}
+}
+
+func (b *bucket) tokensAt(now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*b.rate
+	if tokens > b.burst {
+		tokens = b.burst
+	}
+	return tokens
+}
+
+// update 根据服务端返回的限频头，更新服务端限频状态
+func (b *bucket) update(status int, header http.Header) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if remaining, err := strconv.Atoi(header.Get(openapi.RateLimitRemainingKey)); err == nil {
+		b.remaining = remaining
+		if resetAfter, err := strconv.ParseFloat(header.Get(openapi.RateLimitResetAfterKey), 64); err == nil {
+			b.resetAt = now.Add(time.Duration(resetAfter * float64(time.Second)))
+		}
+	}
+	if status != http.StatusTooManyRequests {
+		return
+	}
+	// 触发了服务端限频，在 Retry-After 之前不再发送请求
+	b.remaining = 0
+	if seconds, err := strconv.ParseFloat(header.Get(retryAfterHeader), 64); err == nil {
+		if resetAt := now.Add(time.Duration(seconds * float64(time.Second))); resetAt.After(b.resetAt) {
+			b.resetAt = resetAt
+		}
+	}
+}
+
+// routeTemplate 从未替换路径参数的 url 中获取路由模板
+func routeTemplate(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Path
+}
+
+// bucketKey 根据路由模板与实际的请求路径，计算令牌桶的 key，相同路由下不同的主要参数使用不同的令牌桶
+// 实际的请求路径可能带有 endpoint 的路径前缀，从末尾开始与路由模板对齐
+func bucketKey(route, path string) string {
+	routeParts := strings.Split(route, "/")
+	pathParts := strings.Split(path, "/")
+	if len(routeParts) > len(pathParts) {
+		return route
+	}
+	pathParts = pathParts[len(pathParts)-len(routeParts):]
+	for _, param := range majorParams {
+		for i, part := range routeParts {
+			if part == "{"+param+"}" {
+				return route + ":" + pathParts[i]
+			}
+		}
+	}
+	return route
+}
@@ -0,0 +1,170 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func TestBucket(t *testing.T) {
+	t.Run("local rate", func(t *testing.T) {
+		b := newBucket(openapi.RateLimit{Rate: 1, Burst: 1})
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := b.wait(ctx); err != errs.ErrRateLimited {
+			t.Errorf("wait() error = %v, want %v", err, errs.ErrRateLimited)
+		}
+	})
+	t.Run("server headers", func(t *testing.T) {
+		b := newBucket(openapi.RateLimit{})
+		header := http.Header{}
+		header.Set(openapi.RateLimitRemainingKey, "1")
+		header.Set(openapi.RateLimitResetAfterKey, "1.5")
+		b.update(http.StatusOK, header)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.wait(ctx); err != errs.ErrRateLimited {
+			t.Errorf("wait() error = %v, want %v", err, errs.ErrRateLimited)
+		}
+	})
+	t.Run("too many requests", func(t *testing.T) {
+		b := newBucket(openapi.RateLimit{})
+		header := http.Header{}
+		header.Set(retryAfterHeader, "0.05")
+		b.update(http.StatusTooManyRequests, header)
+		start := time.Now()
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("wait() elapsed = %v, want >= 50ms", elapsed)
+		}
+	})
+}
+
+func TestBucketKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		route string
+		path  string
+		want  string
+	}{
+		{"channel", string(messageURI), "/channels/1/messages/2", string(messageURI) + ":1"},
+		{"guild", string(guildMemberURI), "/guilds/3/members/4", string(guildMemberURI) + ":3"},
+		{"channel first", string(channelAnnouncesURI), "/channels/5/announces", channelAnnouncesURI + ":5"},
+		{"no major param", string(userMeURI), "/users/@me", string(userMeURI)},
+		{"path prefix", string(messageURI), "/qq/channels/1/messages/2", string(messageURI) + ":1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := routeTemplate(defaultEndpoint(false).URL() + tt.route)
+			if got := bucketKey(route, tt.path); got != tt.want {
+				t.Errorf("bucketKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	var lock sync.Mutex
+	var calls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls = append(calls, time.Now())
+		n := len(calls)
+		lock.Unlock()
+		if n == 1 {
+			w.Header().Set(openapi.RateLimitRemainingKey, "0")
+			w.Header().Set(openapi.RateLimitResetAfterKey, "0.2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	api := (&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI)
+	api.WithRetry(openapi.RetryPolicy{MaxAttempts: 2, WaitTime: time.Millisecond, MaxWaitTime: time.Millisecond})
+	api.WithRateLimit(openapi.RateLimitPolicy{})
+	_, err := api.request(context.Background()).
+		SetPathParam("channel_id", "1").
+		Get(server.URL + "/channels/{channel_id}/messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(calls))
+	}
+	// 重试使用同一个令牌桶，等待服务端限频重置
+	if gap := calls[1].Sub(calls[0]); gap < 150*time.Millisecond {
+		t.Errorf("retry sent after %v, want to wait for the rate limit reset", gap)
+	}
+	if len(api.limiter.buckets) != 1 {
+		t.Errorf("buckets = %d, want 1", len(api.limiter.buckets))
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := newRateLimiter(openapi.RateLimitPolicy{})
+	l.idleTimeout = 50 * time.Millisecond
+	limited := l.getBucket("limited", "/limited")
+	header := http.Header{}
+	header.Set(retryAfterHeader, "10")
+	limited.update(http.StatusTooManyRequests, header)
+	l.getBucket("idle", "/idle")
+	time.Sleep(60 * time.Millisecond)
+	l.getBucket("new", "/new")
+	// 空闲的令牌桶被清理，服务端限频中的令牌桶保留
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket should be swept")
+	}
+	if _, ok := l.buckets["limited"]; !ok {
+		t.Error("rate limited bucket should be kept")
+	}
+}
+
+func TestRateLimitRouteWithPathPrefix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	route := string(messagesURI)
+	api := (&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI)
+	api.WithBaseURL(server.URL + "/qq")
+	api.WithRateLimit(openapi.RateLimitPolicy{
+		Routes: map[string]openapi.RateLimit{route: {Rate: 1, Burst: 1}},
+	})
+	send := func(ctx context.Context) error {
+		_, err := api.request(ctx).SetPathParam("channel_id", "1").Get(api.getURL(messagesURI))
+		return err
+	}
+	if err := send(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 路由模板不包含路径前缀，命中 Routes 中配置的限频
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := send(ctx); !errors.Is(err, errs.ErrRateLimited) {
+		t.Errorf("send() error = %v, want %v", err, errs.ErrRateLimited)
+	}
+	if _, ok := api.limiter.buckets[route+":1"]; !ok {
+		t.Errorf("buckets = %v, want key %v", api.limiter.buckets, route+":1")
+	}
+}
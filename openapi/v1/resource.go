@@ -1,13 +1,11 @@
 package v1
 
 import (
-	"fmt"
+	"github.com/tencent-connect/botgo/openapi"
 )
 
-const domain = "api.sgroup.qq.com"
-const sandBoxDomain = "sandbox.api.sgroup.qq.com"
-
-const scheme = "https"
+// fileImageField multipart/form-data 发消息时，上传图片的字段名
+const fileImageField = "file_image"
 
 type uri string
 
@@ -58,11 +56,17 @@ const (
 	apiPermissionDemandURI uri = "/guilds/{guild_id}/api_permission/demand"
 )
 
-// getURL 获取接口地址，会处理沙箱环境判断
-func (o *openAPI) getURL(endpoint uri) string {
-	d := domain
-	if o.sandbox {
-		d = sandBoxDomain
+// defaultEndpoint 未指定请求地址时，根据是否沙箱环境选择内置的环境
+func defaultEndpoint(inSandbox bool) openapi.Endpoint {
+	profile := openapi.ProfileProduction
+	if inSandbox {
+		profile = openapi.ProfileSandbox
 	}
-	return fmt.Sprintf("%s://%s%s", scheme, d, endpoint)
+	endpoint, _ := openapi.ProfileEndpoint(profile)
+	return endpoint
+}
+
+// getURL 获取接口地址
+func (o *openAPI) getURL(endpoint uri) string {
+	return o.endpoint + string(endpoint)
 }
@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tencent-connect/botgo/openapi"
+)
+
+const retryAfterHeader = "Retry-After"
+
+// setupRetry 根据重试策略配置 resty client，重试的等待逻辑由 resty 的 backoff 实现
+func (o *openAPI) setupRetry() {
+	policy := o.retryPolicy
+	if policy.MaxAttempts <= 1 {
+		o.restyClient.SetRetryCount(0)
+		return
+	}
+	// resty 的退避算法要求等待时间必须大于 0
+	if policy.WaitTime <= 0 {
+		policy.WaitTime = openapi.DefaultRetryPolicy.WaitTime
+	}
+	if policy.MaxWaitTime < policy.WaitTime {
+		policy.MaxWaitTime = policy.WaitTime
+	}
+	o.restyClient.
+		SetRetryCount(policy.MaxAttempts - 1).
+		SetRetryWaitTime(policy.WaitTime).
+		SetRetryMaxWaitTime(policy.MaxWaitTime).
+		SetRetryAfter(retryAfter)
+	// 只注册一次，重试条件本身不依赖策略中的参数
+	if len(o.restyClient.RetryConditions) == 0 {
+		o.restyClient.AddRetryCondition(retryCondition)
+	}
+}
+
+// retryCondition 判断请求是否需要重试，只有允许重试的请求，在发生网络错误，频率限制或者服务端错误时才会重试
+func retryCondition(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	if !openapi.IsRetryable(resp.Request.Context(), resp.Request.Method) {
+		return false
+	}
+	// multipart 上传的文件内容从 io.Reader 中读取，发送过一次之后无法再次读取
+	if resp.Request.RawRequest != nil &&
+		strings.HasPrefix(resp.Request.RawRequest.Header.Get("Content-Type"), "multipart/") {
+		return false
+	}
+	// 没有收到回包，说明是网络错误，比如超时
+	if resp.RawResponse == nil {
+		return err != nil
+	}
+	return openapi.IsRetryableStatus(resp.StatusCode())
+}
+
+// retryAfter 解析回包中的 Retry-After 头，返回 0 时 resty 会使用默认的指数退避
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	value := resp.Header().Get(retryAfterHeader)
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if t, err := http.ParseTime(value); err == nil && time.Until(t) > 0 {
+		return time.Until(t), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	statusSeq := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(retryAfterHeader, "0")
+		w.WriteHeader(statusSeq[(int(n)-1)%len(statusSeq)])
+	}))
+	defer server.Close()
+
+	api := (&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI).
+		WithRetry(openapi.RetryPolicy{MaxAttempts: 3, WaitTime: time.Millisecond, MaxWaitTime: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		method    string
+		path      string
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"get retried until success", ctx, http.MethodGet, "/", 3, false},
+		{"post not retried by default", ctx, http.MethodPost, "/", 1, true},
+		{"post retried when marked", openapi.WithRetryable(ctx), http.MethodPost, "/", 3, false},
+		{"client error not retried", ctx, http.MethodGet, "/bad", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			_, err := api.Transport(tt.ctx, tt.method, server.URL+tt.path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Transport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "3", 3 * time.Second},
+		{"invalid", "abc", 0},
+		{"past date", "Mon, 02 Jan 2006 15:04:05 GMT", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(retryAfterHeader, tt.value)
+			resp := &resty.Response{RawResponse: &http.Response{Header: header}}
+			if got, _ := retryAfter(nil, resp); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
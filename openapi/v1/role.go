@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/tencent-connect/botgo/dto"
-	"github.com/tencent-connect/botgo/log"
 )
 
 func (o *openAPI) Roles(ctx context.Context, guildID string) (*dto.GuildRoles, error) {
@@ -34,7 +33,7 @@ func (o *openAPI) PostRole(ctx context.Context, guildID string, role *dto.Role)
 		Filter:  filter,
 		Update:  role,
 	}
-	log.Debug(body)
+	o.logger.Debug(body)
 	resp, err := o.request(ctx).
 		SetPathParam("guild_id", guildID).
 		SetResult(dto.UpdateResult{}).
@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/openapi"
+	"github.com/tencent-connect/botgo/token"
+)
+
+func TestTraceCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(openapi.TraceIDKey, r.URL.Query().Get("trace"))
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	api := (&openAPI{}).Setup(token.BotToken(1, "token"), false).(*openAPI)
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				want := fmt.Sprintf("trace-%d", i)
+				ctx := openapi.WithTraceCollector(context.Background())
+				if _, err := api.Transport(ctx, http.MethodGet, server.URL+"?trace="+want, nil); err != nil {
+					t.Error(err)
+				}
+				if got := openapi.TraceIDFromContext(ctx); got != want {
+					t.Errorf("TraceIDFromContext() = %v, want %v", got, want)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+	t.Run("error carries trace id", func(t *testing.T) {
+		_, err := api.Transport(context.Background(), http.MethodGet, server.URL+"?fail=1&trace=bad", nil)
+		if got := errs.Error(err).Trace(); got != "bad" {
+			t.Errorf("Trace() = %v, want %v", got, "bad")
+		}
+	})
+	t.Run("parse failure carries trace id", func(t *testing.T) {
+		broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(openapi.TraceIDKey, "broken")
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"id":`))
+		}))
+		defer broken.Close()
+		ctx := openapi.WithTraceCollector(context.Background())
+		brokenAPI := api.WithBaseURL(broken.URL)
+		_, err := brokenAPI.Me(ctx)
+		if e := errs.Error(err); e.Code() != errs.CodeParseRespFailed || e.Trace() != "broken" {
+			t.Errorf("Me() = %v, want parse error with trace id", err)
+		}
+		if got := openapi.TraceIDFromContext(ctx); got != "broken" {
+			t.Errorf("TraceIDFromContext() = %v, want %v", got, "broken")
+		}
+		if got := brokenAPI.TraceID(); got != "broken" {
+			t.Errorf("TraceID() = %v, want %v", got, "broken")
+		}
+	})
+	t.Run("read failure records trace id", func(t *testing.T) {
+		// 回包的长度与 Content-Length 不一致，读取回包失败，只会执行 `OnError`
+		truncated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\n" + openapi.TraceIDKey + ": truncated\r\n" +
+				"Content-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"id\":")
+			_ = buf.Flush()
+		}))
+		defer truncated.Close()
+		ctx := openapi.WithTraceCollector(context.Background())
+		truncatedAPI := api.WithBaseURL(truncated.URL)
+		if _, err := truncatedAPI.Me(ctx); err == nil {
+			t.Fatal("Me() error = nil, want read error")
+		}
+		if got := openapi.TraceIDFromContext(ctx); got != "truncated" {
+			t.Errorf("TraceIDFromContext() = %v, want %v", got, "truncated")
+		}
+		if got := truncatedAPI.TraceID(); got != "truncated" {
+			t.Errorf("TraceID() = %v, want %v", got, "truncated")
+		}
+	})
+}
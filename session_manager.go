@@ -5,6 +5,7 @@ import (
 
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/sessions/local"
+	"github.com/tencent-connect/botgo/sessions/manager"
 	"github.com/tencent-connect/botgo/token"
 )
 
@@ -15,7 +16,27 @@ var defaultSessionManager SessionManager = local.New()
 // SessionManager 接口，管理session
 type SessionManager interface {
 	// Start 启动连接，默认使用 apInfo 中的 shards 作为 shard 数量，如果有需要自己指定 shard 数，请修 apInfo 中的信息
+	// 内置的实现在机器人不能再 identify 时返回 manager.FatalError，而不是 panic
 	Start(ctx context.Context, apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error
 	// Stop 停止连接
 	Stop()
 }
+
+// GracefulSessionManager 支持优雅关闭的 session manager，内置的 local 与 remote 实现都支持
+type GracefulSessionManager interface {
+	SessionManager
+	// Shutdown 停止读取新的事件，在 ctx 结束前等待已经读取的事件处理完成，并保存 session 用于后续 resume
+	Shutdown(ctx context.Context) error
+}
+
+// ReshardableSessionManager 支持在运行中调整 shard 数量的 session manager，内置的 local 与 remote 实现都支持
+type ReshardableSessionManager interface {
+	SessionManager
+	manager.Resharder
+}
+
+var (
+	_ GracefulSessionManager    = (*local.ChanManager)(nil)
+	_ ReshardableSessionManager = (*local.ChanManager)(nil)
+	_ manager.StatusProvider    = (*local.ChanManager)(nil)
+)
@@ -4,9 +4,11 @@ package local
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
 	"github.com/tencent-connect/botgo/log"
 	"github.com/tencent-connect/botgo/sessions/manager"
 	"github.com/tencent-connect/botgo/token"
@@ -14,66 +16,297 @@ import (
 )
 
 // New 创建本地session管理器
-func New() *ChanManager {
-	return &ChanManager{}
+func New(opts ...Option) *ChanManager {
+	l := &ChanManager{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.limiter == nil {
+		l.limiter = manager.NewMemoryLimiter()
+	}
+	if l.backoff == nil {
+		l.backoff = manager.NewBackoff(manager.DefaultBackoffPolicy)
+	}
+	if l.overlap == nil {
+		l.overlap = manager.NewOverlapFilter(manager.DefaultOverlapWindow)
+	}
+	return l
 }
 
 // ChanManager 默认的本地 session manager 实现
 type ChanManager struct {
+	sessionChan chan dto.Session
+	ws          websocket.WebSocket    // 为空时使用全局注册的 websocket.ClientImpl
+	logger      log.Logger             // 为空时使用全局的 log.DefaultLogger
+	store       manager.SessionStore   // 为空时不保存 session
+	limiter     manager.SessionLimiter // session 启动次数限制，进程内的重连共享
+	backoff     *manager.Backoff       // 按照 shard 计算重连的等待时间
+	onFatal     manager.FatalHandler   // 遇到不能 identify 的错误时的处理方式，为空时停止 manager
+	status      manager.StatusTracker  // shard 的连接状态
+	overlap     *manager.OverlapFilter // 重新分片期间过滤新旧两组 shard 重复收到的事件
+
+	lock        sync.Mutex
 	isStop      bool
 	stop        chan struct{}
-	sessionChan chan dto.Session
+	clients     map[dto.ShardConfig]websocket.WebSocket // 正在监听的连接
+	err         error                                   // 导致 manager 停止的错误，由 Start 返回
+	url         string                                  // 用于重新分片时创建 session
+	token       token.Token
+	handlers    *dto.EventParse // 连接使用的 handler，复制自 Start 传入的 handler，添加了重复事件的过滤
+	shardCount  uint32          // 当前的 shard 数量
+	shardCounts map[uint32]bool // 正在运行的 shard 数量，重新分片期间新旧两组 shard 同时运行
+	resharding  bool
 }
 
-// Start 启动本地 session manager
+// wsImpl 返回用于创建连接的 websocket 实现
+func (l *ChanManager) wsImpl() websocket.WebSocket {
+	if l.ws != nil {
+		return l.ws
+	}
+	return websocket.ClientImpl
+}
+
+// log 返回 manager 使用的 logger
+func (l *ChanManager) log() log.Logger {
+	if l.logger != nil {
+		return l.logger
+	}
+	return log.DefaultLogger
+}
+
+// Start 启动本地 session manager，遇到不能 identify 的错误并且没有通过 WithFatalHandler 选择重试时，返回 manager.FatalError
 func (l *ChanManager) Start(ctx context.Context, apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error {
-	defer log.Sync()
+	defer func() {
+		_ = l.log().Sync()
+	}()
+	if err := l.limiter.Update(ctx, apInfo.SessionStartLimit); err != nil {
+		l.log().Errorf("[ws/session/local] update session limit failed, err: %v", err)
+	}
+	// 次数不足时不退出，连接在 identify 之前会等待次数重置
 	if err := manager.CheckSessionLimit(apInfo); err != nil {
-		log.Errorf("[ws/session/local] session limited apInfo: %+v", apInfo)
-		return err
+		wait := manager.ResetAfter(apInfo.SessionStartLimit)
+		l.log().Warnf("[ws/session/local] session limited apInfo: %+v, will wait %s for reset", apInfo, wait)
+		handlers.NotifyError(manager.SessionLimitError(wait))
 	}
 	startInterval := manager.CalcInterval(apInfo.SessionStartLimit.MaxConcurrency)
-	log.Infof("[ws/session/local] will start %d sessions and per session start interval is %s",
+	l.log().Infof("[ws/session/local] will start %d sessions and per session start interval is %s",
 		apInfo.Shards, startInterval)
 
 	// 按照shards数量初始化，用于启动连接的管理
+	l.lock.Lock()
 	l.sessionChan = make(chan dto.Session, apInfo.Shards)
 	l.stop = make(chan struct{})
 	l.isStop = false
+	l.err = nil
+	l.clients = map[dto.ShardConfig]websocket.WebSocket{}
+	l.url = apInfo.URL
+	l.token = *token
+	l.handlers = handlers.Clone().Filter(l.overlap.Accept)
+	l.shardCount = apInfo.Shards
+	l.shardCounts = map[uint32]bool{apInfo.Shards: true}
+	stop := l.stop
+	l.lock.Unlock()
+	l.status.Reset()
 	for i := uint32(0); i < apInfo.Shards; i++ {
-		session := dto.Session{
-			URL:      apInfo.URL,
-			Token:    *token,
-			Handlers: handlers,
-			LastSeq:  0,
-			Shards: dto.ShardConfig{
-				ShardID:    i,
-				ShardCount: apInfo.Shards,
-			},
-		}
+		l.status.Add(i, apInfo.Shards)
+		session := l.newSession(i, apInfo.Shards)
+		l.restore(ctx, &session)
 		l.sessionChan <- session
 	}
 
 	for {
 		select {
 		case session := <-l.sessionChan:
+			if l.retired(session.Shards) {
+				// 重新分片后已经下线的 shard 不再重连
+				l.log().Infof("[ws/session/local] %s is retired", &session)
+				continue
+			}
 			time.Sleep(startInterval)
 			go l.newConnect(ctx, session)
-		case <-ctx.Done():
-			if !l.isStop {
-				close(l.stop)
-				l.isStop = true
+		case <-stop:
+			err := l.stopErr()
+			if err != nil {
+				// 因为错误停止时调用方不一定会结束 ctx，关闭其他 shard 的连接
+				l.closeAll(ctx)
 			}
+			return err
+		case <-ctx.Done():
+			l.Stop()
 			return nil
 		}
 	}
-	return nil
 }
 
+// Stop 停止启动新的连接，已有的连接会在 Start 的 ctx 结束时关闭，需要等待事件处理完成请使用 Shutdown
 func (l *ChanManager) Stop() {
-	if !l.isStop {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.isStop && l.stop != nil {
 		close(l.stop)
+		l.isStop = true
+	}
+}
+
+// Status 返回 manager 当前的状态快照
+func (l *ChanManager) Status() manager.Status {
+	l.lock.Lock()
+	status := manager.Status{Running: l.stop != nil && !l.isStop}
+	if l.err != nil {
+		status.Error = l.err.Error()
+	}
+	l.lock.Unlock()
+	status.Shards = l.status.Shards()
+	return status
+}
+
+// fail 记录导致停止的错误并停止 manager，Start 返回该错误
+func (l *ChanManager) fail(err error) {
+	l.lock.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.lock.Unlock()
+	l.Stop()
+}
+
+// stopErr 返回导致 manager 停止的错误，调用 Stop 或者 Shutdown 停止时为空
+func (l *ChanManager) stopErr() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.err
+}
+
+// Shutdown 优雅关闭，停止读取新的事件，在 ctx 结束前等待已经读取的事件处理完成，然后保存 session 用于下次启动时 resume
+// 连接使用的 websocket 实现需要实现 websocket.Drainer，否则直接关闭连接
+func (l *ChanManager) Shutdown(ctx context.Context) error {
+	l.Stop()
+	l.lock.Lock()
+	clients := make([]websocket.WebSocket, 0, len(l.clients))
+	for _, c := range l.clients {
+		clients = append(clients, c)
+	}
+	// 连接交由 Shutdown 处理
+	l.clients = map[dto.ShardConfig]websocket.WebSocket{}
+	l.lock.Unlock()
+
+	err := drainAll(ctx, clients)
+	for _, c := range clients {
+		l.save(ctx, manager.Checkpoint(c))
+	}
+	return err
+}
+
+// closeAll 等待其他连接已经读取的事件处理完成后关闭连接，最多等待 manager.FatalDrainTimeout
+func (l *ChanManager) closeAll(ctx context.Context) {
+	drainCtx, cancel := context.WithTimeout(ctx, manager.FatalDrainTimeout)
+	defer cancel()
+	if err := l.Shutdown(drainCtx); err != nil {
+		l.log().Errorf("[ws/session/local] drain sessions failed, err: %v", err)
+	}
+}
+
+// waitIdentify 获取 identify 次数，次数不足时记录日志并通知使用方，等待重置
+func (l *ChanManager) waitIdentify(ctx context.Context, session dto.Session) error {
+	l.lock.Lock()
+	stop := l.stop
+	l.lock.Unlock()
+	return manager.WaitIdentify(ctx, l.limiter, stop, func(wait time.Duration) {
+		l.log().Warnf("[ws/session/local] %s session start limit reached, wait %s for reset", &session, wait)
+		session.Handlers.NotifyError(manager.SessionLimitError(wait))
+	})
+}
+
+// retry 按照 shard 的退避时间等待后将 session 放回队列重连，等待期间 manager 停止时保存 session
+func (l *ChanManager) retry(ctx context.Context, session dto.Session, reason error) {
+	delay := l.backoff.Next(session.Shards.ShardID)
+	l.log().Warnf("[ws/session/local] %s will reconnect after %s, reason: %v", &session, delay, reason)
+	l.lock.Lock()
+	stop := l.stop
+	l.lock.Unlock()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+		l.save(ctx, session)
+		return
+	case <-ctx.Done():
+		return
+	}
+	// Start 退出后没有协程读取 sessionChan，不能阻塞
+	select {
+	case l.sessionChan <- session:
+	case <-stop:
+		l.save(ctx, session)
+	case <-ctx.Done():
+	}
+}
+
+// restore 从 store 中恢复 session 状态
+func (l *ChanManager) restore(ctx context.Context, session *dto.Session) {
+	if l.store == nil {
+		return
+	}
+	state, err := l.store.Load(ctx, session.Shards)
+	if err != nil {
+		l.log().Errorf("[ws/session/local] load session failed, err: %v", err)
+		return
+	}
+	if state.Apply(session) {
+		l.log().Infof("[ws/session/local] restore session %s, seq %d", session.ID, session.LastSeq)
+	}
+}
+
+// save 保存 session 状态到 store
+func (l *ChanManager) save(ctx context.Context, session dto.Session) {
+	if l.store == nil {
+		return
+	}
+	if err := l.store.Save(ctx, manager.StateOf(session)); err != nil {
+		l.log().Errorf("[ws/session/local] save session failed, err: %v", err)
+	}
+}
+
+// newSession 创建还没有连接的 session
+func (l *ChanManager) newSession(shardID, shardCount uint32) dto.Session {
+	return dto.Session{
+		URL:      l.url,
+		Token:    l.token,
+		Handlers: l.handlers,
+		LastSeq:  0,
+		Shards: dto.ShardConfig{
+			ShardID:    shardID,
+			ShardCount: shardCount,
+		},
+	}
+}
+
+// track 记录正在监听的连接，manager 已经停止时返回 false
+func (l *ChanManager) track(wsClient websocket.WebSocket) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.isStop {
+		return false
 	}
+	shards := wsClient.Session().Shards
+	if !l.shardCounts[shards.ShardCount] {
+		return false
+	}
+	l.clients[shards] = wsClient
+	return true
+}
+
+// untrack 移除连接，返回连接是否已经交由 Shutdown 处理，以及 manager 是否已经停止
+func (l *ChanManager) untrack(wsClient websocket.WebSocket) (owned bool, stopped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	shards := wsClient.Session().Shards
+	if l.clients[shards] != wsClient {
+		return true, l.isStop
+	}
+	delete(l.clients, shards)
+	return false, l.isStop
 }
 
 // newConnect 启动一个新的连接，如果连接在监听过程中报错了，或者被远端关闭了链接，需要识别关闭的原因，能否继续 resume
@@ -84,14 +317,26 @@ func (l *ChanManager) newConnect(ctx context.Context, session dto.Session) {
 	defer func() {
 		// panic 留下日志，放回 session
 		if err := recover(); err != nil {
-			websocket.PanicHandler(err, &session)
-			l.sessionChan <- session
+			websocket.LogPanic(l.log(), err, &session)
+			l.retry(ctx, session, fmt.Errorf("panic: %v", err))
 		}
 	}()
-	wsClient := websocket.ClientImpl.New(session)
+	// identify 需要消耗启动次数，次数不足时在建立连接之前等待重置
+	if session.ID == "" {
+		if err := l.waitIdentify(ctx, session); err != nil {
+			if err == manager.ErrManagerStopped || ctx.Err() != nil {
+				return
+			}
+			l.log().Errorf("[ws/session/local] wait session limit failed, err: %v", err)
+		}
+	}
+	wsClient := l.wsImpl().New(session)
 	if err := wsClient.Connect(); err != nil {
-		log.Error(err)
-		l.sessionChan <- session // 连接失败，丢回去队列排队重连
+		// 连接失败，退避后丢回去队列排队重连
+		l.log().Error(err)
+		l.status.Failed(session.Shards.ShardID, session.Shards.ShardCount, err)
+		session.Handlers.NotifyError(errs.New(errs.CodeConnectFailed, fmt.Sprintf("connect failed: %v", err)))
+		l.retry(ctx, session, err)
 		return
 	}
 	var err error
@@ -103,7 +348,20 @@ func (l *ChanManager) newConnect(ctx context.Context, session dto.Session) {
 		err = wsClient.Identify()
 	}
 	if err != nil {
-		log.Errorf("[ws/session] Identify/Resume err %+v", err)
+		// 鉴权没有发送成功，session 没有变化，退避后重新连接
+		l.log().Errorf("[ws/session] Identify/Resume err %+v", err)
+		wsClient.Close()
+		l.status.Failed(session.Shards.ShardID, session.Shards.ShardCount, err)
+		session.Handlers.NotifyError(errs.New(errs.CodeConnectFailed, fmt.Sprintf("identify/resume failed: %v", err)))
+		l.retry(ctx, session, err)
+		return
+	}
+	if !l.track(wsClient) {
+		// 鉴权期间 manager 已经停止，保留 session 用于下次启动时 resume，重新分片后已经下线的 shard 不需要保留
+		wsClient.Close()
+		if !l.retired(session.Shards) {
+			l.save(ctx, session)
+		}
 		return
 	}
 	end := make(chan struct{})
@@ -117,22 +375,59 @@ func (l *ChanManager) newConnect(ctx context.Context, session dto.Session) {
 		case <-end:
 		}
 	}()
-	if err := wsClient.Listening(); err != nil {
-		log.Errorf("[ws/session] Listening err %+v", err)
-		currentSession := wsClient.Session()
-		// 对于不能够进行重连的session，需要清空 session id 与 seq
-		if manager.CanNotResume(err) {
-			currentSession.ID = ""
-			currentSession.LastSeq = 0
+	l.status.Connected(wsClient)
+	connectedAt := time.Now()
+	err = wsClient.Listening()
+	l.status.Disconnected(wsClient, err)
+	// 连接保持足够长的时间，之前的失败不再影响重连的等待时间
+	l.backoff.Healthy(session.Shards.ShardID, time.Since(connectedAt))
+	// manager 已经停止，不再重连，保存 session，Shutdown 处理的连接由 Shutdown 保存
+	if owned, stopped := l.untrack(wsClient); owned {
+		return
+	} else if stopped {
+		l.save(ctx, manager.Checkpoint(wsClient))
+		return
+	}
+	if err == nil {
+		// websocket 实现没有返回错误就退出了监听，按照需要重连处理，避免丢失 shard
+		err = errs.ErrNeedReConnect
+	}
+	l.log().Errorf("[ws/session] Listening err %+v", err)
+	// 使用副本，连接的协程可能还在读取 session
+	currentSession := manager.Checkpoint(wsClient)
+	// 对于不能够进行重连的session，需要清空 session id 与 seq
+	if manager.CanNotResume(err) {
+		currentSession.ID = ""
+		currentSession.LastSeq = 0
+	}
+	// 一些错误不能够鉴权，比如机器人被下架或者封禁，默认停止 manager，由 Start 返回错误
+	if manager.CanNotIdentify(err) {
+		fatal := &manager.FatalError{Session: currentSession, Err: err}
+		l.log().Errorf("[ws/session/local] %v", fatal)
+		if manager.HandleFatal(l.onFatal, fatal) == manager.FatalStop {
+			l.fail(fatal)
+			return
 		}
-		// 一些错误不能够鉴权，比如机器人被封禁，这里就直接退出了
-		if manager.CanNotIdentify(err) {
-			msg := fmt.Sprintf("can not identify because server return %+v, so process exit", err)
-			log.Errorf(msg)
-			panic(msg) // 当机器人被下架，或者封禁，将不能再连接，所以 panic
+		currentSession.ID = ""
+		currentSession.LastSeq = 0
+	}
+	// 退避后将 session 放到 session chan 中，用于启动新的连接，当前连接退出
+	l.retry(ctx, currentSession, err)
+}
+
+// drainAll 等待所有连接已经读取的事件处理完成，返回第一个错误
+func drainAll(ctx context.Context, clients []websocket.WebSocket) error {
+	drainErrs := make(chan error, len(clients))
+	for _, c := range clients {
+		go func(c websocket.WebSocket) {
+			drainErrs <- manager.Drain(ctx, c)
+		}(c)
+	}
+	var err error
+	for range clients {
+		if e := <-drainErrs; e != nil && err == nil {
+			err = e
 		}
-		// 将 session 放到 session chan 中，用于启动新的连接，当前连接退出
-		l.sessionChan <- *currentSession
-		return
 	}
+	return err
 }
@@ -0,0 +1,500 @@
+package local_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/sessions/local"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/client"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+const testTimeout = 10 * time.Second
+
+func init() {
+	client.Setup()
+}
+
+func atMessages() (*dto.EventParse, chan string) {
+	contents := make(chan string, 10)
+	handlers := dto.NewEventParse().AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+		contents <- data.Content
+		return nil
+	})
+	return handlers, contents
+}
+
+func receive(t *testing.T, contents chan string, want string) {
+	select {
+	case got := <-contents:
+		if got != want {
+			t.Errorf("content = %v, want %v", got, want)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("timeout waiting for %v", want)
+	}
+}
+
+func TestChanManagerResume(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	handlers, contents := atMessages()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 1},
+	}
+	go func() {
+		_ = local.New().Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+	}()
+
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "a")
+	_ = conn.Reconnect()
+
+	resumed, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Resume() == nil || resumed.SessionID() != conn.SessionID() {
+		t.Fatalf("manager should resume session %s", conn.SessionID())
+	}
+	if _, err := resumed.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "b")
+}
+
+func TestChanManagerNilHandlers(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 1},
+	}
+	m := local.New()
+	defer m.Stop()
+	go func() {
+		_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), nil)
+	}()
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 handler 时使用默认的 intent
+	if got := conn.Identify().Intents; got != dto.IntentGuilds {
+		t.Errorf("identify intents = %v, want %v", got, dto.IntentGuilds)
+	}
+}
+
+func TestChanManagerShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		release bool // 关闭期间是否完成阻塞的事件
+		wantErr error
+		wantSeq uint32
+	}{
+		{"drained", true, nil, 4},
+		{"deadline exceeded", false, context.DeadlineExceeded, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := websockettest.NewServer()
+			defer s.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+			defer cancel()
+			store := manager.NewFileStore(t.TempDir() + "/sessions.json")
+			apInfo := &dto.WebsocketAP{
+				URL:               s.URL,
+				Shards:            1,
+				SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 1},
+			}
+			release := make(chan struct{})
+			contents := make(chan string, 10)
+			handlers := dto.NewEventParse().AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+				if data.Content == "slow" {
+					<-release
+				}
+				contents <- data.Content
+				return nil
+			})
+			m := local.New(local.WithSessionStore(store))
+			go func() {
+				_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+			}()
+			conn, err := s.NextConn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// READY 的 seq 为 1
+			for _, content := range []string{"a", "slow", "b"} {
+				if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: content}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			receive(t, contents, "a")
+
+			shutdownCtx, cancelShutdown := context.WithTimeout(ctx, 200*time.Millisecond)
+			defer cancelShutdown()
+			if tt.release {
+				close(release)
+			}
+			if err := m.Shutdown(shutdownCtx); err != tt.wantErr {
+				t.Errorf("Shutdown() = %v, want %v", err, tt.wantErr)
+			}
+			state, err := store.Load(ctx, dto.ShardConfig{ShardID: 0, ShardCount: 1})
+			if err != nil || state == nil {
+				t.Fatalf("Load() = %v, %v, want saved session", state, err)
+			}
+			if state.ID != conn.SessionID() || state.LastSeq != tt.wantSeq {
+				t.Errorf("saved session %s seq %d, want %s seq %d", state.ID, state.LastSeq, conn.SessionID(), tt.wantSeq)
+			}
+			if !tt.release {
+				// 超时之后旧连接上的事件仍然会处理完成，resume 之后会重复收到
+				close(release)
+			}
+			receive(t, contents, "slow")
+			receive(t, contents, "b")
+
+			// 新的 manager 使用保存的 session resume，并收到关闭期间的事件
+			<-conn.Done()
+			if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "missed"}); err == nil {
+				t.Error("Dispatch() on closed connection should fail")
+			}
+			go func() {
+				_ = local.New(local.WithSessionStore(store)).Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+			}()
+			resumed, err := s.NextConn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resumed.Resume() == nil || resumed.Resume().Seq != tt.wantSeq {
+				t.Fatalf("manager should resume from seq %d, got %+v", tt.wantSeq, resumed.Resume())
+			}
+			if !tt.release {
+				receive(t, contents, "slow")
+				receive(t, contents, "b")
+			}
+			receive(t, contents, "missed")
+		})
+	}
+}
+
+func TestChanManagerWaitsSessionLimitReset(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	notified := make(chan error, 10)
+	handlers := dto.NewEventParse().ErrorNotify(func(err error) {
+		notified <- err
+	})
+	// 启动间隔为 2s，重置时间需要更长才会在 identify 之前等待
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 0, ResetAfter: 3000, MaxConcurrency: 1},
+	}
+	started := make(chan error, 1)
+	go func() {
+		started <- local.New().Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+	}()
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Identify() == nil {
+		t.Fatal("manager should identify after the limit reset")
+	}
+	select {
+	case err := <-started:
+		t.Fatalf("Start() returned %v, want to wait for reset", err)
+	default:
+	}
+	// Start 与 identify 之前各通知一次
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-notified:
+			if errs.Error(err).Code() != errs.CodeSessionLimit {
+				t.Errorf("notified %v, want session limit error", err)
+			}
+		default:
+			t.Fatalf("got %d session limit notifications, want 2", i)
+		}
+	}
+}
+
+func TestChanManagerBackoff(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	// 连续两次握手失败，第二次重连的等待时间应该更长
+	s.RejectNextHandshake(websockettest.CloseSessionTimeout, "session timeout")
+	s.RejectNextHandshake(websockettest.CloseSessionTimeout, "session timeout")
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 3, Remaining: 3, MaxConcurrency: 2},
+	}
+	m := local.New(local.WithBackoff(manager.BackoffPolicy{
+		Initial:    500 * time.Millisecond,
+		Max:        time.Minute,
+		Multiplier: 4,
+		ResetAfter: time.Minute,
+	}))
+	go func() {
+		_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), dto.NewEventParse())
+	}()
+
+	var arrivals []time.Time
+	for i := 0; i < 3; i++ {
+		conn, err := s.NextConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arrivals = append(arrivals, time.Now())
+		if i < 2 && conn.Err() == nil {
+			t.Fatalf("conn %d should be rejected", i)
+		}
+		if i == 2 && conn.Err() != nil {
+			t.Fatalf("conn %d should be accepted, err: %v", i, conn.Err())
+		}
+	}
+	// 启动间隔为 1s，两次等待分别为 500ms 与 2s
+	first, second := arrivals[1].Sub(arrivals[0]), arrivals[2].Sub(arrivals[1])
+	if second-first < time.Second {
+		t.Errorf("reconnect intervals %s and %s, want the second longer by backoff", first, second)
+	}
+}
+
+func TestChanManagerFatal(t *testing.T) {
+	tests := []struct {
+		name   string
+		action manager.FatalAction
+		shards uint32
+	}{
+		{"stop", manager.FatalStop, 2},
+		{"retry", manager.FatalRetry, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := websockettest.NewServer()
+			defer s.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+			defer cancel()
+			apInfo := &dto.WebsocketAP{
+				URL:               s.URL,
+				Shards:            tt.shards,
+				SessionStartLimit: dto.SessionStartLimit{Total: 2, Remaining: 2, MaxConcurrency: 2},
+			}
+			fatals := make(chan *manager.FatalError, 10)
+			m := local.New(
+				local.WithBackoff(manager.BackoffPolicy{Initial: 100 * time.Millisecond, Multiplier: 2}),
+				local.WithFatalHandler(func(err *manager.FatalError) manager.FatalAction {
+					fatals <- err
+					return tt.action
+				}),
+			)
+			started := make(chan error, 1)
+			go func() {
+				started <- m.Start(ctx, apInfo, token.BotToken(1, "token"), dto.NewEventParse())
+			}()
+			// 多个 shard 时第一个 shard 正常连接，启动间隔为 1s，下一个 shard 被封禁
+			var healthy *websockettest.Conn
+			if tt.shards > 1 {
+				var err error
+				if healthy, err = s.NextConn(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.RejectNextHandshake(websockettest.CloseBanned, "bot banned")
+			if _, err := s.NextConn(ctx); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case fatal := <-fatals:
+				if errs.Error(fatal.Err).Code() != errs.CodeConnCloseCantIdentify {
+					t.Errorf("fatal error %v, want can not identify", fatal.Err)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("fatal handler should be called")
+			}
+
+			if tt.action == manager.FatalStop {
+				select {
+				case err := <-started:
+					var fatal *manager.FatalError
+					if !errors.As(err, &fatal) {
+						t.Errorf("Start() returned %v, want FatalError", err)
+					}
+				case <-time.After(testTimeout):
+					t.Fatal("Start() should return after fatal error")
+				}
+				// 不需要结束 ctx，其他 shard 的连接也会被关闭
+				select {
+				case <-healthy.Done():
+				case <-time.After(testTimeout):
+					t.Error("other shards should be closed after fatal error")
+				}
+				return
+			}
+			conn, err := s.NextConn(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conn.Err() != nil || conn.Identify() == nil {
+				t.Fatalf("manager should identify again, err: %v", conn.Err())
+			}
+		})
+	}
+}
+
+func TestChanManagerStatus(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	handlers, contents := atMessages()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 2},
+	}
+	m := local.New(local.WithBackoff(manager.BackoffPolicy{Initial: 100 * time.Millisecond, Multiplier: 2}))
+	ready := httptest.NewServer(manager.ReadinessHandler(m, manager.DefaultMaxSilence))
+	defer ready.Close()
+	go func() {
+		_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+	}()
+
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "a")
+	status := m.Status()
+	if !status.Running || len(status.Shards) != 1 {
+		t.Fatalf("Status() = %+v, want 1 running shard", status)
+	}
+	shard := status.Shards[0]
+	if !shard.Connected || shard.SessionID != conn.SessionID() || shard.LastSeq != 2 || shard.Events != 2 {
+		t.Errorf("shard status = %+v, want connected with session %s", shard, conn.SessionID())
+	}
+	if resp, err := http.Get(ready.URL); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("readiness check = %v, %v, want 200", resp, err)
+	}
+
+	_ = conn.Reconnect()
+	if _, err := s.NextConn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for shard = m.Status().Shards[0]; !shard.Connected && time.Now().Before(deadline); shard = m.Status().Shards[0] {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if shard.Reconnects != 1 || shard.LastError == "" {
+		t.Errorf("shard status = %+v, want 1 reconnect with last error", shard)
+	}
+
+	m.Stop()
+	if err := m.Status().Live(); err == nil {
+		t.Error("stopped manager should not be live")
+	}
+	if resp, err := http.Get(ready.URL); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("readiness check = %v, %v, want 503", resp, err)
+	}
+}
+
+func TestChanManagerReshard(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	handlers, contents := atMessages()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 3, Remaining: 3, MaxConcurrency: 2},
+	}
+	m := local.New()
+	defer m.Stop()
+	go func() {
+		_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+	}()
+	old, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resharded := make(chan error, 1)
+	go func() {
+		resharded <- m.Reshard(ctx, 2)
+	}()
+	var conns []*websockettest.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := s.NextConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.Identify().Shard; got[1] != 2 {
+			t.Fatalf("new session identify shard %v, want 2 shards", got)
+		}
+		conns = append(conns, conn)
+	}
+	// 新旧 shard 同时在线时，同一条消息只处理一次
+	if _, err := old.Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "1", Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "a")
+	if _, err := conns[0].Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "1", Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns[0].Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "2", Content: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "b")
+
+	select {
+	case err := <-resharded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("reshard is not finished")
+	}
+	select {
+	case <-old.Done():
+	case <-ctx.Done():
+		t.Fatal("old session should be retired")
+	}
+	shards := m.Status().Shards
+	if len(shards) != 2 || shards[0].ShardCount != 2 || shards[1].ShardCount != 2 {
+		t.Errorf("shards after reshard = %+v, want 2 shards", shards)
+	}
+	if err := m.Reshard(ctx, 2); err == nil {
+		t.Error("reshard to the current shard count should fail")
+	}
+}
@@ -0,0 +1,61 @@
+package local
+
+import (
+	"time"
+
+	"github.com/tencent-connect/botgo/log"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// Option 本地 session manager 的配置项
+type Option func(l *ChanManager)
+
+// WithWebsocket 指定创建连接使用的 websocket 实现，不指定时使用全局注册的 websocket.ClientImpl
+func WithWebsocket(ws websocket.WebSocket) Option {
+	return func(l *ChanManager) {
+		l.ws = ws
+	}
+}
+
+// WithLogger 指定 manager 使用的 logger，不指定时使用全局的 log.DefaultLogger
+func WithLogger(logger log.Logger) Option {
+	return func(l *ChanManager) {
+		l.logger = logger
+	}
+}
+
+// WithSessionStore 指定保存 session 的 store，Shutdown 时保存 session，Start 时恢复 session 并 resume
+func WithSessionStore(store manager.SessionStore) Option {
+	return func(l *ChanManager) {
+		l.store = store
+	}
+}
+
+// WithSessionLimiter 指定 session 启动次数限制的记录方式，不指定时使用进程内的 manager.MemoryLimiter
+func WithSessionLimiter(limiter manager.SessionLimiter) Option {
+	return func(l *ChanManager) {
+		l.limiter = limiter
+	}
+}
+
+// WithBackoff 指定重连的退避策略，不指定时使用 manager.DefaultBackoffPolicy
+func WithBackoff(policy manager.BackoffPolicy) Option {
+	return func(l *ChanManager) {
+		l.backoff = manager.NewBackoff(policy)
+	}
+}
+
+// WithFatalHandler 指定遇到不能 identify 的错误时的处理方式，不指定时停止 manager，Start 返回 manager.FatalError
+func WithFatalHandler(handler manager.FatalHandler) Option {
+	return func(l *ChanManager) {
+		l.onFatal = handler
+	}
+}
+
+// WithOverlapWindow 指定重新分片时过滤重复事件的窗口，旧的 shard 下线后继续过滤的时长，默认为 manager.DefaultOverlapWindow
+func WithOverlapWindow(window time.Duration) Option {
+	return func(l *ChanManager) {
+		l.overlap = manager.NewOverlapFilter(window)
+	}
+}
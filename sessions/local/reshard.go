@@ -0,0 +1,135 @@
+package local
+
+import (
+	"context"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+var _ manager.Resharder = (*ChanManager)(nil)
+
+// Reshard 在运行中调整 shard 数量，不需要重启 manager
+// 新的一组 shard 与旧的 shard 同时在线，期间按照事件 ID 过滤重复的事件，过滤的窗口可以通过 WithOverlapWindow 修改
+// 只有消息与审核等带有自然 ID 的事件会被过滤，频道、成员变更等没有自然 ID 的事件在此期间可能被处理两次
+// 新的 shard 全部连接后，等待旧的连接已经读取的事件处理完成再关闭，并删除旧的 shard 保存的 session
+// ctx 结束前新的 shard 没有全部连接时，关闭新的 shard 并返回错误，旧的 shard 不受影响
+func (l *ChanManager) Reshard(ctx context.Context, shards uint32) error {
+	l.lock.Lock()
+	if l.stop == nil || l.isStop {
+		l.lock.Unlock()
+		return manager.ErrManagerStopped
+	}
+	if l.resharding {
+		l.lock.Unlock()
+		return manager.ErrReshardInProgress
+	}
+	old := l.shardCount
+	if err := manager.CheckShards(old, shards); err != nil {
+		l.lock.Unlock()
+		return err
+	}
+	l.resharding = true
+	l.shardCounts[shards] = true
+	stop := l.stop
+	l.lock.Unlock()
+	defer func() {
+		l.lock.Lock()
+		l.resharding = false
+		l.lock.Unlock()
+	}()
+
+	l.log().Infof("[ws/session/local] reshard from %d to %d shards", old, shards)
+	l.overlap.Begin()
+	defer l.overlap.End()
+	for i := uint32(0); i < shards; i++ {
+		l.status.Add(i, shards)
+		session := l.newSession(i, shards)
+		l.restore(ctx, &session)
+		select {
+		case l.sessionChan <- session:
+		case <-stop:
+			return manager.ErrManagerStopped
+		case <-ctx.Done():
+			l.abortReshard(ctx, shards)
+			return ctx.Err()
+		}
+	}
+	if err := l.waitShards(ctx, stop, shards); err != nil {
+		if err != manager.ErrManagerStopped {
+			l.abortReshard(ctx, shards)
+		}
+		return err
+	}
+	err := l.retire(ctx, old)
+	l.lock.Lock()
+	l.shardCount = shards
+	l.lock.Unlock()
+	l.log().Infof("[ws/session/local] reshard to %d shards finished, %d duplicated events filtered",
+		shards, l.overlap.Hits())
+	return err
+}
+
+// abortReshard 新的 shard 没有全部连接，关闭新的 shard
+func (l *ChanManager) abortReshard(ctx context.Context, shards uint32) {
+	l.log().Errorf("[ws/session/local] reshard to %d shards aborted", shards)
+	if err := l.retire(ctx, shards); err != nil {
+		l.log().Errorf("[ws/session/local] retire shards failed, err: %v", err)
+	}
+}
+
+// waitShards 等待 shard 数量为 shards 的所有 shard 完成连接
+func (l *ChanManager) waitShards(ctx context.Context, stop chan struct{}, shards uint32) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		connected := uint32(0)
+		for _, shard := range l.status.Shards() {
+			if shard.ShardCount == shards && shard.Connected {
+				connected++
+			}
+		}
+		if connected == shards {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return manager.ErrManagerStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// retire 下线 shard 数量为 shards 的连接，等待已经读取的事件处理完成，之后这组 shard 不再重连
+func (l *ChanManager) retire(ctx context.Context, shards uint32) error {
+	l.lock.Lock()
+	delete(l.shardCounts, shards)
+	var clients []websocket.WebSocket
+	for shard, c := range l.clients {
+		if shard.ShardCount == shards {
+			// 连接交由 retire 处理
+			delete(l.clients, shard)
+			clients = append(clients, c)
+		}
+	}
+	l.lock.Unlock()
+
+	err := drainAll(ctx, clients)
+	for i := uint32(0); i < shards; i++ {
+		l.status.Release(i, shards)
+		// 下线的 shard 不再 resume，删除保存的状态
+		l.save(ctx, dto.Session{Shards: dto.ShardConfig{ShardID: i, ShardCount: shards}})
+	}
+	return err
+}
+
+// retired shard 是否已经因为重新分片下线
+func (l *ChanManager) retired(shards dto.ShardConfig) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return !l.shardCounts[shards.ShardCount]
+}
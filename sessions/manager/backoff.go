@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy 重连的退避策略，每个 shard 独立计算，为 0 的字段使用 DefaultBackoffPolicy 的值，Jitter 除外
+type BackoffPolicy struct {
+	Initial    time.Duration // 第一次重连前的等待时间
+	Max        time.Duration // 等待时间上限
+	Multiplier float64       // 每次失败后等待时间的倍数
+	Jitter     float64       // 随机抖动比例，0.2 表示实际等待时间在 [0.8, 1.2] 倍之间，避免多个实例同时重连
+	ResetAfter time.Duration // 连接保持超过该时长认为连接健康，重置退避
+}
+
+// DefaultBackoffPolicy 默认的重连退避策略
+var DefaultBackoffPolicy = BackoffPolicy{
+	Initial:    time.Second,
+	Max:        2 * time.Minute,
+	Multiplier: 2,
+	Jitter:     0.2,
+	ResetAfter: time.Minute,
+}
+
+// withDefaults 使用 DefaultBackoffPolicy 填充为 0 或者不合法的字段，避免没有等待时间的重连
+func (p BackoffPolicy) withDefaults() BackoffPolicy {
+	if p.Initial <= 0 {
+		p.Initial = DefaultBackoffPolicy.Initial
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultBackoffPolicy.Multiplier
+	}
+	if p.Max <= 0 {
+		p.Max = DefaultBackoffPolicy.Max
+	}
+	if p.Max < p.Initial {
+		p.Max = p.Initial
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	if p.ResetAfter <= 0 {
+		p.ResetAfter = DefaultBackoffPolicy.ResetAfter
+	}
+	return p
+}
+
+// Backoff 按照 shard 记录连续失败的次数，计算下一次重连前的等待时间
+type Backoff struct {
+	policy   BackoffPolicy
+	lock     sync.Mutex
+	attempts map[uint32]int
+	rand     *rand.Rand
+}
+
+// NewBackoff 创建重连退避，policy 中为 0 或者不合法的字段使用 DefaultBackoffPolicy 的值
+func NewBackoff(policy BackoffPolicy) *Backoff {
+	return &Backoff{
+		policy:   policy.withDefaults(),
+		attempts: map[uint32]int{},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next 记录一次失败，返回 shard 下一次重连前的等待时间
+func (b *Backoff) Next(shardID uint32) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	attempt := b.attempts[shardID]
+	b.attempts[shardID] = attempt + 1
+
+	delay := float64(b.policy.Initial) * math.Pow(b.policy.Multiplier, float64(attempt))
+	if delay > float64(b.policy.Max) {
+		delay = float64(b.policy.Max)
+	}
+	if b.policy.Jitter > 0 {
+		delay = delay * (1 - b.policy.Jitter + 2*b.policy.Jitter*b.rand.Float64())
+	}
+	return time.Duration(delay)
+}
+
+// Attempts 返回 shard 连续失败的次数
+func (b *Backoff) Attempts(shardID uint32) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.attempts[shardID]
+}
+
+// Reset 重置 shard 的退避
+func (b *Backoff) Reset(shardID uint32) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.attempts, shardID)
+}
+
+// Healthy 连接保持的时长超过 ResetAfter 时重置 shard 的退避
+func (b *Backoff) Healthy(shardID uint32, uptime time.Duration) {
+	if uptime >= b.policy.ResetAfter {
+		b.Reset(shardID)
+	}
+}
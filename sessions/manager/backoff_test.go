@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(BackoffPolicy{
+		Initial:    100 * time.Millisecond,
+		Max:        time.Second,
+		Multiplier: 2,
+		Jitter:     0.2,
+		ResetAfter: time.Minute,
+	})
+	wants := []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second,
+	}
+	for i, want := range wants {
+		got := b.Next(0)
+		if got < want*8/10 || got > want*12/10 {
+			t.Errorf("attempt %d: Next() = %v, want %v ± 20%%", i, got, want)
+		}
+	}
+	if got := b.Next(1); got > 120*time.Millisecond {
+		t.Errorf("other shard Next() = %v, want initial delay", got)
+	}
+	b.Healthy(0, time.Second)
+	if b.Attempts(0) != len(wants) {
+		t.Errorf("short connection should not reset backoff, attempts %d", b.Attempts(0))
+	}
+	b.Healthy(0, time.Minute)
+	if b.Attempts(0) != 0 {
+		t.Errorf("healthy connection should reset backoff, attempts %d", b.Attempts(0))
+	}
+}
+
+func TestBackoffPartialPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy BackoffPolicy
+		wants  []time.Duration
+	}{
+		{"only initial", BackoffPolicy{Initial: 100 * time.Millisecond},
+			[]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}},
+		{"empty", BackoffPolicy{}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{"invalid multiplier", BackoffPolicy{Initial: time.Second, Multiplier: 0.5, Max: 3 * time.Second},
+			[]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackoff(tt.policy)
+			for i, want := range tt.wants {
+				if got := b.Next(0); got != want {
+					t.Errorf("attempt %d: Next() = %v, want %v", i, got, want)
+				}
+			}
+			b.Healthy(0, time.Second)
+			if b.Attempts(0) == 0 {
+				t.Error("zero ResetAfter should use the default")
+			}
+		})
+	}
+}
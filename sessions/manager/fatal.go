@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// FatalDrainTimeout 因为 FatalError 停止时，等待其他连接已经读取的事件处理完成的最长时间，超时后关闭连接
+const FatalDrainTimeout = 10 * time.Second
+
+// FatalError 连接遇到不能再 identify 的错误，比如机器人被下架或者封禁，manager 停止时由 Start 返回
+//
+//	var fatal *manager.FatalError
+//	if err := sessionManager.Start(ctx, apInfo, token, handlers); errors.As(err, &fatal) {
+//		// 告警，不影响进程中的其他服务
+//	}
+type FatalError struct {
+	Session dto.Session // 出错的 session
+	Err     error       // 连接关闭的错误
+}
+
+// Error 实现 error 接口
+func (e *FatalError) Error() string {
+	return fmt.Sprintf("%s can not identify: %v", &e.Session, e.Err)
+}
+
+// Unwrap 返回连接关闭的错误
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// FatalAction 遇到 FatalError 时 manager 的处理方式
+type FatalAction int
+
+const (
+	// FatalStop 停止 manager，关闭其他 shard 的连接后 Start 返回 FatalError，默认的处理方式
+	FatalStop FatalAction = iota
+	// FatalRetry 清理 session 后按照退避时间重新 identify，用于等待机器人恢复
+	FatalRetry
+)
+
+// FatalHandler 决定遇到 FatalError 时的处理方式，可以在这里告警
+type FatalHandler func(err *FatalError) FatalAction
+
+// HandleFatal 调用 handler 获取处理方式，handler 为空时停止 manager
+func HandleFatal(handler FatalHandler, err *FatalError) FatalAction {
+	if handler == nil {
+		return FatalStop
+	}
+	return handler(err)
+}
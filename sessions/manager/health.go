@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxSilence 默认允许连接多长时间没有收到网关消息，网关的心跳间隔一般为 45s，超过两个心跳间隔认为连接已经不可用
+const DefaultMaxSilence = 90 * time.Second
+
+// Live manager 是否还在运行，停止后需要重新启动
+func (s Status) Live() error {
+	if s.Running {
+		return nil
+	}
+	if s.Error != "" {
+		return fmt.Errorf("session manager stopped: %s", s.Error)
+	}
+	return fmt.Errorf("session manager is not running")
+}
+
+// Ready manager 是否正在接收事件：manager 在运行，所有 shard 都已经连接，并且在 maxSilence 内收到过网关消息
+// maxSilence 小于等于 0 时不检查收到消息的时间，websocket 实现不支持 websocket.StatsReporter 时同样不检查
+func (s Status) Ready(maxSilence time.Duration) error {
+	if err := s.Live(); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, shard := range s.Shards {
+		if !shard.Connected {
+			return fmt.Errorf("shard %d/%d is not connected, last error: %s",
+				shard.ShardID, shard.ShardCount, shard.LastError)
+		}
+		if maxSilence <= 0 || shard.LastReceivedAt.IsZero() {
+			continue
+		}
+		if silence := now.Sub(shard.LastReceivedAt); silence > maxSilence {
+			return fmt.Errorf("shard %d/%d received nothing for %s", shard.ShardID, shard.ShardCount, silence)
+		}
+	}
+	return nil
+}
+
+// StatusHandler 以 JSON 格式输出 manager 的状态快照
+//
+//	http.Handle("/status", manager.StatusHandler(sessionManager))
+//	http.Handle("/livez", manager.LivenessHandler(sessionManager))
+//	http.Handle("/readyz", manager.ReadinessHandler(sessionManager, manager.DefaultMaxSilence))
+func StatusHandler(p StatusProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, p.Status())
+	})
+}
+
+// LivenessHandler 存活检查，manager 停止时返回 503
+func LivenessHandler(p StatusProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeCheck(w, p.Status().Live())
+	})
+}
+
+// ReadinessHandler 就绪检查，存在没有连接或者 maxSilence 内没有收到网关消息的 shard 时返回 503
+func ReadinessHandler(p StatusProvider, maxSilence time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeCheck(w, p.Status().Ready(maxSilence))
+	})
+}
+
+func writeCheck(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "fail", "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
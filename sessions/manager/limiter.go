@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+)
+
+// DefaultResetInterval 没有拿到最新的限制信息时，额度重置后到下一次重置的默认间隔
+const DefaultResetInterval = 24 * time.Hour
+
+// ErrManagerStopped 等待期间 session manager 已经停止
+var ErrManagerStopped = errors.New("session manager stopped")
+
+// SessionLimiter 记录 session 启动（identify）次数的限制，resume 不消耗次数
+type SessionLimiter interface {
+	// Update 使用 openapi 返回的最新限制信息更新
+	Update(ctx context.Context, limit dto.SessionStartLimit) error
+	// Acquire 消耗一次 identify 次数，次数不足时不消耗，返回距离重置的等待时间
+	Acquire(ctx context.Context) (time.Duration, error)
+}
+
+// ResetAfter 返回限制信息中距离重置的时间，openapi 返回的单位为毫秒
+func ResetAfter(limit dto.SessionStartLimit) time.Duration {
+	return time.Duration(limit.ResetAfter) * time.Millisecond
+}
+
+// MemoryLimiter 进程内的 SessionLimiter，同一个进程内的重连共享次数
+type MemoryLimiter struct {
+	lock      sync.Mutex
+	total     uint32
+	remaining uint32
+	resetAt   time.Time
+	updated   bool
+}
+
+// NewMemoryLimiter 创建进程内的 SessionLimiter，Update 之前不做限制
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{}
+}
+
+// Update 使用 openapi 返回的最新限制信息更新，重置窗口内只会降低剩余次数，不会恢复已经扣减的次数
+func (m *MemoryLimiter) Update(_ context.Context, limit dto.SessionStartLimit) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.total = limit.Total
+	if m.updated && time.Now().Before(m.resetAt) {
+		if limit.Remaining < m.remaining {
+			m.remaining = limit.Remaining
+		}
+		return nil
+	}
+	m.remaining = limit.Remaining
+	m.resetAt = time.Now().Add(ResetAfter(limit))
+	m.updated = true
+	return nil
+}
+
+// Acquire 消耗一次 identify 次数，次数不足时返回距离重置的等待时间
+func (m *MemoryLimiter) Acquire(_ context.Context) (time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.updated {
+		return 0, nil
+	}
+	now := time.Now()
+	if !now.Before(m.resetAt) {
+		m.remaining = m.total
+		m.resetAt = now.Add(DefaultResetInterval)
+	}
+	if m.remaining > 0 {
+		m.remaining--
+		return 0, nil
+	}
+	return m.resetAt.Sub(now), nil
+}
+
+// WaitIdentify 获取一次 identify 次数，次数不足时等待重置，每次等待前回调 onWait
+// ctx 结束时返回 ctx.Err()，stop 被关闭时返回 ErrManagerStopped
+func WaitIdentify(ctx context.Context, limiter SessionLimiter, stop <-chan struct{},
+	onWait func(wait time.Duration)) error {
+	for {
+		wait, err := limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if onWait != nil {
+			onWait(wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-stop:
+			timer.Stop()
+			return ErrManagerStopped
+		case <-timer.C:
+		}
+	}
+}
+
+// SessionLimitError 等待 session 启动次数重置时，通知使用方的错误
+func SessionLimitError(wait time.Duration) error {
+	return errs.New(errs.CodeSessionLimit, fmt.Sprintf("session start limit reached, wait %s for reset", wait))
+}
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLimiter()
+	if wait, _ := l.Acquire(ctx); wait != 0 {
+		t.Errorf("Acquire() before Update = %v, want 0", wait)
+	}
+	_ = l.Update(ctx, dto.SessionStartLimit{Total: 2, Remaining: 1, ResetAfter: 100})
+	if wait, _ := l.Acquire(ctx); wait != 0 {
+		t.Errorf("first Acquire() = %v, want 0", wait)
+	}
+	wait, _ := l.Acquire(ctx)
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("Acquire() without remaining = %v, want (0, 100ms]", wait)
+	}
+
+	// 等待重置之后恢复为 Total
+	var waits []time.Duration
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := WaitIdentify(ctx, l, nil, func(wait time.Duration) {
+			waits = append(waits, wait)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(waits) != 1 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("waits %v in %v, want to wait once for reset", waits, time.Since(start))
+	}
+	if wait, _ := l.Acquire(ctx); wait < time.Hour {
+		t.Errorf("Acquire() after reset budget used = %v, want to wait for next reset", wait)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := WaitIdentify(ctx, l, stop, nil); err != ErrManagerStopped {
+		t.Errorf("WaitIdentify() = %v, want %v", err, ErrManagerStopped)
+	}
+}
@@ -2,11 +2,13 @@
 package manager
 
 import (
+	"context"
 	"math"
 	"time"
 
 	"github.com/tencent-connect/botgo/dto"
 	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/websocket"
 )
 
 // CanNotResumeErrSet 不能进行 resume 操作的错误码
@@ -59,3 +61,20 @@ func CheckSessionLimit(apInfo *dto.WebsocketAP) error {
 	}
 	return nil
 }
+
+// Drain 优雅关闭连接，websocket 实现不支持 websocket.Drainer 时直接关闭
+func Drain(ctx context.Context, ws websocket.WebSocket) error {
+	if d, ok := ws.(websocket.Drainer); ok {
+		return d.Drain(ctx)
+	}
+	ws.Close()
+	return nil
+}
+
+// Checkpoint 获取连接当前可以安全 resume 的 session，websocket 实现不支持 websocket.Checkpointer 时返回当前的 session
+func Checkpoint(ws websocket.WebSocket) dto.Session {
+	if c, ok := ws.(websocket.Checkpointer); ok {
+		return c.Checkpoint()
+	}
+	return *ws.Session()
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+)
+
+// DefaultOverlapWindow 默认的重复事件过滤窗口，旧的连接关闭后继续过滤的时长
+const DefaultOverlapWindow = time.Minute
+
+var (
+	// ErrReshardInProgress 已经有正在进行的重新分片
+	ErrReshardInProgress = errors.New("reshard is in progress")
+	// ErrReshardNotSupported session manager 不支持重新分片
+	ErrReshardNotSupported = errors.New("session manager does not support reshard")
+)
+
+// Resharder 支持在运行中调整 shard 数量的 session manager
+type Resharder interface {
+	// Reshard 启动 shards 个新的 shard，与旧的 shard 同时在线，新的 shard 全部连接后关闭旧的 shard
+	// 同时在线期间按照事件 ID 过滤重复的事件，没有自然 ID 的事件（如频道、成员变更）可能被处理两次
+	Reshard(ctx context.Context, shards uint32) error
+}
+
+// CheckShards 检查重新分片的目标数量
+func CheckShards(current, shards uint32) error {
+	if shards == 0 {
+		return fmt.Errorf("invalid shard count %d", shards)
+	}
+	if shards == current {
+		return fmt.Errorf("shard count is already %d", shards)
+	}
+	return nil
+}
+
+// OverlapFilter 重新分片期间新旧两组 shard 同时在线，同一个事件可能从两个连接收到，过滤 window 内重复的事件
+// 只过滤有自然 ID 的事件，按照 dedup.Key 去重，如消息 ID，没有自然 ID 的事件直接通过，避免内容相同的不同事件被丢弃
+// 不在重新分片期间时不做任何过滤
+type OverlapFilter struct {
+	window time.Duration
+	hits   uint64
+
+	lock     sync.Mutex
+	overlaps int       // 正在进行的重新分片数量
+	until    time.Time // 重新分片结束后继续过滤到这个时间
+	store    dedup.Store
+	shared   bool // store 由调用方指定，不在重新分片开始时重建
+}
+
+// NewOverlapFilter 创建在内存中记录事件的过滤器，window 小于等于 0 时使用 DefaultOverlapWindow
+func NewOverlapFilter(window time.Duration) *OverlapFilter {
+	if window <= 0 {
+		window = DefaultOverlapWindow
+	}
+	return &OverlapFilter{window: window, store: dedup.NewMemoryStore()}
+}
+
+// NewStoreOverlapFilter 创建使用 store 记录事件的过滤器，多个实例使用同一个 store 时可以过滤不同实例重复收到的事件
+// store 返回错误时不过滤事件，window 小于等于 0 时使用 DefaultOverlapWindow
+func NewStoreOverlapFilter(store dedup.Store, window time.Duration) *OverlapFilter {
+	f := NewOverlapFilter(window)
+	f.store, f.shared = store, true
+	return f
+}
+
+// Begin 开始过滤重复的事件，上一次重新分片的记录已经过期时重新开始记录
+func (f *OverlapFilter) Begin() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.shared && f.overlaps == 0 && time.Now().After(f.until) {
+		f.store = dedup.NewMemoryStore()
+	}
+	f.overlaps++
+}
+
+// End 结束重新分片，在 window 内继续过滤，避免新的连接稍晚收到旧的连接已经处理的事件
+func (f *OverlapFilter) End() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.overlaps--
+	f.until = time.Now().Add(f.window)
+}
+
+// Hits 返回被过滤的重复事件数量
+func (f *OverlapFilter) Hits() uint64 {
+	return atomic.LoadUint64(&f.hits)
+}
+
+// Accept 实现 dto.EventFilter，事件在 window 内已经收到过时返回 false
+func (f *OverlapFilter) Accept(event *dto.WSPayload) bool {
+	f.lock.Lock()
+	store := f.store
+	active := f.overlaps > 0 || time.Now().Before(f.until)
+	f.lock.Unlock()
+	if !active {
+		return true
+	}
+	// 同一个事件在不同连接上的 seq 不同，不能作为 key，没有自然 ID 的事件无法判断是否重复
+	key := dedup.Key(event)
+	if key == "" {
+		return true
+	}
+	// 记录失败时不过滤，重复处理好过丢失事件
+	if seen, err := store.Mark(context.Background(), key, f.window); err == nil && seen {
+		atomic.AddUint64(&f.hits, 1)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+func TestOverlapFilter(t *testing.T) {
+	event := func(eventType dto.EventType, seq uint32, data string) *dto.WSPayload {
+		return &dto.WSPayload{
+			WSPayloadBase: dto.WSPayloadBase{OPCode: dto.WSDispatchEvent, Type: eventType, Seq: seq},
+			RawMessage:    []byte(`{"op":0,"t":"` + string(eventType) + `","d":` + data + `}`),
+		}
+	}
+	f := NewOverlapFilter(time.Minute)
+	message := event(dto.EventAtMessageCreate, 1, `{"id":"m1"}`)
+	if !f.Accept(message) || !f.Accept(message) {
+		t.Fatal("filter should accept all events out of reshard")
+	}
+
+	f.Begin()
+	tests := []struct {
+		name  string
+		event *dto.WSPayload
+		want  bool
+	}{
+		{"first message", event(dto.EventAtMessageCreate, 2, `{"id":"m1"}`), true},
+		{"same message on other shard", event(dto.EventAtMessageCreate, 5, `{"id":"m1"}`), false},
+		{"other message", event(dto.EventAtMessageCreate, 3, `{"id":"m2"}`), true},
+		{"guild update", event(dto.EventGuildUpdate, 4, `{"id":"g1","name":"a"}`), true},
+		// 没有自然 ID 的事件不过滤，内容相同也可能是不同的事件
+		{"same guild update", event(dto.EventGuildUpdate, 6, `{"id":"g1","name":"a"}`), true},
+		{"same member update", event(dto.EventGuildMemberUpdate, 7, `{"user":{"id":"u1"}}`), true},
+		{"repeated member update", event(dto.EventGuildMemberUpdate, 9, `{"user":{"id":"u1"}}`), true},
+	}
+	for _, tt := range tests {
+		if got := f.Accept(tt.event); got != tt.want {
+			t.Errorf("%s: Accept() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	f.End()
+	// 结束后在窗口内继续过滤
+	if f.Accept(event(dto.EventAtMessageCreate, 8, `{"id":"m2"}`)) {
+		t.Error("filter should drop duplicated events in window after reshard")
+	}
+	if f.Hits() != 2 {
+		t.Errorf("Hits() = %d, want 2", f.Hits())
+	}
+}
+
+func TestOverlapFilterWithoutEventID(t *testing.T) {
+	f := NewOverlapFilter(time.Minute)
+	f.Begin()
+	defer f.End()
+	// 新旧两个连接都收到同一个频道变更，没有自然 ID，两次都会下发
+	for _, seq := range []uint32{3, 7} {
+		update := &dto.WSPayload{
+			WSPayloadBase: dto.WSPayloadBase{OPCode: dto.WSDispatchEvent, Type: dto.EventChannelUpdate, Seq: seq},
+			RawMessage:    []byte(`{"op":0,"t":"CHANNEL_UPDATE","d":{"id":"c1","name":"a"}}`),
+		}
+		if !f.Accept(update) {
+			t.Errorf("Accept() seq %d = false, want events without id delivered on both shards", seq)
+		}
+	}
+	if f.Hits() != 0 {
+		t.Errorf("Hits() = %d, want 0", f.Hits())
+	}
+}
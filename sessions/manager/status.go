@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// ShardStatus 单个 shard 的连接状态
+type ShardStatus struct {
+	ShardID        uint32        `json:"shard_id"`
+	ShardCount     uint32        `json:"shard_count"`
+	Connected      bool          `json:"connected"`
+	SessionID      string        `json:"session_id"`
+	LastSeq        uint32        `json:"last_seq"`
+	Latency        time.Duration `json:"latency"` // 最近一次心跳的往返耗时，JSON 中单位为纳秒
+	Reconnects     int           `json:"reconnects"`
+	Events         uint64        `json:"events"` // 当前连接上收到的事件数量
+	ConnectedAt    time.Time     `json:"connected_at"`
+	LastReceivedAt time.Time     `json:"last_received_at"` // 最近一次收到网关消息的时间，包括心跳 ack
+	LastEventAt    time.Time     `json:"last_event_at"`
+	LastError      string        `json:"last_error,omitempty"`
+	LastErrorAt    time.Time     `json:"last_error_at"`
+}
+
+// Status session manager 的状态快照
+type Status struct {
+	Running bool          `json:"running"`
+	Error   string        `json:"error,omitempty"` // 导致 manager 停止的错误
+	Shards  []ShardStatus `json:"shards"`          // 由当前实例管理的 shard，按照 shard 数量与 shard id 排序
+}
+
+// StatusProvider 可以提供状态快照的 session manager，内置的 local 与 remote 实现都支持
+type StatusProvider interface {
+	// Status 返回 session manager 当前的状态快照
+	Status() Status
+}
+
+// StatusTracker 记录 shard 的连接状态，用于 session manager 实现 StatusProvider
+type StatusTracker struct {
+	lock   sync.Mutex
+	shards map[dto.ShardConfig]*shardState
+}
+
+type shardState struct {
+	status   ShardStatus
+	ws       websocket.WebSocket // 正在监听的连接，断开后为空
+	dialed   bool                // 是否已经连接过，用于计算重连次数
+	released bool                // shard 已经交由其他实例管理
+}
+
+// Reset 清空所有记录，用于 manager 重新启动
+func (t *StatusTracker) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.shards = map[dto.ShardConfig]*shardState{}
+}
+
+func (t *StatusTracker) shard(shardID, shardCount uint32) *shardState {
+	if t.shards == nil {
+		t.shards = map[dto.ShardConfig]*shardState{}
+	}
+	key := dto.ShardConfig{ShardID: shardID, ShardCount: shardCount}
+	s, ok := t.shards[key]
+	if !ok {
+		s = &shardState{status: ShardStatus{ShardID: shardID, ShardCount: shardCount}}
+		t.shards[key] = s
+	}
+	s.released = false
+	return s
+}
+
+// Add 记录一个还没有连接的 shard
+func (t *StatusTracker) Add(shardID, shardCount uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.shard(shardID, shardCount)
+}
+
+// Release shard 交由其他实例管理或者已经下线，不再出现在状态中，重新获取 shard 时保留之前的重连次数
+func (t *StatusTracker) Release(shardID, shardCount uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if s, ok := t.shards[dto.ShardConfig{ShardID: shardID, ShardCount: shardCount}]; ok {
+		s.released = true
+		s.ws = nil
+		s.status.Connected = false
+	}
+}
+
+// Connected 记录 shard 完成鉴权，开始监听
+func (t *StatusTracker) Connected(ws websocket.WebSocket) {
+	session := ws.Session()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s := t.shard(session.Shards.ShardID, session.Shards.ShardCount)
+	if s.dialed {
+		s.status.Reconnects++
+	}
+	s.dialed = true
+	s.ws = ws
+	s.status.Connected = true
+	s.status.ConnectedAt = time.Now()
+}
+
+// Disconnected 记录 shard 的连接断开，保留断开时的 session 与错误
+func (t *StatusTracker) Disconnected(ws websocket.WebSocket, err error) {
+	session := Checkpoint(ws)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.shards[session.Shards]
+	if !ok || s.ws != ws {
+		return
+	}
+	fillConn(&s.status, ws)
+	s.ws = nil
+	s.status.Connected = false
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = time.Now()
+	}
+}
+
+// Failed 记录 shard 建立连接或者鉴权失败的错误
+func (t *StatusTracker) Failed(shardID, shardCount uint32, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s := t.shard(shardID, shardCount)
+	s.status.LastError = err.Error()
+	s.status.LastErrorAt = time.Now()
+}
+
+// Shards 返回所有 shard 的状态，按照 shard 数量与 shard id 排序
+func (t *StatusTracker) Shards() []ShardStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	shards := make([]ShardStatus, 0, len(t.shards))
+	for _, s := range t.shards {
+		if s.released {
+			continue
+		}
+		status := s.status
+		if s.ws != nil {
+			fillConn(&status, s.ws)
+		}
+		shards = append(shards, status)
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		if shards[i].ShardCount != shards[j].ShardCount {
+			return shards[i].ShardCount < shards[j].ShardCount
+		}
+		return shards[i].ShardID < shards[j].ShardID
+	})
+	return shards
+}
+
+// fillConn 使用连接当前的 session 与运行状态更新 shard 状态
+func fillConn(status *ShardStatus, ws websocket.WebSocket) {
+	session := Checkpoint(ws)
+	status.SessionID = session.ID
+	status.LastSeq = session.LastSeq
+	if r, ok := ws.(websocket.StatsReporter); ok {
+		stats := r.Stats()
+		status.Latency = stats.Latency
+		status.Events = stats.Events
+		status.LastReceivedAt = stats.LastReceivedAt
+		status.LastEventAt = stats.LastEventAt
+	}
+}
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// SessionState 可以用于 resume 的 session 状态，不包含 token 等敏感信息
+type SessionState struct {
+	ID      string          `json:"id"`
+	LastSeq uint32          `json:"last_seq"`
+	Shards  dto.ShardConfig `json:"shards"`
+}
+
+// StateOf 获取 session 中可以用于 resume 的状态
+func StateOf(session dto.Session) SessionState {
+	return SessionState{ID: session.ID, LastSeq: session.LastSeq, Shards: session.Shards}
+}
+
+// Apply 将状态写入 session，shard 不一致时不写入
+func (s *SessionState) Apply(session *dto.Session) bool {
+	if s == nil || s.ID == "" || s.Shards != session.Shards {
+		return false
+	}
+	session.ID = s.ID
+	session.LastSeq = s.LastSeq
+	return true
+}
+
+// SessionStore 保存 session 状态，用于进程重启之后 resume，每个机器人需要使用独立的 store
+type SessionStore interface {
+	// Save 保存 shard 的 session 状态，ID 为空时删除
+	Save(ctx context.Context, state SessionState) error
+	// Load 读取 shard 的 session 状态，不存在时返回 nil
+	Load(ctx context.Context, shards dto.ShardConfig) (*SessionState, error)
+}
+
+// MemoryStore 基于内存的 SessionStore，进程退出后丢失，适用于测试
+type MemoryStore struct {
+	lock   sync.Mutex
+	states map[string]SessionState
+}
+
+// NewMemoryStore 创建基于内存的 SessionStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]SessionState{}}
+}
+
+// Save 保存 shard 的 session 状态
+func (m *MemoryStore) Save(_ context.Context, state SessionState) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if state.ID == "" {
+		delete(m.states, shardKey(state.Shards))
+		return nil
+	}
+	m.states[shardKey(state.Shards)] = state
+	return nil
+}
+
+// Load 读取 shard 的 session 状态
+func (m *MemoryStore) Load(_ context.Context, shards dto.ShardConfig) (*SessionState, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	state, ok := m.states[shardKey(shards)]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// FileStore 基于本地文件的 SessionStore，适用于单机部署
+type FileStore struct {
+	lock sync.Mutex
+	path string
+}
+
+// NewFileStore 创建基于本地文件的 SessionStore，文件不存在时会自动创建
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Save 保存 shard 的 session 状态
+func (f *FileStore) Save(_ context.Context, state SessionState) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	states, err := f.read()
+	if err != nil {
+		return err
+	}
+	if state.ID == "" {
+		delete(states, shardKey(state.Shards))
+	} else {
+		states[shardKey(state.Shards)] = state
+	}
+	content, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再替换，避免进程退出时写入一半
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// Load 读取 shard 的 session 状态
+func (f *FileStore) Load(_ context.Context, shards dto.ShardConfig) (*SessionState, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	states, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	state, ok := states[shardKey(shards)]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (f *FileStore) read() (map[string]SessionState, error) {
+	states := map[string]SessionState{}
+	content, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return nil, err
+		}
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return states, nil
+	}
+	if err := json.Unmarshal(content, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func shardKey(shards dto.ShardConfig) string {
+	return fmt.Sprintf("%d_%d", shards.ShardID, shards.ShardCount)
+}
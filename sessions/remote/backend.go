@@ -0,0 +1,68 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+)
+
+// Queue 分发 session 的队列，一条数据只能被一个实例取出
+type Queue interface {
+	// Push 放入数据
+	Push(ctx context.Context, data []byte) error
+	// Pop 取出最早放入的数据，timeout 内没有数据时返回 ErrQueueEmpty
+	Pop(ctx context.Context, timeout time.Duration) ([]byte, error)
+	// Clear 清空队列
+	Clear(ctx context.Context) error
+}
+
+// Lease 基于租约的分布式锁，持有者需要在租约到期前续期，持有者崩溃时锁随租约过期释放
+type Lease interface {
+	// Lock 获取锁，已经被其他持有者获取时返回错误
+	Lock(ctx context.Context, ttl time.Duration) error
+	// Token 返回最近一次获取锁时分配的 fencing token，同一个 key 每次获取锁都会递增
+	Token() uint64
+	// Renew 续期，锁已经不属于当前持有者时返回 ErrLeaseLost
+	Renew(ctx context.Context, ttl time.Duration) error
+	// Release 释放锁，锁已经不属于当前持有者时不做任何操作
+	Release(ctx context.Context) error
+}
+
+// Registry 集群的成员注册表，成员需要定期心跳，超过 ttl 没有心跳的成员被认为已经离开
+type Registry interface {
+	// Heartbeat 注册成员或者续期
+	Heartbeat(ctx context.Context, member string, ttl time.Duration) error
+	// Leave 移除成员
+	Leave(ctx context.Context, member string) error
+	// Members 返回当前存活的成员
+	Members(ctx context.Context) ([]string, error)
+}
+
+// ShardSet 集群正在运行的 shard 数量，重新分片期间新旧两组 shard 同时运行
+type ShardSet interface {
+	// Load 返回正在运行的 shard 数量，没有记录时返回空
+	Load(ctx context.Context) ([]uint32, error)
+	// Store 记录正在运行的 shard 数量
+	Store(ctx context.Context, counts []uint32) error
+}
+
+// Backend 分布式 session manager 使用的协调服务，同一个集群的实例需要连接到同一个服务
+// 内置了 redis 与内存的实现，可以按照接口接入 etcd 或者数据库等服务
+type Backend interface {
+	// Queue 返回 key 对应的 session 队列
+	Queue(key string) Queue
+	// Lease 返回 key 对应的锁，owner 用于区分持有者
+	Lease(key, owner string) Lease
+	// Store 返回集群共享的 session 状态存储，用于 resume
+	Store(clusterKey string) manager.SessionStore
+	// Limiter 返回集群共享的 session 启动次数限制
+	Limiter(clusterKey string) manager.SessionLimiter
+	// Registry 返回集群的成员注册表，用于按照成员分配 shard
+	Registry(clusterKey string) Registry
+	// ShardSet 返回集群正在运行的 shard 数量，用于重新分片时通知所有实例
+	ShardSet(clusterKey string) ShardSet
+	// Overlap 返回集群共享的事件记录，用于重新分片期间过滤不同实例重复收到的事件
+	Overlap(clusterKey string) dedup.Store
+}
@@ -0,0 +1,63 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+// checkpointOnReady 复制一份 handlers，在收到 ready 事件时保存 session 状态，不修改业务传入的 handlers
+// handlers 为空时复制的集合使用默认的 dto.IntentGuilds，与连接使用空的 handler 集合时一致
+func (r *Manager) checkpointOnReady(handlers *dto.EventParse) *dto.EventParse {
+	wrapped := handlers.Clone()
+	wrapped.Ready(func(event *dto.WSPayload, data *dto.WSReadyData) {
+		if len(data.Shard) == 2 {
+			r.checkpoint(dto.Session{
+				ID:      data.SessionID,
+				LastSeq: event.Seq,
+				Shards:  dto.ShardConfig{ShardID: data.Shard[0], ShardCount: data.Shard[1]},
+			})
+		}
+		handlers.HandleReady(event, data)
+	})
+	return wrapped
+}
+
+// checkpointLoop 定期保存连接的 session 状态，直到 end 被关闭
+func (r *Manager) checkpointLoop(ws websocket.WebSocket, end chan struct{}) {
+	if r.checkpointInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-end:
+			return
+		case <-ticker.C:
+			r.checkpoint(manager.Checkpoint(ws))
+		}
+	}
+}
+
+// checkpoint 保存 session 状态，session id 为空时删除保存的状态
+func (r *Manager) checkpoint(session dto.Session) {
+	if err := r.store.Save(context.Background(), manager.StateOf(session)); err != nil {
+		r.log().Errorf("[ws/session/remote] checkpoint session failed, err: %v", err)
+	}
+}
+
+// restore 使用保存的状态恢复 session
+func (r *Manager) restore(session *dto.Session) {
+	state, err := r.store.Load(context.Background(), session.Shards)
+	if err != nil {
+		r.log().Errorf("[ws/session/remote] load session failed, err: %v", err)
+		return
+	}
+	if state.Apply(session) {
+		r.log().Infof("[ws/session/remote] restore session %s, seq %d", session.ID, session.LastSeq)
+	}
+}
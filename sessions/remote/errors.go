@@ -2,6 +2,8 @@ package remote
 
 import (
 	"errors"
+
+	"github.com/tencent-connect/botgo/sessions/remote/lock"
 )
 
 var (
@@ -13,4 +15,10 @@ var (
 	ErrProduceFailed = errors.New("produce session failed")
 	// ErrorNotOk redis 写失败
 	ErrorNotOk = errors.New("redis write not ok")
+	// ErrQueueEmpty 等待超时，队列中没有数据
+	ErrQueueEmpty = errors.New("session queue is empty")
+	// ErrLeaseHeld 锁已经被其他持有者获取
+	ErrLeaseHeld = errors.New("lease is held by others")
+	// ErrLeaseLost 锁已经过期或者被其他持有者获取，与 lock.ErrLockLost 相同
+	ErrLeaseLost = lock.ErrLockLost
 )
@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/log"
+)
+
+// heldLease 已经获取的锁，后台按照 ttl 的 1/3 续期，直到 release 或者锁丢失
+type heldLease struct {
+	Lease
+	ttl      time.Duration
+	logger   log.Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	lost     chan struct{}
+	lostErr  error
+	lostOnce sync.Once
+}
+
+// acquire 获取锁并开始续期，ctx 结束时停止续期
+func acquire(ctx context.Context, l Lease, ttl time.Duration, logger log.Logger) (*heldLease, error) {
+	if err := l.Lock(ctx, ttl); err != nil {
+		return nil, err
+	}
+	h := &heldLease{
+		Lease:  l,
+		ttl:    ttl,
+		logger: logger,
+		stop:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	go h.keepAlive(ctx)
+	return h, nil
+}
+
+// keepAlive 定期续期，锁已经属于其他持有者，或者距离上次续期成功超过 ttl 时认为锁已经丢失
+func (h *heldLease) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(h.ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			err := h.Renew(ctx, h.ttl)
+			if err == nil {
+				renewedAt = time.Now()
+				continue
+			}
+			h.logger.Errorf("[ws/session/remote] renew lease failed, token %d, err: %v", h.Token(), err)
+			if err == ErrLeaseLost || time.Since(renewedAt) >= h.ttl {
+				h.markLost(err)
+				return
+			}
+		}
+	}
+}
+
+func (h *heldLease) markLost(err error) {
+	h.lostOnce.Do(func() {
+		h.lostErr = err
+		close(h.lost)
+	})
+}
+
+// isLost 锁是否已经丢失
+func (h *heldLease) isLost() bool {
+	select {
+	case <-h.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// release 停止续期并释放锁，可以重复调用
+func (h *heldLease) release(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	return h.Release(ctx)
+}
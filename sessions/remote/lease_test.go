@@ -0,0 +1,53 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/log"
+)
+
+func TestHeldLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	held, err := acquire(ctx, backend.Lease("shard", "a"), 30*time.Millisecond, log.DefaultLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquire(ctx, backend.Lease("shard", "b"), time.Minute, log.DefaultLogger); err != ErrLeaseHeld {
+		t.Fatalf("acquire held lease got %v, want ErrLeaseHeld", err)
+	}
+	// 续期期间锁不会过期
+	time.Sleep(100 * time.Millisecond)
+	if held.isLost() {
+		t.Fatal("renewed lease should not be lost")
+	}
+
+	// 模拟故障切换后锁被其他实例获取
+	backend.lock.Lock()
+	delete(backend.leases, "shard")
+	backend.lock.Unlock()
+	thief := backend.Lease("shard", "b")
+	if err := thief.Lock(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if thief.Token() <= held.Token() {
+		t.Errorf("fencing token %d should be greater than %d", thief.Token(), held.Token())
+	}
+	select {
+	case <-held.lost:
+		if held.lostErr != ErrLeaseLost {
+			t.Errorf("lost err = %v, want ErrLeaseLost", held.lostErr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lease lost should be signaled")
+	}
+	// 丢失的锁释放时不影响新的持有者
+	if err := held.release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := thief.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("new owner renew got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+)
+
+var _ manager.SessionLimiter = (*RedisLimiter)(nil)
+
+// acquireScript 剩余次数大于 0 时扣减并返回 -1，否则返回剩余的毫秒数
+// 剩余次数的 key 过期（已经重置）时恢复为总次数，过期时间为 ARGV[1] 毫秒，与 manager.MemoryLimiter 一致
+// 没有限制信息（总次数的 key 不存在）时返回 -2，不做限制
+var acquireScript = redis.NewScript(`
+local remaining = redis.call('GET', KEYS[1])
+if not remaining then
+	remaining = redis.call('GET', KEYS[2])
+	if not remaining then
+		return -2
+	end
+	redis.call('SET', KEYS[1], remaining, 'PX', ARGV[1])
+end
+if tonumber(remaining) > 0 then
+	redis.call('DECR', KEYS[1])
+	return -1
+end
+return redis.call('PTTL', KEYS[1])
+`)
+
+// updateScript 更新总次数，剩余次数的 key 不存在时写入，过期时间为 ARGV[3] 毫秒，ARGV[3] 小于等于 0 时已经重置，不写入
+// key 存在（重置窗口内）时只在新的剩余次数更小时写入，保持原来的过期时间，避免覆盖其他实例已经扣减的次数
+var updateScript = redis.NewScript(`
+redis.call('SET', KEYS[2], ARGV[1])
+local remaining = redis.call('GET', KEYS[1])
+if not remaining then
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	end
+	return 0
+end
+if tonumber(ARGV[2]) < tonumber(remaining) then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ttl)
+	end
+end
+return 0
+`)
+
+// RedisLimiter 基于 redis 的 SessionLimiter，集群内的所有实例共享 session 启动次数
+// 剩余次数保存在一个过期时间为 ResetAfter 的 key 中，key 过期即认为次数已经重置，恢复为同时保存的总次数
+type RedisLimiter struct {
+	client     *redis.Client
+	clusterKey string
+}
+
+// NewRedisLimiter 创建基于 redis 的 SessionLimiter
+func NewRedisLimiter(client *redis.Client, clusterKey string) *RedisLimiter {
+	return &RedisLimiter{client: client, clusterKey: clusterKey}
+}
+
+// Update 使用 openapi 返回的最新限制信息更新
+// 集群内每个实例启动时都会调用，重置窗口内只会降低剩余次数，不会覆盖其他实例已经扣减的次数
+func (l *RedisLimiter) Update(ctx context.Context, limit dto.SessionStartLimit) error {
+	return updateScript.Run(ctx, l.client, []string{l.key(), l.totalKey()},
+		limit.Total, limit.Remaining, manager.ResetAfter(limit).Milliseconds()).Err()
+}
+
+// Acquire 消耗一次 identify 次数，次数不足时返回距离重置的等待时间
+func (l *RedisLimiter) Acquire(ctx context.Context) (time.Duration, error) {
+	ms, err := acquireScript.Run(ctx, l.client, []string{l.key(), l.totalKey()},
+		manager.DefaultResetInterval.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (l *RedisLimiter) key() string {
+	return fmt.Sprintf("%s_session_limit", l.clusterKey)
+}
+
+func (l *RedisLimiter) totalKey() string {
+	return fmt.Sprintf("%s_session_limit_total", l.clusterKey)
+}
+
+// waitIdentify 获取 identify 次数，次数不足时记录日志并通知使用方，等待重置
+func (r *Manager) waitIdentify(ctx context.Context, session dto.Session) error {
+	r.lock.Lock()
+	stop := r.stop
+	r.lock.Unlock()
+	return manager.WaitIdentify(ctx, r.limiter, stop, func(wait time.Duration) {
+		r.log().Warnf("[ws/session/remote] %s session start limit reached, wait %s for reset", &session, wait)
+		session.Handlers.NotifyError(manager.SessionLimitError(wait))
+	})
+}
@@ -0,0 +1,88 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/sessions/remote"
+)
+
+type limiterCase struct {
+	name    string
+	limiter func(t *testing.T) manager.SessionLimiter
+}
+
+// limiterCases 返回内存与 redis 的 SessionLimiter，redis 不可用时跳过
+func limiterCases(client *redis.Client) []limiterCase {
+	return []limiterCase{
+		{"memory", func(t *testing.T) manager.SessionLimiter {
+			return remote.NewMemoryBackend().Limiter("cluster")
+		}},
+		{"redis", func(t *testing.T) manager.SessionLimiter {
+			if err := client.Ping(context.Background()).Err(); err != nil {
+				t.Skipf("redis is not available: %v", err)
+			}
+			return remote.NewRedisLimiter(client, uuid.NewString())
+		}},
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379", DialTimeout: 200 * time.Millisecond})
+	defer client.Close()
+	tests := limiterCases(client)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			l := tt.limiter(t)
+			if err := l.Update(ctx, dto.SessionStartLimit{Total: 2, Remaining: 0, ResetAfter: 100}); err != nil {
+				t.Fatal(err)
+			}
+			if wait, err := l.Acquire(ctx); err != nil || wait <= 0 || wait > 100*time.Millisecond {
+				t.Fatalf("Acquire() without remaining = %v, %v, want (0, 100ms]", wait, err)
+			}
+			time.Sleep(150 * time.Millisecond)
+			// 重置之后恢复为 Total，并在下一个默认间隔内继续限制
+			for i := 0; i < 2; i++ {
+				if wait, err := l.Acquire(ctx); err != nil || wait != 0 {
+					t.Fatalf("Acquire() %d after reset = %v, %v, want 0", i, wait, err)
+				}
+			}
+			if wait, err := l.Acquire(ctx); err != nil || wait < time.Hour {
+				t.Errorf("Acquire() after reset budget used = %v, %v, want to wait for next reset", wait, err)
+			}
+		})
+	}
+}
+
+func TestLimiterUpdateInWindow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379", DialTimeout: 200 * time.Millisecond})
+	defer client.Close()
+	for _, tt := range limiterCases(client) {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			l := tt.limiter(t)
+			if err := l.Update(ctx, dto.SessionStartLimit{Total: 3, Remaining: 2, ResetAfter: 3600000}); err != nil {
+				t.Fatal(err)
+			}
+			if wait, err := l.Acquire(ctx); err != nil || wait != 0 {
+				t.Fatalf("Acquire() = %v, %v, want 0", wait, err)
+			}
+			// 其他实例启动时拿到的剩余次数更大，不能覆盖已经扣减的次数
+			if err := l.Update(ctx, dto.SessionStartLimit{Total: 3, Remaining: 2, ResetAfter: 3600000}); err != nil {
+				t.Fatal(err)
+			}
+			if wait, err := l.Acquire(ctx); err != nil || wait != 0 {
+				t.Fatalf("Acquire() = %v, %v, want 0", wait, err)
+			}
+			if wait, err := l.Acquire(ctx); err != nil || wait <= 0 {
+				t.Fatalf("Acquire() without remaining = %v, %v, want to wait for reset", wait, err)
+			}
+		})
+	}
+}
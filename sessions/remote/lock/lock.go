@@ -4,6 +4,7 @@ package lock
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	redis "github.com/go-redis/redis/v8"
@@ -13,11 +14,32 @@ import (
 // ErrorNotOk redis 写失败
 var ErrorNotOk = errors.New("redis write not ok")
 
+// ErrLockLost 锁已经过期或者被其他持有者获取
+var ErrLockLost = errors.New("lock is lost")
+
+// lockScript 加锁成功后递增 fencing token 并返回，加锁失败返回 0
+var lockScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0
+`)
+
+// renewScript 锁属于当前持有者时续期并返回 1，否则返回 0
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end
+`)
+
 // Lock 一个基于redis的锁实现
 type Lock struct {
 	lockKey       string
 	lockValue     string
 	client        *redis.Client
+	token         uint64
 	renewTicker   *time.Ticker // 用于续期的ticker，默认为超时时间的 1/3
 	stopRenewChan chan bool    // 用于停止 renew
 }
@@ -31,18 +53,37 @@ func New(key, value string, client *redis.Client) *Lock {
 	}
 }
 
-// Lock 加锁
+// Lock 加锁，成功后可以通过 Token 获取本次加锁的 fencing token
 func (l *Lock) Lock(ctx context.Context, expire time.Duration) error {
-	success, err := l.client.SetNX(ctx, l.lockKey, l.lockValue, expire).Result()
+	token, err := lockScript.Run(ctx, l.client, []string{l.lockKey, l.fencingKey()},
+		l.lockValue, expire.Milliseconds()).Uint64()
 	if err != nil {
 		return err
 	}
-	if !success {
+	if token == 0 {
 		return ErrorNotOk
 	}
+	l.token = token
 	return nil
 }
 
+// Token 返回最近一次加锁获得的 fencing token，同一个 key 每次加锁都会递增
+// 写入外部存储时带上 token，存储拒绝比已经见过的 token 更小的写入，可以避免锁过期的持有者覆盖新持有者的数据
+func (l *Lock) Token() uint64 {
+	return l.token
+}
+
+// fencingKey fencing token 的 key，与锁的 key 分配到 Redis Cluster 的同一个 slot，才能在同一个脚本中访问
+// 锁的 key 保持不变，与旧版本的实例竞争同一个 key；key 中已经有 hash tag 时沿用，否则使用整个 key 作为 hash tag
+func (l *Lock) fencingKey() string {
+	if start := strings.Index(l.lockKey, "{"); start >= 0 {
+		if end := strings.Index(l.lockKey[start+1:], "}"); end > 0 {
+			return l.lockKey + "_fencing"
+		}
+	}
+	return "{" + l.lockKey + "}_fencing"
+}
+
 // StartRenew 开始续期任务，需要放到 goroutine 中执行
 func (l *Lock) StartRenew(ctx context.Context, expire time.Duration) {
 	if expire == 0 {
@@ -77,17 +118,16 @@ func (l *Lock) StopRenew() {
 	l.stopRenewChan <- true
 }
 
-// Renew 续期锁
+// Renew 续期锁，锁已经过期或者属于其他持有者时返回 ErrLockLost
 func (l *Lock) Renew(ctx context.Context, expire time.Duration) error {
-	script := `
-	if redis.call("get", KEYS[1]) == ARGV[1] then
-		return redis.call("expire", KEYS[1], ARGV[2])
-	else
-		return 0
-	end
-	`
-	renew := redis.NewScript(script)
-	return renew.Run(ctx, l.client, []string{l.lockKey}, l.lockValue, expire.Seconds()).Err()
+	renewed, err := renewScript.Run(ctx, l.client, []string{l.lockKey}, l.lockValue, expire.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if renewed == 0 {
+		return ErrLockLost
+	}
+	return nil
 }
 
 // Release 释放锁
@@ -27,6 +27,9 @@ func TestLock_Lock(t *testing.T) {
 		if err := lock.Lock(ctx, expire); err != nil {
 			t.Error(err)
 		}
+		if lock.Token() == 0 {
+			t.Error("want fencing token after lock")
+		}
 	})
 	t.Run("renew", func(t *testing.T) {
 		if err := lock.Renew(ctx, expire); err != nil {
@@ -56,3 +59,51 @@ func TestLock_Lock(t *testing.T) {
 		}
 	})
 }
+
+func TestLockFencingKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// Redis Cluster 只使用 {} 中的内容计算 slot，与不带 hash tag 的 key 在同一个 slot
+		{"lock-key-test", "{lock-key-test}_fencing"},
+		{"cluster_{shard}_0", "cluster_{shard}_0_fencing"},
+		{"empty_{}_tag", "{empty_{}_tag}_fencing"},
+	}
+	for _, tt := range tests {
+		if got := New(tt.key, "ddd", nil).fencingKey(); got != tt.want {
+			t.Errorf("fencingKey(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLockWithOldVersion(t *testing.T) {
+	conn := redis.NewClient(&redis.Options{Addr: "localhost:6379", DialTimeout: 200 * time.Millisecond})
+	defer conn.Close()
+	ctx := context.Background()
+	if err := conn.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+	key := "lock-key-mixed-test"
+	expire := 4 * time.Second
+	defer conn.Del(ctx, key, New(key, "", nil).fencingKey())
+
+	// 旧版本的实例使用 SETNX 直接对同一个 key 加锁
+	if ok, err := conn.SetNX(ctx, key, "old", expire).Result(); err != nil || !ok {
+		t.Fatalf("old SetNX() = %v, %v, want true", ok, err)
+	}
+	lock := New(key, "new", conn)
+	if err := lock.Lock(ctx, expire); err != ErrorNotOk {
+		t.Errorf("Lock() while held by old version = %v, want %v", err, ErrorNotOk)
+	}
+	conn.Del(ctx, key)
+	if err := lock.Lock(ctx, expire); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := conn.SetNX(ctx, key, "old", expire).Result(); err != nil || ok {
+		t.Errorf("old SetNX() while held by new version = %v, %v, want false", ok, err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,204 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/remote"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/client"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+const testTimeout = 10 * time.Second
+
+func init() {
+	client.Setup()
+}
+
+func TestManagerDistributesShards(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            2,
+		SessionStartLimit: dto.SessionStartLimit{Total: 2, Remaining: 2, MaxConcurrency: 2},
+	}
+	// 两个实例使用同一个内存协调服务组成集群
+	backend := remote.NewMemoryBackend()
+	managers := []*remote.Manager{remote.NewManager(backend), remote.NewManager(backend)}
+	for _, m := range managers {
+		defer m.Stop()
+		go func(m *remote.Manager) {
+			_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), dto.NewEventParse())
+		}(m)
+	}
+
+	shards := map[uint32]bool{}
+	for i := 0; i < 2; i++ {
+		conn, err := s.NextConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Identify() == nil {
+			t.Fatal("new session should identify")
+		}
+		shards[conn.Identify().Shard[0]] = true
+	}
+	if len(shards) != 2 {
+		t.Fatalf("connected shards %v, want both shards", shards)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for {
+		connected := 0
+		for _, m := range managers {
+			for _, shard := range m.Status().Shards {
+				if shard.Connected {
+					connected++
+				}
+			}
+		}
+		if connected == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d connected shards in status, want 2", connected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.Identifies() != 2 {
+		t.Errorf("got %d identifies, want 2", s.Identifies())
+	}
+}
+
+func TestManagerNilHandlers(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 1, Remaining: 1, MaxConcurrency: 1},
+	}
+	m := remote.NewManager(remote.NewMemoryBackend())
+	defer m.Stop()
+	go func() {
+		_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), nil)
+	}()
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 handler 时使用默认的 intent
+	if got := conn.Identify().Intents; got != dto.IntentGuilds {
+		t.Errorf("identify intents = %v, want %v", got, dto.IntentGuilds)
+	}
+}
+
+func TestManagerReshard(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	contents := make(chan string, 10)
+	handlers := dto.NewEventParse().AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+		contents <- data.Content
+		return nil
+	})
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case got := <-contents:
+			if got != want {
+				t.Errorf("content = %v, want %v", got, want)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("timeout waiting for %v", want)
+		}
+	}
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            1,
+		SessionStartLimit: dto.SessionStartLimit{Total: 3, Remaining: 3, MaxConcurrency: 2},
+	}
+	backend := remote.NewMemoryBackend()
+	managers := []*remote.Manager{remote.NewManager(backend), remote.NewManager(backend)}
+	for _, m := range managers {
+		defer m.Stop()
+		go func(m *remote.Manager) {
+			_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), handlers)
+		}(m)
+	}
+	old, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resharded := make(chan error, 1)
+	go func() {
+		resharded <- managers[1].Reshard(ctx, 2)
+	}()
+	var conns []*websockettest.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := s.NextConn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.Identify().Shard; got[1] != 2 {
+			t.Fatalf("new session identify shard %v, want 2 shards", got)
+		}
+		conns = append(conns, conn)
+	}
+	// 新旧 shard 同时在线时，同一条消息只处理一次，即使由不同的实例收到
+	if _, err := old.Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "1", Content: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	receive("a")
+	for _, conn := range conns {
+		if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "1", Content: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conns[0].Dispatch(dto.EventAtMessageCreate, &dto.Message{ID: "2", Content: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	receive("b")
+
+	select {
+	case err := <-resharded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("reshard is not finished")
+	}
+	select {
+	case <-old.Done():
+	case <-ctx.Done():
+		t.Fatal("old session should be retired")
+	}
+	deadline := time.Now().Add(testTimeout)
+	for {
+		var shards []uint32
+		for _, m := range managers {
+			for _, shard := range m.Status().Shards {
+				shards = append(shards, shard.ShardCount)
+			}
+		}
+		if equalShards(shards, []uint32{2, 2}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("shard counts after reshard = %v, want 2 shards", shards)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := managers[0].Reshard(ctx, 2); err == nil {
+		t.Error("reshard to the current shard count should fail")
+	}
+}
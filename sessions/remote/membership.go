@@ -0,0 +1,276 @@
+package remote
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+)
+
+const (
+	// 成员心跳的默认过期时间，每隔 1/3 的时间心跳一次
+	defaultMemberTTL = 15 * time.Second
+	// 交接 shard 时等待已经读取的事件处理完成的最长时间
+	handoffTimeout = 10 * time.Second
+)
+
+// ShardOwner 使用 rendezvous hashing 计算 shard 所属的成员，成员为空时返回空字符串
+// 成员加入或者离开时，只有归属于变化的成员的 shard 需要移动
+func ShardOwner(members []string, shardID uint32) string {
+	var owner string
+	var best uint64
+	for _, member := range members {
+		score := shardScore(member, shardID)
+		if owner == "" || score > best || (score == best && member < owner) {
+			owner, best = member, score
+		}
+	}
+	return owner
+}
+
+func shardScore(member string, shardID uint32) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], shardID)
+	_, _ = h.Write(id[:])
+	return h.Sum64()
+}
+
+// assignment 按照成员分配 shard 时本实例的状态
+type assignment struct {
+	memberID string
+	ttl      time.Duration
+	registry Registry
+
+	lock       sync.Mutex
+	members    []string
+	connecting map[dto.ShardConfig]bool      // 已经从队列取出，正在连接或者监听的 shard
+	queued     map[dto.ShardConfig]time.Time // 已经放入本实例队列，还没有取出的 shard
+}
+
+func (a *assignment) reset() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.members = nil
+	a.connecting = map[dto.ShardConfig]bool{}
+	a.queued = map[dto.ShardConfig]time.Time{}
+}
+
+// owner 计算 shard 所属的成员，exclude 为 true 时不包括本实例，没有可用的成员时返回本实例
+func (a *assignment) owner(shardID uint32, exclude bool) string {
+	a.lock.Lock()
+	members := a.members
+	a.lock.Unlock()
+	if exclude {
+		others := make([]string, 0, len(members))
+		for _, m := range members {
+			if m != a.memberID {
+				others = append(others, m)
+			}
+		}
+		members = others
+	}
+	if owner := ShardOwner(members, shardID); owner != "" {
+		return owner
+	}
+	return a.memberID
+}
+
+// setMembers 更新成员列表，返回已经离开的成员
+func (a *assignment) setMembers(members []string) (departed []string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	current := map[string]bool{}
+	for _, m := range members {
+		current[m] = true
+	}
+	for _, m := range a.members {
+		if !current[m] {
+			departed = append(departed, m)
+		}
+	}
+	a.members = members
+	return departed
+}
+
+// begin 标记 shard 开始连接，shard 已经在连接时返回 false
+func (a *assignment) begin(shard dto.ShardConfig) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.queued, shard)
+	if a.connecting[shard] {
+		return false
+	}
+	a.connecting[shard] = true
+	return true
+}
+
+// done shard 的连接已经退出
+func (a *assignment) done(shard dto.ShardConfig) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.connecting, shard)
+}
+
+// routed 记录 session 被放入的队列
+func (a *assignment) routed(shard dto.ShardConfig, owner string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if owner == a.memberID {
+		a.queued[shard] = time.Now()
+	} else {
+		delete(a.queued, shard)
+	}
+}
+
+// orphan shard 既没有在连接，也没有在 staleAfter 内放入本实例的队列
+func (a *assignment) orphan(shard dto.ShardConfig, staleAfter time.Duration) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.connecting[shard] {
+		return false
+	}
+	queuedAt, ok := a.queued[shard]
+	return !ok || time.Since(queuedAt) > staleAfter
+}
+
+// memberQueue 返回成员的 session 队列
+func (r *Manager) memberQueue(member string) Queue {
+	return r.backend.Queue(fmt.Sprintf("%s_%s", r.sessionQueueKey, member))
+}
+
+// ownerQueue 返回 shard 所属成员的队列，manager 已经停止时不会分配给本实例
+func (r *Manager) ownerQueue(shard dto.ShardConfig) Queue {
+	r.lock.Lock()
+	stopped := r.isStop
+	r.lock.Unlock()
+	owner := r.assign.owner(shard.ShardID, stopped)
+	r.assign.routed(shard, owner)
+	return r.memberQueue(owner)
+}
+
+// accept 判断从本实例队列取出的 session 是否由本实例连接
+// 成员变化后不再属于本实例的 session 转发给新的成员，正在连接的 shard 重复的 session 被丢弃
+func (r *Manager) accept(session dto.Session) bool {
+	shard := session.Shards
+	if r.assign.owner(shard.ShardID, false) != r.assign.memberID {
+		// 本地的成员列表可能已经过期，刷新后再判断
+		r.refreshMembers(context.Background())
+		if r.assign.owner(shard.ShardID, false) != r.assign.memberID {
+			if err := r.produce(session); err != nil {
+				r.log().Errorf("[ws/session/remote] forward session failed, err: %v", err)
+			}
+			return false
+		}
+	}
+	if !r.assign.begin(shard) {
+		r.log().Debugf("[ws/session/remote] %s is connecting, drop duplicated session", &session)
+		return false
+	}
+	return true
+}
+
+// joinCluster 注册成员并获取成员列表
+func (r *Manager) joinCluster(ctx context.Context) {
+	if err := r.assign.registry.Heartbeat(ctx, r.assign.memberID, r.assign.ttl); err != nil {
+		r.log().Errorf("[ws/session/remote] member heartbeat failed, err: %v", err)
+	}
+	r.refreshMembers(ctx)
+}
+
+// refreshMembers 更新成员列表，清空已经离开的成员的队列，其中的 shard 由新的所属成员重新认领
+func (r *Manager) refreshMembers(ctx context.Context) {
+	members, err := r.assign.registry.Members(ctx)
+	if err != nil {
+		r.log().Errorf("[ws/session/remote] get members failed, err: %v", err)
+		return
+	}
+	for _, member := range r.assign.setMembers(members) {
+		r.log().Infof("[ws/session/remote] member %s left the cluster", member)
+		if err := r.memberQueue(member).Clear(ctx); err != nil {
+			r.log().Errorf("[ws/session/remote] clear queue of member %s failed, err: %v", member, err)
+		}
+	}
+}
+
+// leaveCluster 移除成员，其他实例不再将 shard 分配给本实例
+func (r *Manager) leaveCluster() {
+	if err := r.assign.registry.Leave(context.Background(), r.assign.memberID); err != nil {
+		r.log().Errorf("[ws/session/remote] leave cluster failed, err: %v", err)
+	}
+}
+
+// membershipLoop 定期心跳，交出不再属于本实例的 shard，认领属于本实例但是没有被连接的 shard，直到 manager 停止
+func (r *Manager) membershipLoop(apInfo *dto.WebsocketAP, token *token.Token, startInterval time.Duration,
+	stop chan struct{}) {
+	ticker := time.NewTicker(r.assign.ttl / 3)
+	defer ticker.Stop()
+	// 放入队列的 session 在这个时间内没有被取出，认为已经丢失
+	staleAfter := r.assign.ttl + startInterval*time.Duration(apInfo.Shards)
+	for {
+		r.rebalance(apInfo, token, staleAfter)
+		select {
+		case <-stop:
+			r.leaveCluster()
+			return
+		case <-ticker.C:
+			r.joinCluster(context.Background())
+		}
+	}
+}
+
+// rebalance 按照当前的成员列表交接与认领 shard
+func (r *Manager) rebalance(apInfo *dto.WebsocketAP, token *token.Token, staleAfter time.Duration) {
+	r.lock.Lock()
+	if r.isStop {
+		r.lock.Unlock()
+		return
+	}
+	var moved []*shardConn
+	for shard, c := range r.clients {
+		if r.assign.owner(shard.ShardID, false) != r.assign.memberID {
+			// 连接交由 handoff 处理
+			delete(r.clients, shard)
+			moved = append(moved, c)
+		}
+	}
+	r.lock.Unlock()
+	for _, c := range moved {
+		go r.handoff(c)
+	}
+
+	// 重新分片期间新旧两组 shard 都需要认领
+	for _, count := range r.activeShards() {
+		for i := uint32(0); i < count; i++ {
+			shard := dto.ShardConfig{ShardID: i, ShardCount: count}
+			if r.assign.owner(i, false) != r.assign.memberID || !r.assign.orphan(shard, staleAfter) {
+				continue
+			}
+			r.log().Infof("[ws/session/remote] claim shard %d/%d", shard.ShardID, shard.ShardCount)
+			session := dto.Session{URL: apInfo.URL, Token: *token, Shards: shard}
+			if err := r.produce(session); err != nil {
+				r.log().Errorf("[ws/session/remote] claim shard failed, err: %v", err)
+			}
+		}
+	}
+}
+
+// handoff 等待连接已经读取的事件处理完成，然后将 session 交给新的所属成员 resume
+func (r *Manager) handoff(c *shardConn) {
+	// 连接还在监听，读取 session 的副本
+	session := manager.Checkpoint(c.ws)
+	r.log().Infof("[ws/session/remote] %s hand off to member %s", &session, r.assign.owner(session.Shards.ShardID, false))
+	ctx, cancel := context.WithTimeout(context.Background(), handoffTimeout)
+	defer cancel()
+	if err := manager.Drain(ctx, c.ws); err != nil {
+		r.log().Errorf("[ws/session/remote] drain %s failed, err: %v", &session, err)
+	}
+	r.handOver(context.Background(), manager.Checkpoint(c.ws), c.shardLock)
+}
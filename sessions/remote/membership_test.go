@@ -0,0 +1,122 @@
+package remote_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/remote"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+func TestShardOwner(t *testing.T) {
+	members := []string{"a", "b", "c"}
+	for shardID := uint32(0); shardID < 64; shardID++ {
+		owner := remote.ShardOwner(members, shardID)
+		if got := remote.ShardOwner([]string{"c", "a", "b"}, shardID); got != owner {
+			t.Fatalf("shard %d owner %s depends on member order, want %s", shardID, got, owner)
+		}
+		// 成员离开时，只有该成员的 shard 移动
+		if left := remote.ShardOwner([]string{"a", "b"}, shardID); owner != "c" && left != owner {
+			t.Fatalf("shard %d moved from %s to %s when c left", shardID, owner, left)
+		}
+	}
+	if got := remote.ShardOwner(nil, 0); got != "" {
+		t.Errorf("owner without members = %q, want empty", got)
+	}
+}
+
+func TestManagerShardAssignment(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testTimeout)
+	defer cancel()
+	const shards = 4
+	apInfo := &dto.WebsocketAP{
+		URL:               s.URL,
+		Shards:            shards,
+		SessionStartLimit: dto.SessionStartLimit{Total: shards, Remaining: shards, MaxConcurrency: shards},
+	}
+	backend := remote.NewMemoryBackend()
+	start := func(member string) *remote.Manager {
+		m := remote.NewManager(backend, remote.WithShardAssignment(member), remote.WithMemberTTL(300*time.Millisecond))
+		go func() {
+			_ = m.Start(ctx, apInfo, token.BotToken(1, "token"), dto.NewEventParse())
+		}()
+		return m
+	}
+	// waitShards 等待每个实例连接的 shard 与 want 一致
+	waitShards := func(want map[*remote.Manager][]uint32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * testTimeout)
+		for {
+			matched := true
+			for m, shardIDs := range want {
+				var connected []uint32
+				for _, shard := range m.Status().Shards {
+					if shard.Connected {
+						connected = append(connected, shard.ShardID)
+					}
+				}
+				if !equalShards(connected, shardIDs) {
+					matched = false
+				}
+			}
+			if matched {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("shards are not assigned as %v", want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	a := start("a")
+	defer a.Stop()
+	waitShards(map[*remote.Manager][]uint32{a: {0, 1, 2, 3}})
+
+	// 新成员加入，属于新成员的 shard 交接后 resume
+	b := start("b")
+	defer b.Stop()
+	owned := map[string][]uint32{}
+	for i := uint32(0); i < shards; i++ {
+		owner := remote.ShardOwner([]string{"a", "b"}, i)
+		owned[owner] = append(owned[owner], i)
+	}
+	if len(owned["b"]) == 0 {
+		t.Fatal("member b should own some shards")
+	}
+	waitShards(map[*remote.Manager][]uint32{a: owned["a"], b: owned["b"]})
+	if s.Identifies() != shards {
+		t.Errorf("got %d identifies, want %d", s.Identifies(), shards)
+	}
+	if s.Resumes() != len(owned["b"]) {
+		t.Errorf("got %d resumes, want %d", s.Resumes(), len(owned["b"]))
+	}
+
+	// 成员离开，shard 交还给剩下的成员
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, testTimeout)
+	defer shutdownCancel()
+	if err := b.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	waitShards(map[*remote.Manager][]uint32{a: {0, 1, 2, 3}})
+	if s.Identifies() != shards {
+		t.Errorf("got %d identifies after member left, want %d", s.Identifies(), shards)
+	}
+}
+
+func equalShards(got, want []uint32) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
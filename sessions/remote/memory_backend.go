@@ -0,0 +1,267 @@
+package remote
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+)
+
+var _ Backend = (*MemoryBackend)(nil)
+
+// MemoryBackend 基于内存的协调服务，同一个进程内使用同一个 MemoryBackend 的 manager 组成一个集群，用于测试
+type MemoryBackend struct {
+	lock     sync.Mutex
+	queues   map[string]*memoryQueue
+	leases   map[string]*memoryLeaseState
+	fencing  map[string]uint64
+	stores   map[string]*manager.MemoryStore
+	limiters map[string]*manager.MemoryLimiter
+	members  map[string]map[string]time.Time // 集群的成员与过期时间
+	shards   map[string][]uint32             // 集群正在运行的 shard 数量
+	overlaps map[string]*dedup.MemoryStore
+}
+
+// NewMemoryBackend 创建基于内存的协调服务
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		queues:   map[string]*memoryQueue{},
+		leases:   map[string]*memoryLeaseState{},
+		fencing:  map[string]uint64{},
+		stores:   map[string]*manager.MemoryStore{},
+		limiters: map[string]*manager.MemoryLimiter{},
+		members:  map[string]map[string]time.Time{},
+		shards:   map[string][]uint32{},
+		overlaps: map[string]*dedup.MemoryStore{},
+	}
+}
+
+// Queue 返回 key 对应的内存队列
+func (b *MemoryBackend) Queue(key string) Queue {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	q, ok := b.queues[key]
+	if !ok {
+		q = &memoryQueue{signal: make(chan struct{})}
+		b.queues[key] = q
+	}
+	return q
+}
+
+// Lease 返回 key 对应的内存锁
+func (b *MemoryBackend) Lease(key, owner string) Lease {
+	return &memoryLease{backend: b, key: key, owner: owner}
+}
+
+// Store 返回集群共享的 manager.MemoryStore
+func (b *MemoryBackend) Store(clusterKey string) manager.SessionStore {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s, ok := b.stores[clusterKey]
+	if !ok {
+		s = manager.NewMemoryStore()
+		b.stores[clusterKey] = s
+	}
+	return s
+}
+
+// Limiter 返回集群共享的 manager.MemoryLimiter
+func (b *MemoryBackend) Limiter(clusterKey string) manager.SessionLimiter {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	l, ok := b.limiters[clusterKey]
+	if !ok {
+		l = manager.NewMemoryLimiter()
+		b.limiters[clusterKey] = l
+	}
+	return l
+}
+
+// Registry 返回集群的内存成员注册表
+func (b *MemoryBackend) Registry(clusterKey string) Registry {
+	return &memoryRegistry{backend: b, key: clusterKey}
+}
+
+// ShardSet 返回集群正在运行的 shard 数量的内存记录
+func (b *MemoryBackend) ShardSet(clusterKey string) ShardSet {
+	return &memoryShardSet{backend: b, key: clusterKey}
+}
+
+// Overlap 返回集群共享的 dedup.MemoryStore
+func (b *MemoryBackend) Overlap(clusterKey string) dedup.Store {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	o, ok := b.overlaps[clusterKey]
+	if !ok {
+		o = dedup.NewMemoryStore()
+		b.overlaps[clusterKey] = o
+	}
+	return o
+}
+
+// memoryQueue 先进先出的内存队列，放入数据时关闭 signal 唤醒等待的 Pop
+type memoryQueue struct {
+	lock   sync.Mutex
+	items  [][]byte
+	signal chan struct{}
+}
+
+func (q *memoryQueue) Push(_ context.Context, data []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.items = append(q.items, data)
+	close(q.signal)
+	q.signal = make(chan struct{})
+	return nil
+}
+
+func (q *memoryQueue) Pop(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		q.lock.Lock()
+		if len(q.items) > 0 {
+			data := q.items[0]
+			q.items = q.items[1:]
+			q.lock.Unlock()
+			return data, nil
+		}
+		signal := q.signal
+		q.lock.Unlock()
+		select {
+		case <-signal:
+		case <-timer.C:
+			return nil, ErrQueueEmpty
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *memoryQueue) Clear(_ context.Context) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.items = nil
+	return nil
+}
+
+// memoryLeaseState 锁当前的持有者与到期时间
+type memoryLeaseState struct {
+	owner    string
+	expireAt time.Time
+}
+
+type memoryLease struct {
+	backend *MemoryBackend
+	key     string
+	owner   string
+	token   uint64
+}
+
+// held 返回锁当前有效的持有状态，调用方需要持有 backend 的锁
+func (l *memoryLease) held() *memoryLeaseState {
+	state, ok := l.backend.leases[l.key]
+	if !ok || time.Now().After(state.expireAt) {
+		return nil
+	}
+	return state
+}
+
+func (l *memoryLease) Lock(_ context.Context, ttl time.Duration) error {
+	l.backend.lock.Lock()
+	defer l.backend.lock.Unlock()
+	if state := l.held(); state != nil {
+		return ErrLeaseHeld
+	}
+	l.backend.leases[l.key] = &memoryLeaseState{owner: l.owner, expireAt: time.Now().Add(ttl)}
+	l.backend.fencing[l.key]++
+	l.token = l.backend.fencing[l.key]
+	return nil
+}
+
+func (l *memoryLease) Token() uint64 {
+	l.backend.lock.Lock()
+	defer l.backend.lock.Unlock()
+	return l.token
+}
+
+func (l *memoryLease) Renew(_ context.Context, ttl time.Duration) error {
+	l.backend.lock.Lock()
+	defer l.backend.lock.Unlock()
+	state := l.held()
+	if state == nil || state.owner != l.owner {
+		return ErrLeaseLost
+	}
+	state.expireAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (l *memoryLease) Release(_ context.Context) error {
+	l.backend.lock.Lock()
+	defer l.backend.lock.Unlock()
+	if state := l.held(); state != nil && state.owner == l.owner {
+		delete(l.backend.leases, l.key)
+	}
+	return nil
+}
+
+type memoryRegistry struct {
+	backend *MemoryBackend
+	key     string
+}
+
+func (g *memoryRegistry) Heartbeat(_ context.Context, member string, ttl time.Duration) error {
+	g.backend.lock.Lock()
+	defer g.backend.lock.Unlock()
+	members, ok := g.backend.members[g.key]
+	if !ok {
+		members = map[string]time.Time{}
+		g.backend.members[g.key] = members
+	}
+	members[member] = time.Now().Add(ttl)
+	return nil
+}
+
+func (g *memoryRegistry) Leave(_ context.Context, member string) error {
+	g.backend.lock.Lock()
+	defer g.backend.lock.Unlock()
+	delete(g.backend.members[g.key], member)
+	return nil
+}
+
+func (g *memoryRegistry) Members(_ context.Context) ([]string, error) {
+	g.backend.lock.Lock()
+	defer g.backend.lock.Unlock()
+	now := time.Now()
+	var alive []string
+	for member, expireAt := range g.backend.members[g.key] {
+		if now.After(expireAt) {
+			delete(g.backend.members[g.key], member)
+			continue
+		}
+		alive = append(alive, member)
+	}
+	sort.Strings(alive)
+	return alive, nil
+}
+
+type memoryShardSet struct {
+	backend *MemoryBackend
+	key     string
+}
+
+func (s *memoryShardSet) Load(_ context.Context) ([]uint32, error) {
+	s.backend.lock.Lock()
+	defer s.backend.lock.Unlock()
+	return append([]uint32(nil), s.backend.shards[s.key]...), nil
+}
+
+func (s *memoryShardSet) Store(_ context.Context, counts []uint32) error {
+	s.backend.lock.Lock()
+	defer s.backend.lock.Unlock()
+	s.backend.shards[s.key] = append([]uint32(nil), counts...)
+	return nil
+}
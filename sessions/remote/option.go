@@ -1,11 +1,96 @@
 package remote
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tencent-connect/botgo/log"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
 // Option is a function that configures a Remote.
-type Option func(manager *RedisManager)
+type Option func(manager *Manager)
 
-// WithClusterKey 自定义集群key，用于创建分布式锁与redis list
+// WithClusterKey 自定义集群key，用于创建分布式锁与 session 队列
 func WithClusterKey(key string) Option {
-	return func(m *RedisManager) {
+	return func(m *Manager) {
 		m.clusterKey = key
 	}
 }
+
+// WithWebsocket 指定创建连接使用的 websocket 实现，不指定时使用全局注册的 websocket.ClientImpl
+func WithWebsocket(ws websocket.WebSocket) Option {
+	return func(m *Manager) {
+		m.ws = ws
+	}
+}
+
+// WithLogger 指定 manager 使用的 logger，不指定时使用全局的 log.DefaultLogger
+func WithLogger(logger log.Logger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// WithSessionStore 指定保存 session 状态的 store，不指定时使用 Backend 提供的 store
+func WithSessionStore(store manager.SessionStore) Option {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// WithCheckpointInterval 指定定期保存 session 状态的间隔，小于等于 0 时只在 ready 与连接断开时保存
+func WithCheckpointInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.checkpointInterval = interval
+	}
+}
+
+// WithSessionLimiter 指定 session 启动次数限制的记录方式，不指定时使用 Backend 提供的 limiter，集群内共享
+func WithSessionLimiter(limiter manager.SessionLimiter) Option {
+	return func(m *Manager) {
+		m.limiter = limiter
+	}
+}
+
+// WithBackoff 指定重连的退避策略，不指定时使用 manager.DefaultBackoffPolicy
+// 退避期间实例持有 shard 锁，集群内的其他实例不会提前重连该 shard
+func WithBackoff(policy manager.BackoffPolicy) Option {
+	return func(m *Manager) {
+		m.backoff = manager.NewBackoff(policy)
+	}
+}
+
+// WithFatalHandler 指定遇到不能 identify 的错误时的处理方式，不指定时停止 manager，Start 返回 manager.FatalError
+func WithFatalHandler(handler manager.FatalHandler) Option {
+	return func(m *Manager) {
+		m.onFatal = handler
+	}
+}
+
+// WithShardAssignment 按照成员分配 shard，每个实例使用 memberID 注册到 Backend 并定期心跳，memberID 为空时随机生成
+// shard 使用 rendezvous hashing 分配给成员，成员加入或者离开时只移动归属变化的 shard，交接后由新的成员 resume
+// 不指定时所有实例竞争同一个 session 队列
+func WithShardAssignment(memberID string) Option {
+	return func(m *Manager) {
+		if memberID == "" {
+			memberID = uuid.NewString()
+		}
+		m.memberID = memberID
+	}
+}
+
+// WithMemberTTL 指定成员心跳的过期时间，默认为 15s，超过该时间没有心跳的成员的 shard 会被其他成员认领
+func WithMemberTTL(ttl time.Duration) Option {
+	return func(m *Manager) {
+		m.memberTTL = ttl
+	}
+}
+
+// WithOverlapWindow 指定重新分片时过滤重复事件的窗口，旧的 shard 下线后继续过滤的时长，默认为 manager.DefaultOverlapWindow
+func WithOverlapWindow(window time.Duration) Option {
+	return func(m *Manager) {
+		m.overlapWindow = window
+	}
+}
@@ -0,0 +1,142 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/sessions/remote/lock"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+)
+
+var _ Backend = (*RedisBackend)(nil)
+
+// RedisBackend 基于 redis 的协调服务，队列使用 redis list，锁使用 lock.Lock
+type RedisBackend struct {
+	client *redis.Client
+}
+
+// NewRedisBackend 创建基于 redis 的协调服务，超时时间请在 NewClient 时候设置
+func NewRedisBackend(client *redis.Client) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+// Queue 返回基于 redis list 的队列
+func (b *RedisBackend) Queue(key string) Queue {
+	return &redisQueue{client: b.client, key: key}
+}
+
+// Lease 返回基于 redis 的锁
+func (b *RedisBackend) Lease(key, owner string) Lease {
+	return lock.New(key, owner, b.client)
+}
+
+// Store 返回基于 redis 的 SessionStore，使用默认的过期时间
+func (b *RedisBackend) Store(clusterKey string) manager.SessionStore {
+	return NewRedisStore(b.client, clusterKey, 0)
+}
+
+// Limiter 返回基于 redis 的 SessionLimiter
+func (b *RedisBackend) Limiter(clusterKey string) manager.SessionLimiter {
+	return NewRedisLimiter(b.client, clusterKey)
+}
+
+// Registry 返回基于 redis sorted set 的成员注册表
+func (b *RedisBackend) Registry(clusterKey string) Registry {
+	return &redisRegistry{client: b.client, key: fmt.Sprintf("%s_members", clusterKey)}
+}
+
+// ShardSet 返回基于 redis 的 shard 数量记录
+func (b *RedisBackend) ShardSet(clusterKey string) ShardSet {
+	return &redisShardSet{client: b.client, key: fmt.Sprintf("%s_shards", clusterKey)}
+}
+
+// Overlap 返回基于 redis 的事件记录
+func (b *RedisBackend) Overlap(clusterKey string) dedup.Store {
+	return dedup.NewRedisStore(b.client, fmt.Sprintf("%s_overlap", clusterKey))
+}
+
+// redisQueue 基于 redis list 的队列，LPush 放入，BRPop 取出
+type redisQueue struct {
+	client *redis.Client
+	key    string
+}
+
+func (q *redisQueue) Push(ctx context.Context, data []byte) error {
+	return q.client.LPush(ctx, q.key, data).Err()
+}
+
+func (q *redisQueue) Pop(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	// brpop 返回 key value
+	data, err := q.client.BRPop(ctx, timeout, q.key).Result()
+	if err == redis.Nil {
+		return nil, ErrQueueEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, ErrQueueEmpty
+	}
+	return []byte(data[1]), nil
+}
+
+func (q *redisQueue) Clear(ctx context.Context) error {
+	return q.client.Del(ctx, q.key).Err()
+}
+
+// redisRegistry 基于 redis sorted set 的成员注册表，score 为成员的过期时间
+type redisRegistry struct {
+	client *redis.Client
+	key    string
+}
+
+func (g *redisRegistry) Heartbeat(ctx context.Context, member string, ttl time.Duration) error {
+	expireAt := float64(time.Now().Add(ttl).UnixNano() / int64(time.Millisecond))
+	return g.client.ZAdd(ctx, g.key, &redis.Z{Score: expireAt, Member: member}).Err()
+}
+
+func (g *redisRegistry) Leave(ctx context.Context, member string) error {
+	return g.client.ZRem(ctx, g.key, member).Err()
+}
+
+func (g *redisRegistry) Members(ctx context.Context) ([]string, error) {
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	if err := g.client.ZRemRangeByScore(ctx, g.key, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	return g.client.ZRange(ctx, g.key, 0, -1).Result()
+}
+
+// redisShardSet 使用 json 数组保存 shard 数量
+type redisShardSet struct {
+	client *redis.Client
+	key    string
+}
+
+func (s *redisShardSet) Load(ctx context.Context) ([]uint32, error) {
+	data, err := s.client.Get(ctx, s.key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var counts []uint32
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (s *redisShardSet) Store(ctx context.Context, counts []uint32) error {
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key, data, 0).Err()
+}
@@ -1,18 +1,19 @@
-// Package remote 基于 redis list 实现的分布式 session manager。
+// Package remote 分布式 session manager，通过 Backend 在集群内分发 session，内置 redis 与内存的实现。
 package remote
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
 	"github.com/tencent-connect/botgo/log"
 	"github.com/tencent-connect/botgo/sessions/manager"
-	"github.com/tencent-connect/botgo/sessions/remote/lock"
 	"github.com/tencent-connect/botgo/token"
 	"github.com/tencent-connect/botgo/websocket"
 )
@@ -26,99 +27,431 @@ const (
 	distributeLockExpireTime = 60 * time.Second
 	// 每个不同的shard实例的分布式锁，用于避免同个 shard 被启动多个实例
 	shardLockExpireTime = 30 * time.Second
+	// 默认保存 session 状态的间隔
+	defaultCheckpointInterval = 10 * time.Second
 )
 
-// RedisManager 基于 redis 的 session 管理器，实现分布式 websocket 监听
-type RedisManager struct {
+var _ manager.StatusProvider = (*Manager)(nil)
+
+// Manager 分布式的 session 管理器，实现分布式 websocket 监听，session 队列与锁由 Backend 提供
+type Manager struct {
 	clusterKey         string
 	sessionQueueKey    string
-	client             *redis.Client
-	sessionProduceChan chan dto.Session // 抢到锁的服务，用于持续生产session到redis list的本地chan
+	backend            Backend
+	queue              Queue
+	sessionProduceChan chan dto.Session       // 抢到锁的服务，用于持续生产session到队列的本地chan
+	ws                 websocket.WebSocket    // 为空时使用全局注册的 websocket.ClientImpl
+	logger             log.Logger             // 为空时使用全局的 log.DefaultLogger
+	store              manager.SessionStore   // 保存 session 状态，用于进程退出后由其他实例 resume
+	checkpointInterval time.Duration          // 保存 session 状态的间隔
+	handlers           *dto.EventParse        // 从队列中读取的 session 不包含 handler，需要重新设置
+	limiter            manager.SessionLimiter // session 启动次数限制，集群内共享
+	backoff            *manager.Backoff       // 按照 shard 计算重连的等待时间
+	onFatal            manager.FatalHandler   // 遇到不能 identify 的错误时的处理方式，为空时停止 manager
+	status             manager.StatusTracker  // 本实例管理的 shard 的连接状态
+	memberID           string                 // 不为空时按照成员分配 shard
+	memberTTL          time.Duration          // 成员心跳的过期时间
+	assign             *assignment            // 按照成员分配 shard 的状态，为空时所有实例竞争同一个 session 队列
+	shardSet           ShardSet               // 集群正在运行的 shard 数量，重新分片时通知所有实例
+	overlapWindow      time.Duration          // 重新分片时过滤重复事件的窗口
+	overlap            *manager.OverlapFilter // 重新分片期间过滤新旧两组 shard 重复收到的事件，集群内共享记录
+
+	lock        sync.Mutex
+	isStop      bool
+	stop        chan struct{}
+	clients     map[dto.ShardConfig]*shardConn // 本实例正在监听的连接
+	err         error                          // 导致 manager 停止的错误，由 Start 返回
+	url         string                         // 新的 shard 使用的接入地址
+	botToken    token.Token                    // 新的 shard 使用的 token
+	shardCount  uint32                         // 当前的 shard 数量，重新分片期间为旧的数量
+	shardCounts map[uint32]bool                // 正在运行的 shard 数量，重新分片期间新旧两组 shard 同时运行
+	overlapping bool                           // 本实例是否已经开始过滤重复的事件
+}
+
+// shardConn 正在监听的连接与对应 shard 的锁
+type shardConn struct {
+	ws        websocket.WebSocket
+	shardLock *heldLease
 }
 
+// RedisManager 基于 redis 的 session 管理器，与使用 RedisBackend 的 Manager 相同，保留用于兼容
+type RedisManager = Manager
+
 // New 创建一个新的基于 redis 的 session 管理器
 // 使用 go-redis 调用 redis，超时时间请在 NewClient 时候设置
 func New(client *redis.Client, opts ...Option) *RedisManager {
-	r := &RedisManager{
-		clusterKey: defaultClusterKey,
-		client:     client,
+	return NewManager(NewRedisBackend(client), opts...)
+}
+
+// NewManager 创建使用指定协调服务的 session 管理器
+func NewManager(backend Backend, opts ...Option) *Manager {
+	r := &Manager{
+		clusterKey:         defaultClusterKey,
+		backend:            backend,
+		checkpointInterval: defaultCheckpointInterval,
 	}
 	for _, opt := range opts {
 		opt(r)
 	}
 	// 针对不同的分布式key，设置不同的 queue key
 	r.sessionQueueKey = fmt.Sprintf("%s_%s", r.clusterKey, sessionQueueSuffix)
+	r.queue = backend.Queue(r.sessionQueueKey)
+	if r.store == nil {
+		r.store = backend.Store(r.clusterKey)
+	}
+	if r.limiter == nil {
+		r.limiter = backend.Limiter(r.clusterKey)
+	}
+	if r.backoff == nil {
+		r.backoff = manager.NewBackoff(manager.DefaultBackoffPolicy)
+	}
+	if r.memberID != "" {
+		if r.memberTTL <= 0 {
+			r.memberTTL = defaultMemberTTL
+		}
+		r.assign = &assignment{memberID: r.memberID, ttl: r.memberTTL, registry: backend.Registry(r.clusterKey)}
+		r.queue = r.memberQueue(r.memberID)
+	}
+	r.shardSet = backend.ShardSet(r.clusterKey)
+	r.overlap = manager.NewStoreOverlapFilter(backend.Overlap(r.clusterKey), r.overlapWindow)
 	return r
 }
 
-// Start 启动 redis 的 session 管理器
-func (r *RedisManager) Start(ctx context.Context, apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error {
-	defer log.Sync()
+// wsImpl 返回用于创建连接的 websocket 实现
+func (r *Manager) wsImpl() websocket.WebSocket {
+	if r.ws != nil {
+		return r.ws
+	}
+	return websocket.ClientImpl
+}
+
+// log 返回 manager 使用的 logger
+func (r *Manager) log() log.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return log.DefaultLogger
+}
+
+// Start 启动分布式的 session 管理器，遇到不能 identify 的错误并且没有通过 WithFatalHandler 选择重试时，返回 manager.FatalError
+func (r *Manager) Start(ctx context.Context, apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error {
+	defer func() {
+		_ = r.log().Sync()
+	}()
+	if err := r.limiter.Update(ctx, apInfo.SessionStartLimit); err != nil {
+		r.log().Errorf("[ws/session/remote] update session limit failed, err: %v", err)
+	}
+	// 次数不足时不退出，连接在 identify 之前会等待次数重置
 	if err := manager.CheckSessionLimit(apInfo); err != nil {
-		log.Errorf("[ws/session/redis] session limited apInfo: %+v", apInfo)
-		return err
+		wait := manager.ResetAfter(apInfo.SessionStartLimit)
+		r.log().Warnf("[ws/session/remote] session limited apInfo: %+v, will wait %s for reset", apInfo, wait)
+		handlers.NotifyError(manager.SessionLimitError(wait))
 	}
 	startInterval := manager.CalcInterval(apInfo.SessionStartLimit.MaxConcurrency)
-	log.Infof("[ws/session/redis] will start %d sessions and per session start interval is %s",
+	r.log().Infof("[ws/session/remote] will start %d sessions and per session start interval is %s",
 		apInfo.Shards, startInterval)
 
 	// session 生产队列
 	r.sessionProduceChan = make(chan dto.Session, apInfo.Shards)
+	handlers = r.checkpointOnReady(handlers)
+	r.handlers = handlers.Filter(r.overlap.Accept)
+	r.lock.Lock()
+	r.stop = make(chan struct{})
+	r.isStop = false
+	r.err = nil
+	r.clients = map[dto.ShardConfig]*shardConn{}
+	r.url, r.botToken = apInfo.URL, *token
+	r.shardCount = apInfo.Shards
+	r.shardCounts = map[uint32]bool{apInfo.Shards: true}
+	overlapping := r.overlapping
+	r.overlapping = false
+	stop := r.stop
+	r.lock.Unlock()
+	if overlapping {
+		// 上一次运行停止时还在重新分片
+		r.overlap.End()
+	}
+	r.status.Reset()
+	go r.shardSetLoop(stop)
+
+	if r.assign != nil {
+		// 按照成员分配 shard 时不需要初次分发，每个实例认领属于自己的 shard
+		// 集群已经记录 shard 数量时使用记录的数量，新加入的实例与重新分片后的集群保持一致
+		r.assign.reset()
+		r.initShards(ctx, apInfo.Shards)
+		r.joinCluster(ctx)
+		go r.membershipLoop(apInfo, token, startInterval, stop)
+		go r.sessionProducer(startInterval, r.sessionProduceChan, stop)
+		return r.consume(startInterval, stop)
+	}
 
 	// 进行初始的session分发，抢锁，分发
 	// 锁60s，抢到锁的进程，需要每30s续期一次，只要自己还存活，就不能够让另外的进程抢到锁重新进行shards分发
-	distributeLock := lock.New(r.clusterKey, uuid.New().String(), r.client)
-	if err := distributeLock.Lock(ctx, distributeLockExpireTime); err == nil {
-		log.Infof("[ws/session/redis] got distribute lock! i will do distributeSession, key: %s", r.clusterKey)
+	distributeLease := r.backend.Lease(r.clusterKey, uuid.New().String())
+	if _, err := acquire(ctx, distributeLease, distributeLockExpireTime, r.log()); err == nil {
+		r.log().Infof("[ws/session/remote] got distribute lock! i will do distributeSession, key: %s", r.clusterKey)
 		// 抢到锁的进行初次分发
 		if err = r.distributeSession(apInfo, token, handlers); err != nil {
-			log.Errorf("[ws/session/redis] distribute sessions failed: %v", err)
+			r.log().Errorf("[ws/session/remote] distribute sessions failed: %v", err)
 			return err
 		}
-		go distributeLock.StartRenew(ctx, distributeLockExpireTime)
 	} else {
-		log.Errorf("got lock failed, err: %v", err)
+		r.log().Errorf("got lock failed, err: %v", err)
 	}
 
 	// 持续 produce session，遇到网络问题在 chan 中重试
-	// 对于抢到了锁的服务，生产第一批session到redis list
-	// 对于没有抢到锁的服务，当ws异常，把session放回到 redis list 中，重新分发
-	go r.sessionProducer(startInterval)
+	// 对于抢到了锁的服务，生产第一批session到 session 队列
+	// 对于没有抢到锁的服务，当ws异常，把session放回到 session 队列 中，重新分发
+	go r.sessionProducer(startInterval, r.sessionProduceChan, stop)
+
+	return r.consume(startInterval, stop)
+}
 
-	return r.consume(startInterval)
+// Stop 停止消费 session，已有的连接不会被关闭，需要等待事件处理完成并交还 session 请使用 Shutdown
+func (r *Manager) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.isStop && r.stop != nil {
+		close(r.stop)
+		r.isStop = true
+	}
 }
 
-func (r *RedisManager) consume(startInterval time.Duration) error {
-	log.Debug("[ws/session/redis] start consume for session")
+// Status 返回 manager 当前的状态快照，只包含本实例持有 shard 锁的 shard
+func (r *Manager) Status() manager.Status {
+	r.lock.Lock()
+	status := manager.Status{Running: r.stop != nil && !r.isStop}
+	if r.err != nil {
+		status.Error = r.err.Error()
+	}
+	r.lock.Unlock()
+	status.Shards = r.status.Shards()
+	return status
+}
+
+// fail 记录导致停止的错误并停止 manager，Start 返回该错误
+func (r *Manager) fail(err error) {
+	r.lock.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.lock.Unlock()
+	r.Stop()
+}
+
+// stopErr 返回导致 manager 停止的错误，调用 Stop 或者 Shutdown 停止时为空
+func (r *Manager) stopErr() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Shutdown 优雅关闭，停止读取新的事件，在 ctx 结束前等待已经读取的事件处理完成
+// 然后将带有 session id 与 seq 的 session 放回 session 队列 并释放 shard 锁，由其他实例 resume
+func (r *Manager) Shutdown(ctx context.Context) error {
+	r.Stop()
+	if r.assign != nil {
+		// 先离开集群，避免其他实例将交还的 session 转发回本实例
+		r.leaveCluster()
+	}
+	r.lock.Lock()
+	conns := make([]*shardConn, 0, len(r.clients))
+	for _, c := range r.clients {
+		conns = append(conns, c)
+	}
+	// 连接交由 Shutdown 处理
+	r.clients = map[dto.ShardConfig]*shardConn{}
+	r.lock.Unlock()
+
+	drainErrs := make(chan error, len(conns))
+	for _, c := range conns {
+		go func(c *shardConn) {
+			drainErrs <- manager.Drain(ctx, c.ws)
+		}(c)
+	}
+	var err error
+	for range conns {
+		if e := <-drainErrs; e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, c := range conns {
+		r.handOver(ctx, manager.Checkpoint(c.ws), c.shardLock)
+	}
+	return err
+}
+
+// closeAll 等待其他连接已经读取的事件处理完成后关闭连接并交还 session，最多等待 manager.FatalDrainTimeout
+func (r *Manager) closeAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.FatalDrainTimeout)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		r.log().Errorf("[ws/session/remote] drain sessions failed, err: %v", err)
+	}
+}
+
+// handOver 保存 session 状态，释放 shard 锁并将 session 放回 session 队列
+func (r *Manager) handOver(ctx context.Context, session dto.Session, shardLock *heldLease) {
+	if r.leaseLost(session, shardLock) {
+		return
+	}
+	r.checkpoint(session)
+	// 先释放锁，取到 session 的实例可以立即获取锁
+	r.release(ctx, session, shardLock)
+	if err := r.produce(session); err != nil {
+		r.log().Errorf("[ws/session/remote] hand over session failed, err: %v", err)
+	}
+}
+
+// leaseLost shard 锁已经丢失时不再管理该 shard，不保存状态也不放回队列，避免覆盖新的持有者
+func (r *Manager) leaseLost(session dto.Session, shardLock *heldLease) bool {
+	if !shardLock.isLost() {
+		return false
+	}
+	r.log().Errorf("[ws/session/remote] %s shard lock lost, token %d, err: %v", &session, shardLock.Token(), shardLock.lostErr)
+	r.status.Release(session.Shards.ShardID, session.Shards.ShardCount)
+	return true
+}
+
+// watchLease shard 锁丢失时关闭连接，避免与新的持有者同时消费同一个 shard，直到 end 被关闭
+func (r *Manager) watchLease(ws websocket.WebSocket, shardLock *heldLease, end chan struct{}) {
+	select {
+	case <-shardLock.lost:
+		ws.Session().Handlers.NotifyError(errs.New(errs.CodeLeaseLost,
+			fmt.Sprintf("shard lock lost, token %d, err: %v", shardLock.Token(), shardLock.lostErr)))
+		ws.Close()
+	case <-end:
+	}
+}
+
+// release 停止续期并释放 shard 锁
+func (r *Manager) release(ctx context.Context, session dto.Session, shardLock *heldLease) {
+	r.status.Release(session.Shards.ShardID, session.Shards.ShardCount)
+	if err := shardLock.release(ctx); err != nil {
+		r.log().Errorf("[ws/session/remote] release shardLock failed, err: %s", err)
+	}
+}
+
+// retry 持有 shard 锁按照 shard 的退避时间等待，避免其他实例立即重连，然后释放锁并将 session 放回 session 队列 重新分发
+// 等待期间 manager 停止时不再等待，直接放回 session 队列
+func (r *Manager) retry(ctx context.Context, session dto.Session, shardLock *heldLease, reason error) {
+	if r.leaseLost(session, shardLock) {
+		return
+	}
+	delay := r.backoff.Next(session.Shards.ShardID)
+	r.log().Warnf("[ws/session/remote] %s will reconnect after %s, reason: %v", &session, delay, reason)
+	r.lock.Lock()
+	stop := r.stop
+	r.lock.Unlock()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+	r.release(ctx, session, shardLock)
+	r.requeue(session)
+}
+
+// requeue 将 session 放入 sessionProduceChan 重新分发，manager 停止后没有协程读取 chan，直接放回 session 队列
+func (r *Manager) requeue(session dto.Session) {
+	r.lock.Lock()
+	stop := r.stop
+	r.lock.Unlock()
+	select {
+	case <-stop:
+	default:
+		select {
+		case r.sessionProduceChan <- session:
+			return
+		case <-stop:
+		}
+	}
+	if err := r.produce(session); err != nil {
+		r.log().Errorf("[ws/session/remote] requeue session failed, err: %v", err)
+	}
+}
+
+// track 记录正在监听的连接，manager 已经停止或者 shard 已经因为重新分片下线时返回 false
+func (r *Manager) track(c *shardConn) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	shard := c.ws.Session().Shards
+	if r.isStop || !r.shardCounts[shard.ShardCount] {
+		return false
+	}
+	r.clients[shard] = c
+	return true
+}
+
+// untrack 移除连接，返回连接是否已经交由 Shutdown 处理，以及 manager 是否已经停止
+func (r *Manager) untrack(c *shardConn) (owned bool, stopped bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	shard := c.ws.Session().Shards
+	if r.clients[shard] != c {
+		return true, r.isStop
+	}
+	delete(r.clients, shard)
+	return false, r.isStop
+}
+
+func (r *Manager) consume(startInterval time.Duration, stop chan struct{}) error {
+	r.log().Debug("[ws/session/remote] start consume for session")
 	for {
-		// brpop 返回 key value
-		data, err := r.client.BRPop(context.Background(), startInterval*2, r.sessionQueueKey).Result()
-		if err != nil {
-			if err != redis.Nil {
-				log.Errorf("[ws/session/redis] rpop failed, err: %v", err)
+		select {
+		case <-stop:
+			err := r.stopErr()
+			if err != nil {
+				// 因为错误停止时关闭其他 shard 的连接，交还给其他实例
+				r.closeAll()
 			}
-			continue
+			return err
+		default:
 		}
-		if len(data) < 2 {
-			log.Errorf("[ws/session/redis] data is not valid, data: %+v", data)
+		data, err := r.queue.Pop(context.Background(), startInterval*2)
+		if err != nil {
+			if err != ErrQueueEmpty {
+				r.log().Errorf("[ws/session/remote] pop session failed, err: %v", err)
+			}
 			continue
 		}
-		log.Debugf("[ws/session/redis] consume data: %s", data)
+		r.log().Debugf("[ws/session/remote] consume data: %s", data)
 
 		session := &dto.Session{}
-		if err := json.Unmarshal([]byte(data[1]), session); err != nil {
+		if err := json.Unmarshal(data, session); err != nil {
 			// 解析出错，不放回去，直接丢弃
-			log.Errorf("[ws/session/redis] unmarshal session failed, err: %v", err)
+			r.log().Errorf("[ws/session/remote] unmarshal session failed, err: %v", err)
 			continue
 		}
 
-		go r.newConnect(*session)
+		if r.retired(session.Shards) {
+			r.log().Infof("[ws/session/remote] %s is retired by reshard, drop it", session)
+			continue
+		}
+		if r.assign != nil && !r.accept(*session) {
+			continue
+		}
+		session.Handlers = r.handlers
+		// 新分发的 session 没有 id，使用保存的状态 resume
+		if session.ID == "" {
+			r.restore(session)
+		}
+		go r.connect(*session)
 		time.Sleep(startInterval) // 启动一个连接后，等待一下，避免触发服务端的并发控制
 	}
 }
 
+// connect 启动连接，按照成员分配 shard 时在连接退出后标记 shard 不再连接
+func (r *Manager) connect(session dto.Session) {
+	if r.assign != nil {
+		defer r.assign.done(session.Shards)
+	}
+	r.newConnect(session)
+}
+
 // getShardLockKey 获取 shard 的锁
-func (r *RedisManager) getShardLockKey(session dto.Session) string {
+func (r *Manager) getShardLockKey(session dto.Session) string {
 	return fmt.Sprintf("%s_shard_%d_%d",
 		r.clusterKey, session.Shards.ShardID, session.Shards.ShardCount)
 }
@@ -127,24 +460,42 @@ func (r *RedisManager) getShardLockKey(session dto.Session) string {
 // 如果能够 resume，则往 sessionChan 中放入带有 sessionID 的 session
 // 如果不能，则清理掉 sessionID，将 session 放入 sessionChan 中
 // session 的启动，交给 start 中的 for 循环执行，session 不自己递归进行重连，避免递归深度过深
-func (r *RedisManager) newConnect(session dto.Session) {
+func (r *Manager) newConnect(session dto.Session) {
 	ctx := context.Background()
 	// 锁 shard，避免针对相同 shard 消费重复了
-	shardLock := lock.New(r.getShardLockKey(session), uuid.NewString(), r.client)
-	if err := shardLock.Lock(ctx, shardLockExpireTime); err != nil {
+	shardLock, err := acquire(ctx, r.backend.Lease(r.getShardLockKey(session), uuid.NewString()), shardLockExpireTime, r.log())
+	if err != nil {
+		if r.assign != nil {
+			// 按照成员分配 shard 时，锁的持有者交接后会将 session 放入本实例的队列，持有者崩溃时锁过期后重新认领
+			r.log().Warnf("[ws/session/remote] %s shard lock is held, wait for hand off, err: %v", &session, err)
+			return
+		}
 		// shard 抢锁失败，把 session 放回去，避免上一个 session 的锁释放失败，导致下一个 session 无法启动
-		r.sessionProduceChan <- session
+		r.requeue(session)
 		return
 	}
-	go shardLock.StartRenew(ctx, shardLockExpireTime)
+	r.status.Add(session.Shards.ShardID, session.Shards.ShardCount)
+	// 连接收到的事件带有 fencing token，业务可以用来拒绝锁已经过期的实例的写入
+	session.FencingToken = shardLock.Token()
 
-	wsClient := websocket.ClientImpl.New(session)
+	// identify 需要消耗集群共享的启动次数，次数不足时在建立连接之前等待重置
+	if session.ID == "" {
+		if err := r.waitIdentify(ctx, session); err == manager.ErrManagerStopped {
+			r.handOver(ctx, session, shardLock)
+			return
+		} else if err != nil {
+			r.log().Errorf("[ws/session/remote] wait session limit failed, err: %v", err)
+		}
+	}
+	wsClient := r.wsImpl().New(session)
 	if err := wsClient.Connect(); err != nil {
-		log.Error(err)
-		r.sessionProduceChan <- session // 连接失败，丢回去队列排队重连
+		// 连接失败，退避后丢回去队列排队重连
+		r.log().Error(err)
+		r.status.Failed(session.Shards.ShardID, session.Shards.ShardCount, err)
+		session.Handlers.NotifyError(errs.New(errs.CodeConnectFailed, fmt.Sprintf("connect failed: %v", err)))
+		r.retry(ctx, session, shardLock, err)
 		return
 	}
-	var err error
 	// 如果 session id 不为空，则执行的是 resume 操作，如果为空，则执行的是 identify 操作
 	if session.ID != "" {
 		err = wsClient.Resume()
@@ -153,29 +504,73 @@ func (r *RedisManager) newConnect(session dto.Session) {
 		err = wsClient.Identify()
 	}
 	if err != nil {
-		log.Errorf("[ws/session/remote] Identify/Resume err %+v", err)
+		// 鉴权没有发送成功，session 没有变化，退避后重新连接
+		r.log().Errorf("[ws/session/remote] Identify/Resume err %+v", err)
+		wsClient.Close()
+		r.status.Failed(session.Shards.ShardID, session.Shards.ShardCount, err)
+		session.Handlers.NotifyError(errs.New(errs.CodeConnectFailed, fmt.Sprintf("identify/resume failed: %v", err)))
+		r.retry(ctx, session, shardLock, err)
 		return
 	}
-	if err := wsClient.Listening(); err != nil {
-		log.Errorf("[ws/session/remote] Listening err %+v", err)
-		currentSession := wsClient.Session()
-		// 对于不能够进行重连的session，需要清空 session id 与 seq
-		if manager.CanNotResume(err) {
-			currentSession.ID = ""
-			currentSession.LastSeq = 0
-		}
-		// 一些错误不能够鉴权，比如机器人被封禁，这里就直接退出了
-		if manager.CanNotIdentify(err) {
-			msg := fmt.Sprintf("can not identify because server return %+v, so process exit", err)
-			log.Errorf(msg)
-			panic(msg) // 当机器人被下架，或者封禁，将不能再连接，所以 panic
-		}
-		// 将 session 放到 session chan 中，用于启动新的连接，释放锁，当前连接退出
-		shardLock.StopRenew()
-		if err := shardLock.Release(ctx); err != nil {
-			log.Errorf("[ws/session/remote] release shardLock failed, err: %s", err)
+	conn := &shardConn{ws: wsClient, shardLock: shardLock}
+	if !r.track(conn) {
+		wsClient.Close()
+		if r.retired(session.Shards) {
+			// 鉴权期间 shard 因为重新分片下线，不再交还
+			r.release(ctx, session, shardLock)
+			return
 		}
-		r.sessionProduceChan <- *currentSession
+		// 鉴权期间 manager 已经停止，交还 session
+		r.handOver(ctx, session, shardLock)
+		return
+	}
+	end := make(chan struct{})
+	go r.checkpointLoop(wsClient, end)
+	go r.watchLease(wsClient, shardLock, end)
+	r.status.Connected(wsClient)
+	connectedAt := time.Now()
+	err = wsClient.Listening()
+	close(end)
+	r.status.Disconnected(wsClient, err)
+	// 连接保持足够长的时间，之前的失败不再影响重连的等待时间
+	r.backoff.Healthy(session.Shards.ShardID, time.Since(connectedAt))
+	// manager 已经停止，不再重连，交还 session，Shutdown 处理的连接由 Shutdown 交还
+	if owned, stopped := r.untrack(conn); owned {
+		return
+	} else if stopped {
+		r.handOver(ctx, manager.Checkpoint(wsClient), shardLock)
 		return
 	}
+	if r.leaseLost(manager.Checkpoint(wsClient), shardLock) {
+		return
+	}
+	if err == nil {
+		// websocket 实现没有返回错误就退出了监听，按照需要重连处理，避免丢失 shard
+		err = errs.ErrNeedReConnect
+	}
+	r.log().Errorf("[ws/session/remote] Listening err %+v", err)
+	// 使用副本，连接的协程可能还在读取 session
+	currentSession := manager.Checkpoint(wsClient)
+	// 对于不能够进行重连的session，需要清空 session id 与 seq
+	if manager.CanNotResume(err) {
+		currentSession.ID = ""
+		currentSession.LastSeq = 0
+	}
+	// 一些错误不能够鉴权，比如机器人被下架或者封禁，默认停止 manager，由 Start 返回错误
+	if manager.CanNotIdentify(err) {
+		fatal := &manager.FatalError{Session: currentSession, Err: err}
+		r.log().Errorf("[ws/session/remote] %v", fatal)
+		if manager.HandleFatal(r.onFatal, fatal) == manager.FatalStop {
+			// 其他实例同样不能 identify，session 不再放回 session 队列
+			r.release(ctx, session, shardLock)
+			r.fail(fatal)
+			return
+		}
+		currentSession.ID = ""
+		currentSession.LastSeq = 0
+	}
+	// 保存最新的状态，不能 resume 时删除保存的状态
+	r.checkpoint(currentSession)
+	// 退避后将 session 放到 session chan 中，用于启动新的连接，释放锁，当前连接退出
+	r.retry(ctx, currentSession, shardLock, err)
 }
@@ -0,0 +1,290 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/sessions/remote/lock"
+)
+
+const (
+	// 读取集群 shard 数量的间隔，重新分片发起后等待这个时间再启动新的 shard，保证其他实例已经开始过滤重复的事件
+	shardSetInterval = time.Second
+	// 重新分片的分布式锁的过期时间，同一时间集群内只能有一个重新分片
+	reshardLockExpireTime = 60 * time.Second
+)
+
+var _ manager.Resharder = (*Manager)(nil)
+
+// Reshard 在运行中调整集群的 shard 数量，不需要重启集群，可以在任意一个实例上调用
+// 新的 shard 数量通过 Backend 通知所有实例，新的一组 shard 通过 session 队列分发，与旧的 shard 同时在线
+// 期间各个实例通过 Backend 共享的记录过滤重复的事件，过滤的窗口可以通过 WithOverlapWindow 修改
+// 只有消息与审核等带有自然 ID 的事件会被过滤，频道、成员变更等没有自然 ID 的事件在此期间可能被处理两次
+// 新的 shard 全部连接后，各个实例等待旧的连接已经读取的事件处理完成再关闭，释放旧的 shard 锁并删除保存的 session
+// ctx 结束前新的 shard 没有全部连接时，关闭新的 shard 并返回错误，旧的 shard 不受影响
+func (r *Manager) Reshard(ctx context.Context, shards uint32) error {
+	r.lock.Lock()
+	if r.stop == nil || r.isStop {
+		r.lock.Unlock()
+		return manager.ErrManagerStopped
+	}
+	stop := r.stop
+	current := r.shardCount
+	r.lock.Unlock()
+
+	reshardLock, err := acquire(ctx, r.backend.Lease(r.clusterKey+"_reshard", uuid.NewString()),
+		reshardLockExpireTime, r.log())
+	if err == ErrLeaseHeld || err == lock.ErrorNotOk {
+		return manager.ErrReshardInProgress
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reshardLock.release(context.Background())
+	}()
+	// 上一次重新分片的实例没有完成就退出时，记录中还有没有完成的 shard 数量，本次重新分片会将其下线
+	if counts, err := r.shardSet.Load(ctx); err != nil {
+		return err
+	} else if len(counts) > 0 {
+		current = counts[0]
+	}
+	if err := manager.CheckShards(current, shards); err != nil {
+		return err
+	}
+
+	r.log().Infof("[ws/session/remote] reshard from %d to %d shards", current, shards)
+	// 新的 shard 不使用上一次同样数量时留下的状态
+	r.clearStates(shards)
+	if err := r.publishShards(ctx, current, shards); err != nil {
+		return err
+	}
+	// 等待其他实例读取到新的 shard 数量，开始过滤重复的事件
+	if err := sleep(ctx, stop, shardSetInterval); err != nil {
+		r.abortReshard(current, shards)
+		return err
+	}
+	r.lock.Lock()
+	url, botToken := r.url, r.botToken
+	r.lock.Unlock()
+	for i := uint32(0); i < shards; i++ {
+		session := dto.Session{URL: url, Token: botToken, Shards: dto.ShardConfig{ShardID: i, ShardCount: shards}}
+		select {
+		case r.sessionProduceChan <- session:
+		case <-stop:
+			return manager.ErrManagerStopped
+		case <-ctx.Done():
+			r.abortReshard(current, shards)
+			return ctx.Err()
+		}
+	}
+	if err := r.waitShards(ctx, stop, shards); err != nil {
+		if err != manager.ErrManagerStopped {
+			r.abortReshard(current, shards)
+		}
+		return err
+	}
+	err = r.publishShards(context.Background(), shards)
+	// 没有被任何实例持有的旧的 shard 的状态也需要删除
+	r.clearStates(current)
+	r.log().Infof("[ws/session/remote] reshard to %d shards finished, %d duplicated events filtered",
+		shards, r.overlap.Hits())
+	return err
+}
+
+// abortReshard 新的 shard 没有全部连接，通知所有实例关闭新的 shard
+func (r *Manager) abortReshard(current, shards uint32) {
+	r.log().Errorf("[ws/session/remote] reshard to %d shards aborted", shards)
+	if err := r.publishShards(context.Background(), current); err != nil {
+		r.log().Errorf("[ws/session/remote] restore shard count failed, err: %v", err)
+	}
+	r.clearStates(shards)
+}
+
+// publishShards 记录集群正在运行的 shard 数量并在本实例生效，其他实例在下一次读取时生效
+func (r *Manager) publishShards(ctx context.Context, counts ...uint32) error {
+	if err := r.shardSet.Store(ctx, counts); err != nil {
+		return fmt.Errorf("store shard count failed: %w", err)
+	}
+	r.applyShards(counts)
+	return nil
+}
+
+// clearStates 删除 shard 数量为 shards 的所有 shard 保存的状态
+func (r *Manager) clearStates(shards uint32) {
+	for i := uint32(0); i < shards; i++ {
+		r.checkpoint(dto.Session{Shards: dto.ShardConfig{ShardID: i, ShardCount: shards}})
+	}
+}
+
+// waitShards 等待 shard 数量为 shards 的所有 shard 完成连接，shard 可能由集群内的任意实例连接，按照 ready 时保存的状态判断
+func (r *Manager) waitShards(ctx context.Context, stop chan struct{}, shards uint32) error {
+	for i := uint32(0); i < shards; {
+		state, err := r.store.Load(ctx, dto.ShardConfig{ShardID: i, ShardCount: shards})
+		if err != nil {
+			r.log().Errorf("[ws/session/remote] load session failed, err: %v", err)
+		}
+		if state != nil && state.ID != "" {
+			i++
+			continue
+		}
+		if err := sleep(ctx, stop, 100*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleep 等待 d，manager 停止或者 ctx 结束时返回错误
+func sleep(ctx context.Context, stop chan struct{}, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-stop:
+		return manager.ErrManagerStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// initShards 集群没有记录 shard 数量时记录 shards，已经记录时使用记录的数量
+func (r *Manager) initShards(ctx context.Context, shards uint32) {
+	counts, err := r.shardSet.Load(ctx)
+	if err != nil {
+		r.log().Errorf("[ws/session/remote] load shard count failed, err: %v", err)
+		return
+	}
+	if len(counts) > 0 {
+		r.applyShards(counts)
+		return
+	}
+	if err := r.shardSet.Store(ctx, []uint32{shards}); err != nil {
+		r.log().Errorf("[ws/session/remote] store shard count failed, err: %v", err)
+	}
+}
+
+// shardSetLoop 定期读取集群的 shard 数量，直到 manager 停止
+func (r *Manager) shardSetLoop(stop chan struct{}) {
+	ticker := time.NewTicker(shardSetInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.syncShards(context.Background())
+		}
+	}
+}
+
+// syncShards 读取集群的 shard 数量并在本实例生效
+func (r *Manager) syncShards(ctx context.Context) {
+	counts, err := r.shardSet.Load(ctx)
+	if err != nil {
+		r.log().Errorf("[ws/session/remote] load shard count failed, err: %v", err)
+		return
+	}
+	r.applyShards(counts)
+}
+
+// applyShards 更新正在运行的 shard 数量，进入或者结束重新分片，下线不再运行的 shard 的连接
+func (r *Manager) applyShards(counts []uint32) {
+	if len(counts) == 0 {
+		return
+	}
+	r.lock.Lock()
+	if r.isStop {
+		r.lock.Unlock()
+		return
+	}
+	overlapping := len(counts) > 1
+	begin, end := overlapping && !r.overlapping, !overlapping && r.overlapping
+	r.overlapping = overlapping
+	r.shardCount = counts[0]
+	r.shardCounts = map[uint32]bool{}
+	for _, count := range counts {
+		r.shardCounts[count] = true
+	}
+	var retired []*shardConn
+	for shard, c := range r.clients {
+		if !r.shardCounts[shard.ShardCount] {
+			// 连接交由 retire 处理
+			delete(r.clients, shard)
+			retired = append(retired, c)
+		}
+	}
+	r.lock.Unlock()
+
+	if begin {
+		r.overlap.Begin()
+	}
+	r.retire(retired)
+	if end {
+		// 旧的连接已经读取的事件处理完成后再结束，之后在 window 内继续过滤
+		r.overlap.End()
+	}
+}
+
+// retire 下线重新分片后不再运行的连接，等待已经读取的事件处理完成，然后释放 shard 锁并删除保存的状态
+func (r *Manager) retire(conns []*shardConn) {
+	if len(conns) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handoffTimeout)
+	defer cancel()
+	drainErrs := make(chan error, len(conns))
+	for _, c := range conns {
+		go func(c *shardConn) {
+			drainErrs <- manager.Drain(ctx, c.ws)
+		}(c)
+	}
+	for range conns {
+		if err := <-drainErrs; err != nil {
+			r.log().Errorf("[ws/session/remote] drain retired shard failed, err: %v", err)
+		}
+	}
+	for _, c := range conns {
+		session := manager.Checkpoint(c.ws)
+		if r.leaseLost(session, c.shardLock) {
+			continue
+		}
+		r.log().Infof("[ws/session/remote] %s is retired by reshard", &session)
+		r.checkpoint(dto.Session{Shards: session.Shards})
+		r.release(context.Background(), session, c.shardLock)
+	}
+}
+
+// activeShards 返回正在运行的 shard 数量，从小到大排序
+func (r *Manager) activeShards() []uint32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	counts := make([]uint32, 0, len(r.shardCounts))
+	for count := range r.shardCounts {
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i] < counts[j] })
+	return counts
+}
+
+// running shard 数量是否正在运行
+func (r *Manager) running(shards uint32) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.shardCounts[shards]
+}
+
+// retired shard 是否已经因为重新分片下线，本实例的记录可能还没有更新，不在运行时重新读取后再判断
+func (r *Manager) retired(shard dto.ShardConfig) bool {
+	if r.running(shard.ShardCount) {
+		return false
+	}
+	r.syncShards(context.Background())
+	return !r.running(shard.ShardCount)
+}
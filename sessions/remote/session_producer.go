@@ -6,15 +6,18 @@ import (
 	"time"
 
 	"github.com/tencent-connect/botgo/dto"
-	"github.com/tencent-connect/botgo/log"
 	"github.com/tencent-connect/botgo/token"
 )
 
-// distributeSession 根据 shards 生产初始化的 session，这里需要抢一个分布式锁，抢到锁的服务器，负责把session都生产到 redis 中
-func (r *RedisManager) distributeSession(apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error {
+// distributeSession 根据 shards 生产初始化的 session，这里需要抢一个分布式锁，抢到锁的服务器，负责把session都生产到队列中
+func (r *Manager) distributeSession(apInfo *dto.WebsocketAP, token *token.Token, handlers *dto.EventParse) error {
 	// clear，报错也不影响
-	if err := r.client.Del(context.Background(), r.sessionQueueKey); err != nil {
-		log.Errorf("[ws/session/redis] clear session list failed: %v", err)
+	if err := r.queue.Clear(context.Background()); err != nil {
+		r.log().Errorf("[ws/session/remote] clear session list failed: %v", err)
+	}
+	// 记录集群的 shard 数量，覆盖上一次运行留下的记录
+	if err := r.shardSet.Store(context.Background(), []uint32{apInfo.Shards}); err != nil {
+		r.log().Errorf("[ws/session/remote] store shard count failed: %v", err)
 	}
 	for i := uint32(0); i < apInfo.Shards; i++ {
 		session := dto.Session{
@@ -33,22 +36,47 @@ func (r *RedisManager) distributeSession(apInfo *dto.WebsocketAP, token *token.T
 	return nil
 }
 
-// sessionProducer 从 chan 取到session，push 到 redis，push 失败放回 chan
-func (r *RedisManager) sessionProducer(startInterval time.Duration) {
-	for session := range r.sessionProduceChan {
-		time.Sleep(startInterval) // 每次生产需要等待一个间隔，控制消费者连接并发
-		if err := r.produce(session); err != nil {
-			log.Errorf("[ws/session/redis] produce session failed: %v", err)
-			r.sessionProduceChan <- session // 放回去重试
+// sessionProducer 从 chan 取到session，push 到 redis，push 失败放回 chan，直到 manager 停止
+// 停止时 chan 中剩余的 session 直接放回队列，由其他实例继续消费
+func (r *Manager) sessionProducer(startInterval time.Duration, sessions chan dto.Session, stop chan struct{}) {
+	for {
+		select {
+		case session := <-sessions:
+			time.Sleep(startInterval) // 每次生产需要等待一个间隔，控制消费者连接并发
+			if err := r.produce(session); err != nil {
+				r.log().Errorf("[ws/session/remote] produce session failed: %v", err)
+				go r.requeue(session) // 放回去重试，不能阻塞唯一读取 chan 的协程
+			}
+		case <-stop:
+			r.flushSessions(sessions)
+			return
+		}
+	}
+}
+
+// flushSessions 将 chan 中剩余的 session 放回队列
+func (r *Manager) flushSessions(sessions chan dto.Session) {
+	for {
+		select {
+		case session := <-sessions:
+			if err := r.produce(session); err != nil {
+				r.log().Errorf("[ws/session/remote] produce session failed: %v", err)
+			}
+		default:
+			return
 		}
 	}
 }
 
-func (r *RedisManager) produce(session dto.Session) error {
+func (r *Manager) produce(session dto.Session) error {
 	data, err := json.Marshal(session)
-	log.Debugf("[ws][session/redis] produce session data is %s", string(data))
+	r.log().Debugf("[ws][session/redis] produce session data is %s", string(data))
 	if err != nil {
 		return ErrSessionMarshalFailed
 	}
-	return r.client.LPush(context.Background(), r.sessionQueueKey, data).Err()
+	if r.assign != nil {
+		// 按照成员分配 shard 时放入所属成员的队列
+		return r.ownerQueue(session.Shards).Push(context.Background(), data)
+	}
+	return r.queue.Push(context.Background(), data)
 }
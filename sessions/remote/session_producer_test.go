@@ -0,0 +1,40 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+func TestRequeueAfterStop(t *testing.T) {
+	r := NewManager(NewMemoryBackend())
+	// 没有协程读取 chan，manager 停止后 requeue 不能阻塞
+	r.sessionProduceChan = make(chan dto.Session)
+	r.stop = make(chan struct{})
+	r.Stop()
+	done := make(chan struct{})
+	go func() {
+		r.requeue(dto.Session{Shards: dto.ShardConfig{ShardID: 1, ShardCount: 2}})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("requeue blocked after stop")
+	}
+	// session 直接放回队列，由其他实例继续消费
+	data, err := r.queue.Pop(context.Background(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session dto.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Shards.ShardID != 1 {
+		t.Errorf("requeued session %+v, want shard 1", session.Shards)
+	}
+}
@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/sessions/manager"
+)
+
+// defaultCheckpointTTL session 状态的默认过期时间，过期的 session 即使保存下来也无法 resume
+const defaultCheckpointTTL = time.Hour
+
+var _ manager.SessionStore = (*RedisStore)(nil)
+
+// RedisStore 基于 redis 的 SessionStore，每个 shard 的 session 状态保存在独立的 key 中，并设置过期时间
+type RedisStore struct {
+	client     *redis.Client
+	clusterKey string
+	ttl        time.Duration
+}
+
+// NewRedisStore 创建基于 redis 的 SessionStore，ttl 小于等于 0 时使用默认的过期时间
+func NewRedisStore(client *redis.Client, clusterKey string, ttl time.Duration) *RedisStore {
+	if ttl <= 0 {
+		ttl = defaultCheckpointTTL
+	}
+	return &RedisStore{client: client, clusterKey: clusterKey, ttl: ttl}
+}
+
+// Save 保存 shard 的 session 状态，ID 为空时删除
+func (s *RedisStore) Save(ctx context.Context, state manager.SessionState) error {
+	key := s.key(state.Shards)
+	if state.ID == "" {
+		return s.client.Del(ctx, key).Err()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, key, data, s.ttl).Err()
+}
+
+// Load 读取 shard 的 session 状态，不存在时返回 nil
+func (s *RedisStore) Load(ctx context.Context, shards dto.ShardConfig) (*manager.SessionState, error) {
+	data, err := s.client.Get(ctx, s.key(shards)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &manager.SessionState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *RedisStore) key(shards dto.ShardConfig) string {
+	return fmt.Sprintf("%s_session_%d_%d", s.clusterKey, shards.ShardID, shards.ShardCount)
+}
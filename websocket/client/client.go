@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,23 +16,115 @@ import (
 	"github.com/tencent-connect/botgo/errs"
 	"github.com/tencent-connect/botgo/log"
 	"github.com/tencent-connect/botgo/websocket"
+	"github.com/tencent-connect/botgo/websocket/dedup"
 )
 
-// DefaultQueueSize 监听队列的缓冲长度
+// DefaultQueueSize 监听队列的默认缓冲长度，可以通过 WithQueueSize 修改
 const DefaultQueueSize = 10000
 
+// DefaultMaxMissedHeartbeatAcks 默认允许连续丢失的心跳 ack 数量，超过后认为连接已经失效，需要重连
+const DefaultMaxMissedHeartbeatAcks = 2
+
 // Setup 依赖注册
 func Setup() {
-	websocket.Register(&Client{})
+	websocket.Register(New())
+}
+
+// Option client 配置项
+type Option func(c *Client)
+
+// WithMaxMissedHeartbeatAcks 设置允许连续丢失的心跳 ack 数量，小于等于 0 时使用默认值
+func WithMaxMissedHeartbeatAcks(n int) Option {
+	return func(c *Client) {
+		c.maxMissedAcks = n
+	}
+}
+
+// WithLogger 设置连接使用的 logger，不设置时使用全局的 log.DefaultLogger
+func WithLogger(logger log.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithWorkers 设置事件处理协程数量，小于等于 0 时使用默认值，同一个分区的事件按照接收顺序处理
+func WithWorkers(n int) Option {
+	return func(c *Client) {
+		c.workers = n
+	}
+}
+
+// WithPartitionKey 设置事件的分区方式，默认按照子频道分区，见 PartitionByChannel 与 PartitionByGuild
+func WithPartitionKey(partition PartitionKeyFunc) Option {
+	return func(c *Client) {
+		c.partition = partition
+	}
+}
+
+// WithQueueSize 设置事件队列的长度，小于等于 0 时使用默认值
+func WithQueueSize(n int) Option {
+	return func(c *Client) {
+		c.queueSize = n
+	}
+}
+
+// WithOverflowPolicy 设置事件队列满时的处理策略，OverflowSpill 需要同时设置 sink，sink 为空时丢弃新事件
+func WithOverflowPolicy(policy OverflowPolicy, sink OverflowSink) Option {
+	return func(c *Client) {
+		c.overflow = policy
+		c.sink = sink
+	}
+}
+
+// New 创建一个 client 原型，通过 websocket.Register 注册后，使用原型创建的连接都会使用原型上的配置
+func New(opts ...Option) *Client {
+	c := &Client{counters: &queueCounters{}, dedupCounters: &dedupCounters{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // New 新建一个连接对象
 func (c *Client) New(session dto.Session) websocket.WebSocket {
+	maxMissedAcks := c.maxMissedAcks
+	if maxMissedAcks <= 0 {
+		maxMissedAcks = DefaultMaxMissedHeartbeatAcks
+	}
+	logger := c.logger
+	if logger == nil {
+		logger = log.DefaultLogger
+	}
+	queueSize := c.queueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	counters := c.counters
+	if counters == nil {
+		counters = &queueCounters{}
+	}
+	dedupCounts := c.dedupCounters
+	if dedupCounts == nil {
+		dedupCounts = &dedupCounters{}
+	}
 	return &Client{
-		messageQueue:    make(messageChan, DefaultQueueSize),
+		messageQueue:    make(messageChan, queueSize),
 		session:         &session,
 		closeChan:       make(closeErrorChan, 10),
 		heartBeatTicker: time.NewTicker(60 * time.Second), // 先给一个默认 ticker，在收到 hello 包之后，会 reset
+		maxMissedAcks:   maxMissedAcks,
+		logger:          logger,
+		workers:         c.workers,
+		partition:       c.partition,
+		queueSize:       queueSize,
+		overflow:        c.overflow,
+		sink:            c.sink,
+		counters:        counters,
+		dedup:           c.dedup,
+		dedupTTL:        c.dedupTTL,
+		dedupCounters:   dedupCounts,
+		handled:         make(chan struct{}),
+		activity:        &activity{},
 	}
 }
 
@@ -43,6 +137,33 @@ type Client struct {
 	user            *dto.WSUser
 	closeChan       closeErrorChan
 	heartBeatTicker *time.Ticker // 用于维持定时心跳
+	maxMissedAcks   int          // 允许连续丢失的心跳 ack 数量
+	heartbeat       heartbeatState
+	logger          log.Logger
+	workers         int              // 事件处理协程数量
+	partition       PartitionKeyFunc // 事件分区方式
+	queueSize       int              // 事件队列长度
+	overflow        OverflowPolicy   // 事件队列满时的处理策略
+	sink            OverflowSink     // 溢出事件的接收方
+	counters        *queueCounters   // 事件队列计数
+	overflowed      overflowState    // 队列已满的通知状态
+	seqs            seqTracker       // 处理中的事件 seq
+	draining        int32            // 正在优雅关闭，读取错误不再通知使用方
+	listening       int32            // 已经开始 Listening，之前没有读取到的事件
+	handled         chan struct{}    // 所有读取到的事件都处理完成后关闭
+	activity        *activity        // 收到消息的记录
+	dedup           dedup.Store      // 为空时不去重
+	dedupTTL        time.Duration    // 去重窗口
+	dedupCounters   *dedupCounters   // 去重计数
+}
+
+// heartbeatState 心跳状态，发送心跳在 Listening 协程，接收 ack 在读消息的协程，需要加锁
+type heartbeatState struct {
+	lock    sync.Mutex
+	sentAt  time.Time     // 最近一次发送心跳的时间
+	waiting bool          // 已经发送心跳，还没有收到 ack
+	missed  int           // 连续丢失的 ack 数量
+	latency time.Duration // 最近一次心跳的往返耗时
 }
 
 type messageChan chan *dto.WSPayload
@@ -57,10 +178,10 @@ func (c *Client) Connect() error {
 	var err error
 	c.conn, _, err = wss.DefaultDialer.Dial(c.session.URL, nil)
 	if err != nil {
-		log.Errorf("%s, connect err: %v", c.session, err)
+		c.logger.Errorf("%s, connect err: %v", c.snapshot(), err)
 		return err
 	}
-	log.Infof("%s, url %s, connected", c.session, c.session.URL)
+	c.logger.Infof("%s, url %s, connected", c.snapshot(), c.session.URL)
 
 	return nil
 }
@@ -69,6 +190,7 @@ func (c *Client) Connect() error {
 // 定时心跳也在这里维护
 func (c *Client) Listening() error {
 	defer c.Close()
+	atomic.StoreInt32(&c.listening, 1)
 	// reading message
 	go c.readMessageToQueue()
 	// read message from queue and handle,in goroutine to avoid business logic block closeChan and heartBeatTicker
@@ -84,11 +206,11 @@ func (c *Client) Listening() error {
 	for {
 		select {
 		case <-resumeSignal: // 使用信号量控制连接立即重连
-			log.Infof("%s, received resumeSignal signal", c.session)
+			c.logger.Infof("%s, received resumeSignal signal", c.snapshot())
 			return errs.ErrNeedReConnect
 		case err := <-c.closeChan:
 			// 关闭连接的错误码 https://bot.q.qq.com/wiki/develop/api/gateway/error/error.html
-			log.Errorf("%s Listening stop. err is %v", c.session, err)
+			c.logger.Errorf("%s Listening stop. err is %v", c.snapshot(), err)
 			// 不能够 identify 的错误
 			if wss.IsCloseError(err, 4914, 4915) {
 				err = errs.New(errs.CodeConnCloseCantIdentify, err.Error())
@@ -98,18 +220,24 @@ func (c *Client) Listening() error {
 			if wss.IsUnexpectedCloseError(err, 4009) {
 				err = errs.New(errs.CodeConnCloseCantResume, err.Error())
 			}
-			if dto.DefaultHandlers.ErrorNotify != nil {
-				// 通知到使用方错误
-				dto.DefaultHandlers.ErrorNotify(err)
+			// 通知到使用方错误，优雅关闭时主动断开连接导致的错误不需要通知
+			if atomic.LoadInt32(&c.draining) == 0 {
+				c.session.Handlers.NotifyError(err)
 			}
 			return err
 		case <-c.heartBeatTicker.C:
-			log.Debugf("%s listened heartBeat", c.session)
+			c.logger.Debugf("%s listened heartBeat", c.snapshot())
+			// 连续多次没有收到 ack，说明连接可能已经半开，主动断开后 resume
+			if missed := c.beforeHeartbeat(); missed >= c.maxMissedAcks {
+				c.logger.Errorf("%s missed %d heartbeat acks, reconnect", c.snapshot(), missed)
+				c.closeChan <- errs.ErrHeartbeatTimeout
+				continue
+			}
 			heartBeatEvent := &dto.WSPayload{
 				WSPayloadBase: dto.WSPayloadBase{
 					OPCode: dto.WSHeartbeat,
 				},
-				Data: c.session.LastSeq,
+				Data: c.snapshot().LastSeq,
 			}
 			// 不处理错误，Write 内部会处理，如果发生发包异常，会通知主协程退出
 			_ = c.Write(heartBeatEvent)
@@ -119,10 +247,10 @@ func (c *Client) Listening() error {
 
 func (c *Client) Write(message *dto.WSPayload) error {
 	m, _ := json.Marshal(message)
-	log.Infof("%s write %s message, %v", c.session, dto.OPMeans(message.OPCode), string(m))
+	c.logger.Infof("%s write %s message, %v", c.snapshot(), dto.OPMeans(message.OPCode), string(m))
 
 	if err := c.conn.WriteMessage(wss.TextMessage, m); err != nil {
-		log.Errorf("%s WriteMessage failed, %v", c.session, err)
+		c.logger.Errorf("%s WriteMessage failed, %v", c.snapshot(), err)
 		c.closeChan <- err
 		return err
 	}
@@ -131,11 +259,12 @@ func (c *Client) Write(message *dto.WSPayload) error {
 
 // Resume 重连
 func (c *Client) Resume() error {
+	session := c.snapshot()
 	event := &dto.WSPayload{
 		Data: &dto.WSResumeData{
-			Token:     c.session.Token.GetString(),
-			SessionID: c.session.ID,
-			Seq:       c.session.LastSeq,
+			Token:     session.Token.GetString(),
+			SessionID: session.ID,
+			Seq:       session.LastSeq,
 		},
 	}
 	event.OPCode = dto.WSResume // 内嵌结构体字段，单独赋值
@@ -145,10 +274,8 @@ func (c *Client) Resume() error {
 // Identify 对一个连接进行鉴权，并声明监听的 shard 信息
 func (c *Client) Identify() error {
 	// 避免传错 intent
-	var intent dto.Intent = 0
-	if c.session.Handlers == nil {
-		intent = dto.IntentGuilds
-	} else {
+	intent := dto.IntentGuilds
+	if c.session.Handlers != nil {
 		intent = c.session.Handlers.Intent()
 	}
 	event := &dto.WSPayload{
@@ -168,37 +295,77 @@ func (c *Client) Identify() error {
 // Close 关闭连接
 func (c *Client) Close() {
 	if err := c.conn.Close(); err != nil {
-		log.Errorf("%s, close conn err: %v", c.session, err)
+		c.logger.Errorf("%s, close conn err: %v", c.snapshot(), err)
 	}
 	c.heartBeatTicker.Stop()
 }
 
+// Latency 返回最近一次心跳的往返耗时，还没有收到过心跳 ack 时返回 0
+func (c *Client) Latency() time.Duration {
+	c.heartbeat.lock.Lock()
+	defer c.heartbeat.lock.Unlock()
+	return c.heartbeat.latency
+}
+
+// beforeHeartbeat 记录心跳的发送，返回发送前连续丢失的 ack 数量
+func (c *Client) beforeHeartbeat() int {
+	c.heartbeat.lock.Lock()
+	defer c.heartbeat.lock.Unlock()
+	if c.heartbeat.waiting {
+		c.heartbeat.missed++
+	}
+	c.heartbeat.waiting = true
+	c.heartbeat.sentAt = time.Now()
+	return c.heartbeat.missed
+}
+
+// heartbeatAcked 收到心跳 ack，更新耗时并清空丢失计数
+func (c *Client) heartbeatAcked() {
+	c.heartbeat.lock.Lock()
+	defer c.heartbeat.lock.Unlock()
+	if c.heartbeat.waiting {
+		c.heartbeat.latency = time.Since(c.heartbeat.sentAt)
+	}
+	c.heartbeat.waiting = false
+	c.heartbeat.missed = 0
+}
+
 // Session 获取client的session信息
 func (c *Client) Session() *dto.Session {
 	return c.session
 }
 
+// snapshot 返回加锁读取的 session 副本，用于日志等在其他协程读取 session 的场景，ID 与 LastSeq 会在处理事件的协程中更新
+func (c *Client) snapshot() *dto.Session {
+	c.seqs.lock.Lock()
+	defer c.seqs.lock.Unlock()
+	session := *c.session
+	return &session
+}
+
 func (c *Client) readMessageToQueue() {
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			log.Errorf("%s read message failed, %v, message %s", c.session, err, string(message))
+			c.logger.Errorf("%s read message failed, %v, message %s", c.snapshot(), err, string(message))
 			close(c.messageQueue)
 			c.closeChan <- err
 			return
 		}
 		event := &dto.WSPayload{}
 		if err := json.Unmarshal(message, event); err != nil {
-			log.Errorf("%s json failed, %v", c.session, err)
+			c.logger.Errorf("%s json failed, %v", c.snapshot(), err)
 			continue
 		}
 		event.RawMessage = message
-		log.Infof("%s receive %s message, %s", c.session, dto.OPMeans(event.OPCode), string(message))
+		event.FencingToken = c.session.FencingToken
+		c.activity.received(event)
+		c.logger.Infof("%s receive %s message, %s", c.snapshot(), dto.OPMeans(event.OPCode), string(message))
 		// 处理内置的一些事件，如果处理成功，则这个事件不再投递给业务
 		if c.isHandleBuildIn(event) {
 			continue
 		}
-		c.messageQueue <- event
+		c.enqueue(event)
 	}
 }
 
@@ -207,10 +374,13 @@ func (c *Client) listenMessageAndHandle() {
 		// panic，一般是由于业务自己实现的 handle 不完善导致
 		// 打印日志后，关闭这个连接，进入重连流程
 		if err := recover(); err != nil {
-			websocket.PanicHandler(err, c.session)
+			websocket.LogPanic(c.logger, err, c.snapshot())
 			c.closeChan <- fmt.Errorf("panic: %v", err)
 		}
 	}()
+	defer close(c.handled)
+	d := newDispatcher(c.workers, c.partition, c.handleEvent)
+	defer d.close()
 	for event := range c.messageQueue {
 		c.saveSeq(event.Seq)
 		// ready 事件需要特殊处理
@@ -218,23 +388,46 @@ func (c *Client) listenMessageAndHandle() {
 			c.readyHandler(event)
 			continue
 		}
-		// 解析具体事件，并投递给业务注册的 handler
-		if err := c.parseAndHandle(event); err != nil {
-			log.Errorf("%s parseAndHandle failed, %v", c.session, err)
+		// 按照分区投递到处理协程，处理完成前记录为处理中
+		c.seqs.begin(event.Seq)
+		d.dispatch(event)
+	}
+	c.logger.Infof("%s message queue is closed", c.snapshot())
+}
+
+// handleEvent 解析具体事件，并投递给业务注册的 handler
+// handler 的 panic 只影响当前事件，打印日志并通知到使用方，不会断开连接
+func (c *Client) handleEvent(event *dto.WSPayload) {
+	defer c.seqs.end(event.Seq)
+	defer func() {
+		if err := recover(); err != nil {
+			websocket.LogPanic(c.logger, err, c.snapshot())
+			c.session.Handlers.NotifyError(errs.New(errs.CodeHandlerPanic, fmt.Sprintf("panic: %v", err)))
 		}
+	}()
+	if err := c.parseAndHandle(event); err != nil {
+		c.logger.Errorf("%s parseAndHandle failed, %v", c.snapshot(), err)
 	}
-	log.Infof("%s message queue is closed", c.session)
 }
 
 func (c *Client) parseAndHandle(event *dto.WSPayload) error {
+	if c.duplicated(event) {
+		return nil
+	}
+	if !c.session.Handlers.Accept(event) {
+		c.logger.Debugf("%s event %s seq %d is filtered", c.snapshot(), event.Type, event.Seq)
+		return nil
+	}
 	if h, ok := c.session.Handlers.FuncMap()[event.OPCode][event.Type]; ok {
 		return h(event, event.RawMessage)
 	}
-	return parseAndHandle(event)
+	return parseAndHandle(c.session.Handlers, event)
 }
 
 func (c *Client) saveSeq(seq uint32) {
-	if seq > 0 {
+	c.seqs.lock.Lock()
+	defer c.seqs.lock.Unlock()
+	if seq > 0 && !c.seqs.frozen {
 		c.session.LastSeq = seq
 	}
 }
@@ -245,7 +438,8 @@ func (c *Client) isHandleBuildIn(event *dto.WSPayload) bool {
 	switch event.OPCode {
 	case dto.WSHello: // 接收到 hello 后需要开始发心跳
 		c.startHeartBeatTicker(event.RawMessage)
-	case dto.WSHeartbeatAck: // 心跳 ack 不需要业务处理
+	case dto.WSHeartbeatAck: // 心跳 ack 不需要业务处理，只记录耗时
+		c.heartbeatAcked()
 	case dto.WSReconnect: // 达到连接时长，需要重新连接，此时可以通过 resume 续传原连接上的事件
 		c.closeChan <- errs.ErrNeedReConnect
 	case dto.WSInvalidSession: // 无效的 sessionLog，需要重新鉴权
@@ -260,7 +454,7 @@ func (c *Client) isHandleBuildIn(event *dto.WSPayload) bool {
 func (c *Client) startHeartBeatTicker(message []byte) {
 	helloData := &dto.WSHelloData{}
 	if err := parseData(message, helloData); err != nil {
-		log.Errorf("%s hello data parse failed, %v, message %v", c.session, err, message)
+		c.logger.Errorf("%s hello data parse failed, %v, message %v", c.snapshot(), err, message)
 	}
 	// 根据 hello 的回包，重新设置心跳的定时器时间
 	c.heartBeatTicker.Reset(time.Duration(helloData.HeartbeatInterval) * time.Millisecond)
@@ -270,20 +464,22 @@ func (c *Client) startHeartBeatTicker(message []byte) {
 func (c *Client) readyHandler(event *dto.WSPayload) {
 	readyData := &dto.WSReadyData{}
 	if err := parseData(event.RawMessage, readyData); err != nil {
-		log.Errorf("%s parseReadyData failed, %v, message %v", c.session, err, event.RawMessage)
+		c.logger.Errorf("%s parseReadyData failed, %v, message %v", c.snapshot(), err, event.RawMessage)
 	}
 	c.version = readyData.Version
-	// 基于 ready 事件，更新 session 信息
+	// 基于 ready 事件，更新 session 信息，Checkpoint 会在其他协程读取 session
+	c.seqs.lock.Lock()
 	c.session.ID = readyData.SessionID
-	c.session.Shards.ShardID = readyData.Shard[0]
-	c.session.Shards.ShardCount = readyData.Shard[1]
+	// session manager 会不加锁读取 Shards，与鉴权时一致时不写入
+	if shards := (dto.ShardConfig{ShardID: readyData.Shard[0], ShardCount: readyData.Shard[1]}); c.session.Shards != shards {
+		c.session.Shards = shards
+	}
+	c.seqs.lock.Unlock()
 	c.user = &dto.WSUser{
 		ID:       readyData.User.ID,
 		Username: readyData.User.Username,
 		Bot:      readyData.User.Bot,
 	}
 	// 调用自定义的 ready 回调
-	if dto.DefaultHandlers.Ready != nil {
-		dto.DefaultHandlers.Ready(event, readyData)
-	}
+	c.session.Handlers.HandleReady(event, readyData)
 }
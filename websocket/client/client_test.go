@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+func TestHeartbeatAckTimeout(t *testing.T) {
+	s := websockettest.NewServer(websockettest.WithHeartbeatInterval(20 * time.Millisecond))
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := New(WithMaxMissedHeartbeatAcks(3)).New(dto.Session{
+		URL:      s.URL,
+		Token:    *token.BotToken(1, "token"),
+		Handlers: dto.NewEventParse(),
+		Shards:   dto.ShardConfig{ShardCount: 1},
+	}).(*Client)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Identify(); err != nil {
+		t.Fatal(err)
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- c.Listening()
+	}()
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c.Latency() == 0 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.Latency() <= 0 {
+		t.Fatal("latency not measured")
+	}
+
+	conn.DropHeartbeatAcks(true)
+	start := len(conn.Heartbeats())
+	select {
+	case err := <-listenErr:
+		if err != errs.ErrHeartbeatTimeout {
+			t.Fatalf("Listening() = %v, want %v", err, errs.ErrHeartbeatTimeout)
+		}
+		if manager.CanNotResume(err) {
+			t.Error("heartbeat timeout should be resumable")
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for heartbeat ack timeout")
+	}
+	// 丢弃 ack 之后最多再发送 3 次心跳，依然没有 ack 时断开，开启丢弃时可能已经有一个心跳在途中
+	if sent := len(conn.Heartbeats()) - start; sent < 2 || sent > 3 {
+		t.Errorf("sent %d heartbeats without ack, want 2 or 3", sent)
+	}
+}
+
+func TestEventParse(t *testing.T) {
+	var got []string
+	record := func(name string) dto.PlainEventHandler {
+		return func(event *dto.WSPayload, message []byte) error {
+			got = append(got, name+":"+string(event.Type))
+			return nil
+		}
+	}
+	first := dto.NewEventParse().
+		GuildMember(func(event *dto.WSPayload, data *dto.WSGuildMemberData) error {
+			got = append(got, "first:"+data.User.ID)
+			return nil
+		}).
+		Audio(func(event *dto.WSPayload, data *dto.WSAudioData) error { return nil }).
+		Plain(record("first"))
+	second := dto.NewEventParse().
+		DirectMessage(func(event *dto.WSPayload, data *dto.WSDirectMessageData) error { return nil }).
+		Plain(record("second"))
+
+	if want := dto.IntentGuildMembers | dto.IntentAudio; first.Intent() != want {
+		t.Errorf("first Intent() = %v, want %v", first.Intent(), want)
+	}
+	if want := dto.IntentDirectMessages; second.Intent() != want {
+		t.Errorf("second Intent() = %v, want %v", second.Intent(), want)
+	}
+
+	events := []string{
+		`{"op":0,"t":"GUILD_MEMBER_ADD","d":{"user":{"id":"1"}}}`,
+		`{"op":0,"t":"UNKNOWN_EVENT","d":{}}`,
+	}
+	for _, handlers := range []*dto.EventParse{first, second} {
+		c := &Client{session: &dto.Session{Handlers: handlers}}
+		for _, raw := range events {
+			event := &dto.WSPayload{}
+			if err := json.Unmarshal([]byte(raw), event); err != nil {
+				t.Fatal(err)
+			}
+			event.RawMessage = []byte(raw)
+			if err := c.parseAndHandle(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := "first:1,first:UNKNOWN_EVENT,second:UNKNOWN_EVENT"
+	if strings.Join(got, ",") != want {
+		t.Errorf("handled %v, want %v", strings.Join(got, ","), want)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	var got []string
+	handlers := dto.NewEventParse().AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+		got = append(got, data.ID)
+		return nil
+	})
+	prototype := New(WithDedup(dedup.NewMemoryStore(), time.Minute))
+	events := []string{
+		`{"op":0,"s":1,"t":"AT_MESSAGE_CREATE","d":{"id":"m1"}}`,
+		`{"op":0,"s":2,"t":"AT_MESSAGE_CREATE","d":{"id":"m2"}}`,
+		`{"op":0,"s":3,"t":"AT_MESSAGE_CREATE","d":{"id":"m1"}}`,
+	}
+	// 同一个原型创建的连接共享去重记录，如 resume 前后的两个连接
+	for i := 0; i < 2; i++ {
+		c := prototype.New(dto.Session{Handlers: handlers}).(*Client)
+		for _, raw := range events {
+			event := &dto.WSPayload{}
+			if err := json.Unmarshal([]byte(raw), event); err != nil {
+				t.Fatal(err)
+			}
+			event.RawMessage = []byte(raw)
+			if err := c.parseAndHandle(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if want := "m1,m2"; strings.Join(got, ",") != want {
+		t.Errorf("handled %v, want %v", strings.Join(got, ","), want)
+	}
+	if stats := prototype.DedupStats(); stats.Checked != 6 || stats.Duplicates != 4 {
+		t.Errorf("DedupStats() = %+v, want 6 checked and 4 duplicates", stats)
+	}
+}
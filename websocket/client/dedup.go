@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket/dedup"
+)
+
+// WithDedup 开启事件去重，事件类型与自然 ID 相同的事件在 ttl 内只交给 handler 一次，ttl 小于等于 0 时使用 dedup.DefaultTTL
+// 事件在交给 handler 之前标记，handler 返回错误的事件不会再次处理，没有自然 ID 的事件不去重
+func WithDedup(store dedup.Store, ttl time.Duration) Option {
+	return func(c *Client) {
+		if ttl <= 0 {
+			ttl = dedup.DefaultTTL
+		}
+		c.dedup = store
+		c.dedupTTL = ttl
+	}
+}
+
+// DedupStats 事件去重的统计
+type DedupStats struct {
+	Checked    uint64 // 检查过的事件数量
+	Duplicates uint64 // 被过滤的重复事件数量
+	Errors     uint64 // 去重记录读写失败的次数，失败时事件照常处理
+}
+
+// dedupCounters 去重计数，同一个原型创建的连接共享
+type dedupCounters struct {
+	checked    uint64
+	duplicates uint64
+	errors     uint64
+}
+
+// DedupStats 返回事件去重的统计，为同一个原型创建的所有连接的累计值
+func (c *Client) DedupStats() DedupStats {
+	if c.dedupCounters == nil {
+		return DedupStats{}
+	}
+	return DedupStats{
+		Checked:    atomic.LoadUint64(&c.dedupCounters.checked),
+		Duplicates: atomic.LoadUint64(&c.dedupCounters.duplicates),
+		Errors:     atomic.LoadUint64(&c.dedupCounters.errors),
+	}
+}
+
+// duplicated 事件是否已经处理过，没有开启去重时返回 false
+func (c *Client) duplicated(event *dto.WSPayload) bool {
+	if c.dedup == nil {
+		return false
+	}
+	key := dedup.Key(event)
+	if key == "" {
+		return false
+	}
+	atomic.AddUint64(&c.dedupCounters.checked, 1)
+	seen, err := c.dedup.Mark(context.Background(), key, c.dedupTTL)
+	if err != nil {
+		atomic.AddUint64(&c.dedupCounters.errors, 1)
+		c.logger.Errorf("%s dedup event %s failed, %v", c.snapshot(), key, err)
+		return false
+	}
+	if seen {
+		atomic.AddUint64(&c.dedupCounters.duplicates, 1)
+		c.logger.Infof("%s drop duplicated event %s seq %d", c.snapshot(), key, event.Seq)
+	}
+	return seen
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultWorkers 默认的事件处理协程数量，为 1 时所有事件按照接收顺序串行处理
+const DefaultWorkers = 1
+
+// DefaultWorkerQueueSize 每个处理协程的缓冲长度
+const DefaultWorkerQueueSize = 100
+
+// PartitionKeyFunc 计算事件的分区 key，相同 key 的事件由同一个协程按照接收顺序处理
+type PartitionKeyFunc func(event *dto.WSPayload) string
+
+// PartitionByChannel 按照子频道分区，事件中没有子频道 id 时按照频道分区
+func PartitionByChannel(event *dto.WSPayload) string {
+	if id := gjson.GetBytes(event.RawMessage, "d.channel_id").String(); id != "" {
+		return id
+	}
+	return PartitionByGuild(event)
+}
+
+// PartitionByGuild 按照频道分区
+func PartitionByGuild(event *dto.WSPayload) string {
+	return gjson.GetBytes(event.RawMessage, "d.guild_id").String()
+}
+
+// dispatcher 按照分区 key 将事件投递到固定的协程，分区内保证顺序，分区间并发
+type dispatcher struct {
+	queues    []chan *dto.WSPayload
+	partition PartitionKeyFunc
+	wg        sync.WaitGroup
+}
+
+func newDispatcher(workers int, partition PartitionKeyFunc, handle func(event *dto.WSPayload)) *dispatcher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if partition == nil {
+		partition = PartitionByChannel
+	}
+	d := &dispatcher{
+		queues:    make([]chan *dto.WSPayload, workers),
+		partition: partition,
+	}
+	for i := range d.queues {
+		queue := make(chan *dto.WSPayload, DefaultWorkerQueueSize)
+		d.queues[i] = queue
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for event := range queue {
+				handle(event)
+			}
+		}()
+	}
+	return d
+}
+
+// dispatch 投递事件，对应协程的缓冲满时阻塞
+func (d *dispatcher) dispatch(event *dto.WSPayload) {
+	d.queues[d.index(event)] <- event
+}
+
+func (d *dispatcher) index(event *dto.WSPayload) int {
+	if len(d.queues) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(d.partition(event)))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// close 不再接收事件，等待已经投递的事件处理完成
+func (d *dispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
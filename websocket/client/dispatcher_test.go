@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/log"
+)
+
+func channelEvent(t *testing.T, channelID string, seq uint32) *dto.WSPayload {
+	raw := fmt.Sprintf(`{"op":0,"s":%d,"t":"AT_MESSAGE_CREATE","d":{"channel_id":"%s","guild_id":"g"}}`, seq, channelID)
+	event := &dto.WSPayload{}
+	if err := json.Unmarshal([]byte(raw), event); err != nil {
+		t.Fatal(err)
+	}
+	event.RawMessage = []byte(raw)
+	return event
+}
+
+func TestDispatcherOrdering(t *testing.T) {
+	var lock sync.Mutex
+	handled := map[string][]uint32{}
+	slow := make(chan struct{})
+	d := newDispatcher(4, PartitionByChannel, func(event *dto.WSPayload) {
+		channelID := PartitionByChannel(event)
+		// 慢的子频道不能阻塞其他子频道
+		if channelID == "slow" && event.Seq == 1 {
+			<-slow
+		}
+		lock.Lock()
+		handled[channelID] = append(handled[channelID], event.Seq)
+		lock.Unlock()
+	})
+	// 找一个与 slow 不在同一个协程的子频道
+	fast := ""
+	for i := 0; fast == ""; i++ {
+		id := fmt.Sprintf("fast-%d", i)
+		if d.index(channelEvent(t, id, 0)) != d.index(channelEvent(t, "slow", 0)) {
+			fast = id
+		}
+	}
+	for seq := uint32(1); seq <= 5; seq++ {
+		d.dispatch(channelEvent(t, "slow", seq))
+		d.dispatch(channelEvent(t, fast, seq))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lock.Lock()
+		n := len(handled[fast])
+		lock.Unlock()
+		if n == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fast channel is blocked by slow channel")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(slow)
+	d.close()
+	for _, channelID := range []string{"slow", fast} {
+		if got := fmt.Sprint(handled[channelID]); got != "[1 2 3 4 5]" {
+			t.Errorf("%s handled %v, want [1 2 3 4 5]", channelID, got)
+		}
+	}
+}
+
+func TestHandleEventRecoversPanic(t *testing.T) {
+	var notified []error
+	var contents []string
+	handlers := dto.NewEventParse().
+		AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+			if event.Seq == 1 {
+				panic("boom")
+			}
+			contents = append(contents, data.ChannelID)
+			return nil
+		}).
+		ErrorNotify(func(err error) {
+			notified = append(notified, err)
+		})
+	c := &Client{session: &dto.Session{Handlers: handlers}, logger: log.DefaultLogger}
+	c.handleEvent(channelEvent(t, "a", 1))
+	c.handleEvent(channelEvent(t, "b", 2))
+	if len(notified) != 1 || errs.Error(notified[0]).Code() != errs.CodeHandlerPanic {
+		t.Errorf("notified %v, want one handler panic error", notified)
+	}
+	if len(contents) != 1 || contents[0] != "b" {
+		t.Errorf("handled %v, want [b]", contents)
+	}
+}
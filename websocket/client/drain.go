@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+var (
+	_ websocket.Drainer      = (*Client)(nil)
+	_ websocket.Checkpointer = (*Client)(nil)
+)
+
+// seqTracker 记录已经分发还没有处理完成的事件 seq，用于计算可以安全 resume 的 seq，锁同时保护 session 中的 ID 与 LastSeq
+type seqTracker struct {
+	lock    sync.Mutex
+	pending map[uint32]struct{}
+	frozen  bool // 冻结后不再更新 session 中的 LastSeq
+}
+
+func (t *seqTracker) begin(seq uint32) {
+	if seq == 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.pending == nil {
+		t.pending = map[uint32]struct{}{}
+	}
+	t.pending[seq] = struct{}{}
+}
+
+func (t *seqTracker) end(seq uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.pending, seq)
+}
+
+// safeSeq 返回最早的未完成事件之前的 seq，没有未完成的事件时返回 lastSeq，调用方需要持有锁
+func (t *seqTracker) safeSeq(lastSeq uint32) uint32 {
+	for seq := range t.pending {
+		if seq-1 < lastSeq {
+			lastSeq = seq - 1
+		}
+	}
+	return lastSeq
+}
+
+// Drain 停止读取新的事件，等待队列中与处理中的事件完成，ctx 结束时返回 ctx.Err()
+// 超时返回时 LastSeq 会回退到最早的未完成事件之前，resume 之后这些事件会重新下发，已经完成的事件可能会重复
+// 还没有开始 Listening 的连接没有需要等待的事件，断开后直接返回
+func (c *Client) Drain(ctx context.Context) error {
+	atomic.StoreInt32(&c.draining, 1)
+	// 直接断开 tcp 连接，不发送关闭帧，避免网关将 session 失效
+	if err := c.conn.Close(); err != nil {
+		c.logger.Errorf("%s, close conn err: %v", c.snapshot(), err)
+	}
+	// 先断开再判断，之后开始的 Listening 读取不到事件
+	if atomic.LoadInt32(&c.listening) == 0 {
+		return nil
+	}
+	select {
+	case <-c.handled:
+		return nil
+	case <-ctx.Done():
+		c.freezeSeq()
+		return ctx.Err()
+	}
+}
+
+// Checkpoint 返回当前 session 的副本，LastSeq 为最早的未完成事件之前的 seq，用于定期保存 session
+func (c *Client) Checkpoint() dto.Session {
+	c.seqs.lock.Lock()
+	defer c.seqs.lock.Unlock()
+	session := *c.session
+	session.LastSeq = c.seqs.safeSeq(session.LastSeq)
+	return session
+}
+
+// freezeSeq 将 LastSeq 回退到最早的未完成事件之前，并停止更新
+func (c *Client) freezeSeq() {
+	c.seqs.lock.Lock()
+	defer c.seqs.lock.Unlock()
+	c.seqs.frozen = true
+	c.session.LastSeq = c.seqs.safeSeq(c.session.LastSeq)
+}
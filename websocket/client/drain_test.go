@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+func TestCheckpoint(t *testing.T) {
+	c := New().New(dto.Session{ID: "session", Handlers: dto.NewEventParse()}).(*Client)
+	steps := []struct {
+		name    string
+		do      func()
+		wantSeq uint32
+	}{
+		{"dispatch 3", func() { c.saveSeq(3); c.seqs.begin(3) }, 2},
+		{"dispatch 4", func() { c.saveSeq(4); c.seqs.begin(4) }, 2},
+		{"finish 4", func() { c.seqs.end(4) }, 2},
+		{"finish 3", func() { c.seqs.end(3) }, 4},
+		{"dispatch 5", func() { c.saveSeq(5); c.seqs.begin(5) }, 4},
+		{"freeze", func() { c.freezeSeq(); c.saveSeq(6) }, 4},
+	}
+	for _, step := range steps {
+		step.do()
+		if got := c.Checkpoint(); got.ID != "session" || got.LastSeq != step.wantSeq {
+			t.Errorf("%s: Checkpoint() = %s seq %d, want seq %d", step.name, got.ID, got.LastSeq, step.wantSeq)
+		}
+	}
+}
+
+func TestDrainBeforeListening(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	c := New().New(dto.Session{
+		URL:      s.URL,
+		Token:    *token.BotToken(1, "token"),
+		Handlers: dto.NewEventParse(),
+		Shards:   dto.ShardConfig{ShardCount: 1},
+	}).(*Client)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Identify(); err != nil {
+		t.Fatal(err)
+	}
+	// 还没有开始 Listening，不需要等待到 ctx 结束
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Drain(ctx); err != nil {
+		t.Fatalf("Drain() = %v, want nil", err)
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- c.Listening()
+	}()
+	select {
+	case <-listenErr:
+	case <-ctx.Done():
+		t.Fatal("Listening() should return after the connection is drained")
+	}
+}
@@ -41,16 +41,15 @@ var eventParseFuncMap = map[dto.OPCode]map[dto.EventType]eventParseFunc{
 
 type eventParseFunc func(event *dto.WSPayload, message []byte) error
 
-func parseAndHandle(event *dto.WSPayload) error {
+// parseAndHandle 使用全局注册的 handler 处理事件，未注册具体类型 handler 的事件投递到连接的透传 handler
+// handlers 与全局隔离时不使用全局注册的 handler
+func parseAndHandle(handlers *dto.EventParse, event *dto.WSPayload) error {
 	// 指定类型的 handler
-	if h, ok := eventParseFuncMap[event.OPCode][event.Type]; ok {
+	if h, ok := eventParseFuncMap[event.OPCode][event.Type]; ok && !handlers.Isolated() {
 		return h(event, event.RawMessage)
 	}
 	// 透传handler，如果未注册具体类型的 handler，会统一投递到这个 handler
-	if dto.DefaultHandlers.Plain != nil {
-		return dto.DefaultHandlers.Plain(event, event.RawMessage)
-	}
-	return nil
+	return handlers.HandlePlain(event, event.RawMessage)
 }
 
 func guildHandler(event *dto.WSPayload, message []byte) error {
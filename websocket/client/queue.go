@@ -0,0 +1,172 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+)
+
+// OverflowPolicy 事件队列满时的处理策略
+type OverflowPolicy int
+
+// 事件队列满时的处理策略
+const (
+	// OverflowBlock 阻塞读取，直到队列有空位，会导致连接上的消息无法读取，默认策略
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest 丢弃队列中最早的事件，放入新事件
+	OverflowDropOldest
+	// OverflowDropNewest 丢弃新事件
+	OverflowDropNewest
+	// OverflowSpill 将新事件交给 OverflowSink，比如写入外部的消息队列，由业务自行处理
+	OverflowSpill
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop oldest"
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(p))
+	}
+}
+
+// overflowNotifyInterval 每个连接通知队列已满的最小间隔
+const overflowNotifyInterval = time.Second
+
+// OverflowSink 接收队列满时溢出的事件，返回错误时事件被丢弃
+type OverflowSink func(event *dto.WSPayload) error
+
+// QueueStats 事件队列的统计
+type QueueStats struct {
+	Enqueued   uint64        // 放入队列的事件数量
+	Overflowed uint64        // 遇到队列已满的次数
+	Dropped    uint64        // 被丢弃的事件数量，包括溢出失败的事件
+	Spilled    uint64        // 成功交给 OverflowSink 的事件数量
+	Blocked    time.Duration // 因为队列已满阻塞读取的累计时长
+	Length     int           // 当前队列长度
+	Capacity   int           // 队列容量
+}
+
+// overflowState 队列已满的通知状态，只在读消息的协程中访问
+type overflowState struct {
+	full       bool      // 上一个事件遇到队列已满
+	notifiedAt time.Time // 最近一次通知的时间
+	suppressed uint64    // 限频省略的通知次数
+}
+
+// queueCounters 队列计数，同一个原型创建的连接共享
+type queueCounters struct {
+	enqueued    uint64
+	overflowed  uint64
+	dropped     uint64
+	spilled     uint64
+	blockedNano int64
+}
+
+// QueueStats 返回事件队列的统计，计数为同一个原型创建的所有连接的累计值，长度与容量为当前连接的值
+func (c *Client) QueueStats() QueueStats {
+	stats := QueueStats{
+		Length:   len(c.messageQueue),
+		Capacity: cap(c.messageQueue),
+	}
+	if c.counters != nil {
+		stats.Enqueued = atomic.LoadUint64(&c.counters.enqueued)
+		stats.Overflowed = atomic.LoadUint64(&c.counters.overflowed)
+		stats.Dropped = atomic.LoadUint64(&c.counters.dropped)
+		stats.Spilled = atomic.LoadUint64(&c.counters.spilled)
+		stats.Blocked = time.Duration(atomic.LoadInt64(&c.counters.blockedNano))
+	}
+	return stats
+}
+
+// enqueue 按照溢出策略将事件放入队列，只在读消息的协程中调用
+// 阻塞策略只在队列变满时通知，其他策略每个溢出的事件都会尝试通知，受到 notifyOverflow 的限频
+func (c *Client) enqueue(event *dto.WSPayload) {
+	select {
+	case c.messageQueue <- event:
+		atomic.AddUint64(&c.counters.enqueued, 1)
+		c.overflowed.full = false
+		return
+	default:
+	}
+	atomic.AddUint64(&c.counters.overflowed, 1)
+	wasFull := c.overflowed.full
+	c.overflowed.full = true
+	switch c.overflow {
+	case OverflowDropOldest:
+		// 只有读消息的协程会放入事件，丢弃最早的事件腾出空位后一定可以放入
+		for {
+			select {
+			case oldest := <-c.messageQueue:
+				c.dropped(oldest, nil)
+			default:
+			}
+			select {
+			case c.messageQueue <- event:
+				atomic.AddUint64(&c.counters.enqueued, 1)
+				return
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		c.dropped(event, nil)
+	case OverflowSpill:
+		if c.sink == nil {
+			c.dropped(event, nil)
+			return
+		}
+		if err := c.sink(event); err != nil {
+			c.dropped(event, err)
+			return
+		}
+		atomic.AddUint64(&c.counters.spilled, 1)
+		c.notifyOverflow(event, nil)
+	default:
+		// 阻塞放入之后队列仍然是满的，只在队列变满时通知
+		if !wasFull {
+			c.notifyOverflow(event, nil)
+		}
+		c.blockingEnqueue(event)
+	}
+}
+
+func (c *Client) blockingEnqueue(event *dto.WSPayload) {
+	start := time.Now()
+	c.messageQueue <- event
+	atomic.AddInt64(&c.counters.blockedNano, int64(time.Since(start)))
+	atomic.AddUint64(&c.counters.enqueued, 1)
+}
+
+func (c *Client) dropped(event *dto.WSPayload, err error) {
+	atomic.AddUint64(&c.counters.dropped, 1)
+	c.notifyOverflow(event, err)
+}
+
+// notifyOverflow 通过 ErrorNotify 通知使用方队列已满，每个 overflowNotifyInterval 最多通知一次
+// 间隔内省略的次数在下一次通知中带上
+func (c *Client) notifyOverflow(event *dto.WSPayload, err error) {
+	now := time.Now()
+	if now.Sub(c.overflowed.notifiedAt) < overflowNotifyInterval {
+		c.overflowed.suppressed++
+		return
+	}
+	text := fmt.Sprintf("event queue is full, policy %s, event %s seq %d", c.overflow, event.Type, event.Seq)
+	if err != nil {
+		text = fmt.Sprintf("%s, spill failed: %v", text, err)
+	}
+	if c.overflowed.suppressed > 0 {
+		text = fmt.Sprintf("%s, %d overflows not notified", text, c.overflowed.suppressed)
+	}
+	c.overflowed.notifiedAt, c.overflowed.suppressed = now, 0
+	c.logger.Errorf("%s %s", c.snapshot(), text)
+	c.session.Handlers.NotifyError(errs.New(errs.CodeEventQueueFull, text))
+}
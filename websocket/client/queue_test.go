@@ -0,0 +1,88 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	var spilled []uint32
+	sink := func(event *dto.WSPayload) error {
+		if event.Seq == 4 {
+			return errors.New("sink unavailable")
+		}
+		spilled = append(spilled, event.Seq)
+		return nil
+	}
+	tests := []struct {
+		policy    OverflowPolicy
+		sink      OverflowSink
+		wantQueue string
+		wantStats QueueStats
+	}{
+		{OverflowDropOldest, nil, "[3 4]", QueueStats{Enqueued: 4, Overflowed: 2, Dropped: 2, Length: 2, Capacity: 2}},
+		{OverflowDropNewest, nil, "[1 2]", QueueStats{Enqueued: 2, Overflowed: 2, Dropped: 2, Length: 2, Capacity: 2}},
+		{OverflowSpill, sink, "[1 2]", QueueStats{Enqueued: 2, Overflowed: 2, Dropped: 1, Spilled: 1, Length: 2, Capacity: 2}},
+		{OverflowSpill, nil, "[1 2]", QueueStats{Enqueued: 2, Overflowed: 2, Dropped: 2, Length: 2, Capacity: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			var notified []error
+			handlers := dto.NewEventParse().ErrorNotify(func(err error) {
+				notified = append(notified, err)
+			})
+			c := New(WithQueueSize(2), WithOverflowPolicy(tt.policy, tt.sink)).
+				New(dto.Session{Handlers: handlers}).(*Client)
+			for seq := uint32(1); seq <= 4; seq++ {
+				c.enqueue(&dto.WSPayload{WSPayloadBase: dto.WSPayloadBase{Seq: seq}})
+			}
+			if stats := c.QueueStats(); stats != tt.wantStats {
+				t.Errorf("QueueStats() = %+v, want %+v", stats, tt.wantStats)
+			}
+			// 连续溢出的事件限频只通知一次
+			if len(notified) != 1 || errs.Error(notified[0]).Code() != errs.CodeEventQueueFull {
+				t.Errorf("notified %v, want 1 queue full error", notified)
+			}
+			close(c.messageQueue)
+			var queued []uint32
+			for event := range c.messageQueue {
+				queued = append(queued, event.Seq)
+			}
+			if got := fmt.Sprint(queued); got != tt.wantQueue {
+				t.Errorf("queue = %v, want %v", got, tt.wantQueue)
+			}
+		})
+	}
+	if fmt.Sprint(spilled) != "[3]" {
+		t.Errorf("spilled %v, want [3]", spilled)
+	}
+}
+
+func TestOverflowBlockNotifiesOnce(t *testing.T) {
+	var notified []error
+	handlers := dto.NewEventParse().ErrorNotify(func(err error) {
+		notified = append(notified, err)
+	})
+	c := New(WithQueueSize(1)).New(dto.Session{Handlers: handlers}).(*Client)
+	go func() {
+		// 每次放入之前队列都是满的
+		for i := 0; i < 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			<-c.messageQueue
+		}
+	}()
+	for seq := uint32(1); seq <= 4; seq++ {
+		c.enqueue(&dto.WSPayload{WSPayloadBase: dto.WSPayloadBase{Seq: seq}})
+	}
+	if stats := c.QueueStats(); stats.Overflowed != 3 || stats.Dropped != 0 {
+		t.Errorf("QueueStats() = %+v, want 3 overflows without drops", stats)
+	}
+	if len(notified) != 1 || c.overflowed.suppressed != 0 {
+		t.Errorf("notified %v, suppressed %d, want only 1 notification", notified, c.overflowed.suppressed)
+	}
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/websocket"
+)
+
+var _ websocket.StatsReporter = (*Client)(nil)
+
+// activity 连接上收到消息的记录，读消息的协程写入，其他协程读取
+type activity struct {
+	events       uint64
+	lastReceived int64 // unix 纳秒
+	lastEvent    int64 // unix 纳秒
+}
+
+// received 记录收到的消息
+func (a *activity) received(event *dto.WSPayload) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&a.lastReceived, now)
+	if event.OPCode == dto.WSDispatchEvent {
+		atomic.StoreInt64(&a.lastEvent, now)
+		atomic.AddUint64(&a.events, 1)
+	}
+}
+
+// Stats 返回连接当前的运行状态
+func (c *Client) Stats() websocket.ConnStats {
+	stats := websocket.ConnStats{Latency: c.Latency()}
+	if c.activity == nil {
+		return stats
+	}
+	stats.Events = atomic.LoadUint64(&c.activity.events)
+	if t := atomic.LoadInt64(&c.activity.lastReceived); t > 0 {
+		stats.LastReceivedAt = time.Unix(0, t)
+	}
+	if t := atomic.LoadInt64(&c.activity.lastEvent); t > 0 {
+		stats.LastEventAt = time.Unix(0, t)
+	}
+	return stats
+}
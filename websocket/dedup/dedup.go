@@ -0,0 +1,70 @@
+// Package dedup 事件去重，用于过滤 resume，重新分片与 shard 交接时重复下发的事件。
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// DefaultTTL 默认的去重窗口
+const DefaultTTL = 10 * time.Minute
+
+// Store 记录已经处理过的事件
+type Store interface {
+	// Mark 标记 key 已经处理，key 在 ttl 内已经被标记过时返回 true
+	Mark(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// Key 返回事件的去重 key，由事件类型与事件的自然 ID 组成，如消息 ID 与审核 ID
+// 没有自然 ID 的事件返回空字符串，不参与去重
+func Key(event *dto.WSPayload) string {
+	id := dto.EventID(event)
+	if id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", event.Type, id)
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore 基于内存的去重记录，只在进程内生效
+type MemoryStore struct {
+	lock      sync.Mutex
+	marks     map[string]time.Time // key 与过期时间
+	lastSweep time.Time
+}
+
+// NewMemoryStore 创建基于内存的去重记录
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{marks: map[string]time.Time{}}
+}
+
+// Mark 标记 key 已经处理，key 在 ttl 内已经被标记过时返回 true
+func (s *MemoryStore) Mark(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sweep(now, ttl)
+	if expireAt, ok := s.marks[key]; ok && now.Before(expireAt) {
+		return true, nil
+	}
+	s.marks[key] = now.Add(ttl)
+	return false, nil
+}
+
+// sweep 每隔一个 ttl 清理过期的记录
+func (s *MemoryStore) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(s.lastSweep) < ttl {
+		return
+	}
+	s.lastSweep = now
+	for key, expireAt := range s.marks {
+		if !now.Before(expireAt) {
+			delete(s.marks, key)
+		}
+	}
+}
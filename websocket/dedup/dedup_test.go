@@ -0,0 +1,50 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tencent-connect/botgo/dto"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *dto.WSPayload
+		want  string
+	}{
+		{"message", &dto.WSPayload{WSPayloadBase: dto.WSPayloadBase{Type: dto.EventAtMessageCreate},
+			RawMessage: []byte(`{"op":0,"t":"AT_MESSAGE_CREATE","d":{"id":"m1"}}`)}, "AT_MESSAGE_CREATE:m1"},
+		{"audit", &dto.WSPayload{WSPayloadBase: dto.WSPayloadBase{Type: dto.EventMessageAuditReject},
+			RawMessage: []byte(`{"op":0,"t":"MESSAGE_AUDIT_REJECT","d":{"audit_id":"a1"}}`)}, "MESSAGE_AUDIT_REJECT:a1"},
+		{"without natural id", &dto.WSPayload{WSPayloadBase: dto.WSPayloadBase{Type: dto.EventGuildUpdate},
+			RawMessage: []byte(`{"op":0,"t":"GUILD_UPDATE","d":{"id":"g1"}}`)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(tt.event); got != tt.want {
+				t.Errorf("Key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	ttl := 50 * time.Millisecond
+	if seen, _ := s.Mark(ctx, "a", ttl); seen {
+		t.Error("first mark should not be seen")
+	}
+	if seen, _ := s.Mark(ctx, "a", ttl); !seen {
+		t.Error("second mark in ttl should be seen")
+	}
+	if seen, _ := s.Mark(ctx, "b", ttl); seen {
+		t.Error("other key should not be seen")
+	}
+	time.Sleep(2 * ttl)
+	if seen, _ := s.Mark(ctx, "a", ttl); seen {
+		t.Error("mark after ttl should not be seen")
+	}
+}
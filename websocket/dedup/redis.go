@@ -0,0 +1,37 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 去重 key 的默认前缀
+const defaultRedisPrefix = "botgo_dedup"
+
+var _ Store = (*RedisStore)(nil)
+
+// RedisStore 基于 redis 的去重记录，多个实例使用同一个 redis 时可以过滤 shard 交接期间的重复事件
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore 创建基于 redis 的去重记录，prefix 为空时使用默认前缀，同一个 redis 上的多个机器人需要使用不同的前缀
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Mark 使用 SET NX 标记 key，key 已经存在时返回 true
+func (s *RedisStore) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := s.client.SetNX(ctx, fmt.Sprintf("%s_%s", s.prefix, key), 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
@@ -4,7 +4,8 @@ import (
 	"github.com/tencent-connect/botgo/dto"
 )
 
-// RegisterHandlers 注册事件回调，并返回 intent 用于 websocket 的鉴权
+// RegisterHandlers 注册全局的事件回调，并返回 intent 用于 websocket 的鉴权
+// 全局的回调对进程内所有的连接生效，需要按连接隔离时请使用 dto.EventParse，EventParse 中未注册的事件会回退到这里注册的回调
 func RegisterHandlers(handlers ...interface{}) dto.Intent {
 	var i dto.Intent
 	for _, h := range handlers {
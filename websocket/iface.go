@@ -1,6 +1,9 @@
 package websocket
 
 import (
+	"context"
+	"time"
+
 	"github.com/tencent-connect/botgo/dto"
 )
 
@@ -23,3 +26,30 @@ type WebSocket interface {
 	// Close 关闭连接
 	Close()
 }
+
+// Drainer 支持优雅关闭的 websocket 实现，websocket 实现可以按需选择是否实现该接口
+type Drainer interface {
+	// Drain 停止读取新的事件，等待已经读取的事件处理完成，ctx 结束时返回 ctx.Err()
+	// 返回后 Session 中的 LastSeq 为可以安全 resume 的 seq，没有处理完成的事件会在 resume 之后重新下发
+	Drain(ctx context.Context) error
+}
+
+// Checkpointer 可以获取安全 resume 位置的 websocket 实现，websocket 实现可以按需选择是否实现该接口
+type Checkpointer interface {
+	// Checkpoint 返回当前 session 的副本，LastSeq 之前的事件都已经处理完成
+	Checkpoint() dto.Session
+}
+
+// ConnStats 连接的运行状态
+type ConnStats struct {
+	Latency        time.Duration // 最近一次心跳的往返耗时
+	LastReceivedAt time.Time     // 最近一次收到网关消息的时间，包括心跳 ack
+	LastEventAt    time.Time     // 最近一次收到事件的时间
+	Events         uint64        // 连接上收到的事件数量
+}
+
+// StatsReporter 可以报告连接运行状态的 websocket 实现，websocket 实现可以按需选择是否实现该接口
+type StatsReporter interface {
+	// Stats 返回连接当前的运行状态
+	Stats() ConnStats
+}
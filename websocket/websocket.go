@@ -31,7 +31,12 @@ var PanicBufLen = 1024
 
 // PanicHandler 处理websocket场景的 panic ，打印堆栈
 func PanicHandler(e interface{}, session *dto.Session) {
+	LogPanic(log.DefaultLogger, e, session)
+}
+
+// LogPanic 使用指定的 logger 打印 panic 堆栈
+func LogPanic(logger log.Logger, e interface{}, session *dto.Session) {
 	buf := make([]byte, PanicBufLen)
 	buf = buf[:runtime.Stack(buf, false)]
-	log.Errorf("[PANIC]%s\n%v\n%s\n", session, e, buf)
+	logger.Errorf("[PANIC]%s\n%v\n%s\n", session, e, buf)
 }
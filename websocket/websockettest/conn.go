@@ -0,0 +1,186 @@
+package websockettest
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	wss "github.com/gorilla/websocket"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// ErrNoSession 连接没有完成握手，无法下发事件
+var ErrNoSession = errors.New("websockettest: connection has no session")
+
+// closeWriteTimeout 写入关闭帧的超时时间
+const closeWriteTimeout = time.Second
+
+// Conn 模拟网关上的一个连接，可以用于注入事件，下发控制指令以及关闭连接
+type Conn struct {
+	server   *Server
+	ws       *wss.Conn
+	session  *session
+	identify *dto.WSIdentityData
+	resume   *dto.WSResumeData
+	err      error
+
+	writeLock  sync.Mutex
+	lock       sync.Mutex
+	heartbeats []uint32 // 收到的心跳中携带的 seq
+	dropAcks   bool     // 不回复心跳 ack，用于模拟半开的连接
+	done       chan struct{}
+}
+
+// Err 返回握手过程中的错误，为空时说明握手成功
+func (c *Conn) Err() error {
+	return c.err
+}
+
+// SessionID 返回连接对应的 session id
+func (c *Conn) SessionID() string {
+	if c.session == nil {
+		return ""
+	}
+	return c.session.id
+}
+
+// Identify 返回客户端发送的鉴权数据，如果客户端发送的是 Resume 则返回 nil
+func (c *Conn) Identify() *dto.WSIdentityData {
+	return c.identify
+}
+
+// Resume 返回客户端发送的 Resume 数据，如果客户端发送的是 Identify 则返回 nil
+func (c *Conn) Resume() *dto.WSResumeData {
+	return c.resume
+}
+
+// Heartbeats 返回收到的心跳中携带的 seq 列表
+func (c *Conn) Heartbeats() []uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]uint32(nil), c.heartbeats...)
+}
+
+// DropHeartbeatAcks 设置是否丢弃心跳 ack，丢弃时仍然会记录收到的心跳，用于模拟半开的连接
+func (c *Conn) DropHeartbeatAcks(drop bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dropAcks = drop
+}
+
+// Done 连接关闭后 chan 会被关闭
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Dispatch 下发事件，seq 在 session 内递增，事件会被记录下来用于 resume 时的补发
+// 连接已经断开时事件仍然会被记录，返回写入连接的错误
+func (c *Conn) Dispatch(eventType dto.EventType, data interface{}) (uint32, error) {
+	if c.session == nil {
+		return 0, ErrNoSession
+	}
+	sess := c.session
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+	sess.seq++
+	raw, err := json.Marshal(&dto.WSPayload{
+		WSPayloadBase: dto.WSPayloadBase{OPCode: dto.WSDispatchEvent, Seq: sess.seq, Type: eventType},
+		Data:          data,
+	})
+	if err != nil {
+		sess.seq--
+		return 0, err
+	}
+	sess.history = append(sess.history, raw)
+	// 客户端已经 resume 到其他连接上的时候，投递到最新的连接
+	return sess.seq, sess.conn.writeRaw(raw)
+}
+
+// Reconnect 下发 Reconnect，通知客户端重新连接并 resume
+func (c *Conn) Reconnect() error {
+	payload := &dto.WSPayload{}
+	payload.OPCode = dto.WSReconnect
+	return c.writePayload(payload)
+}
+
+// InvalidSession 下发 InvalidSession，并使 session 失效，客户端需要重新 Identify
+func (c *Conn) InvalidSession() error {
+	if c.session != nil {
+		c.server.InvalidateSession(c.session.id)
+	}
+	payload := &dto.WSPayload{Data: false}
+	payload.OPCode = dto.WSInvalidSession
+	return c.writePayload(payload)
+}
+
+// CloseWithCode 使用指定的错误码关闭连接，如 CloseSessionTimeout，CloseBanned
+func (c *Conn) CloseWithCode(code int, text string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	msg := wss.FormatCloseMessage(code, text)
+	err := c.ws.WriteControl(wss.CloseMessage, msg, time.Now().Add(closeWriteTimeout))
+	_ = c.ws.Close()
+	return err
+}
+
+// rejectWith 关闭连接并返回握手失败的错误
+func (c *Conn) rejectWith(code int, text string) error {
+	_ = c.CloseWithCode(code, text)
+	return ErrHandshakeRejected
+}
+
+func (c *Conn) writePayload(payload *dto.WSPayload) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.writeRaw(raw)
+}
+
+func (c *Conn) writeRaw(raw []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.ws.WriteMessage(wss.TextMessage, raw)
+}
+
+func (c *Conn) read() (*dto.WSPayload, []byte, error) {
+	_, raw, err := c.ws.ReadMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := &dto.WSPayload{}
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return nil, nil, err
+	}
+	return payload, raw, nil
+}
+
+// readLoop 处理握手之后客户端发送的消息，目前只处理心跳
+func (c *Conn) readLoop() {
+	defer close(c.done)
+	defer c.ws.Close()
+	for {
+		payload, raw, err := c.read()
+		if err != nil {
+			return
+		}
+		if payload.OPCode != dto.WSHeartbeat {
+			continue
+		}
+		var seq uint32
+		_ = parseData(raw, &seq)
+		c.lock.Lock()
+		c.heartbeats = append(c.heartbeats, seq)
+		dropAck := c.dropAcks
+		c.lock.Unlock()
+		if dropAck {
+			continue
+		}
+		ack := &dto.WSPayload{}
+		ack.OPCode = dto.WSHeartbeatAck
+		if err := c.writePayload(ack); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package websockettest 提供一个进程内的 websocket 模拟网关，用于测试连接，重连，resume 以及事件处理逻辑。
+//
+// 模拟网关实现了与真实网关一致的协议流程：建立连接后下发 Hello，校验 Identify 或者 Resume，
+// 鉴权成功后下发 Ready，之后可以通过 Conn 注入带有 seq 的事件，下发 Reconnect，InvalidSession，或者使用指定的错误码关闭连接。
+//
+//	server := websockettest.NewServer()
+//	defer server.Close()
+//	session := dto.Session{URL: server.URL, Token: *token.BotToken(1, "token"), ...}
+//	conn, err := server.NextConn(ctx) // 等待客户端完成鉴权
+//	conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "hello"})
+package websockettest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wss "github.com/gorilla/websocket"
+	"github.com/tencent-connect/botgo/dto"
+)
+
+// 网关使用的关闭连接错误码 https://bot.q.qq.com/wiki/develop/api/gateway/error/error.html
+const (
+	CloseAuthFailed     = 4004 // 鉴权失败
+	CloseInvalidSeq     = 4007 // resume 时 seq 错误
+	CloseSessionTimeout = 4009 // 连接过期，可以 resume
+	CloseInvalidShard   = 4010 // 无效的 shard
+	CloseBanned         = 4914 // 机器人已下架，只允许连接沙箱环境
+	CloseBotDeleted     = 4915 // 机器人已封禁，不允许连接
+)
+
+// EventResumed resume 成功，补发完缺失的事件之后下发的事件
+const EventResumed dto.EventType = "RESUMED"
+
+// DefaultHeartbeatInterval Hello 中下发的默认心跳间隔，单位毫秒
+const DefaultHeartbeatInterval = 45000
+
+// handshakeTimeout 下发 Hello 之后等待 Identify 或者 Resume 的超时时间
+const handshakeTimeout = 10 * time.Second
+
+// ErrHandshakeRejected 握手被拒绝，连接已经被关闭
+var ErrHandshakeRejected = errors.New("websockettest: handshake rejected")
+
+// Server websocket 模拟网关
+type Server struct {
+	*httptest.Server
+	// URL 网关地址，可以直接填入 dto.WebsocketAP 或者 dto.Session 中
+	URL string
+
+	heartbeatInterval int
+	token             string
+	upgrader          wss.Upgrader
+	sessionSeq        uint64
+
+	lock       sync.Mutex
+	sessions   map[string]*session
+	rejects    []closeFrame  // 按照顺序作用于后续的握手
+	pending    []*Conn       // 已经完成握手，还没有被 NextConn 取走的连接
+	arrived    chan struct{} // 有新的连接完成握手时关闭并替换
+	allConns   []*Conn
+	identifies int
+	resumes    int
+}
+
+// Option 模拟网关配置
+type Option func(s *Server)
+
+// WithHeartbeatInterval 设置 Hello 中下发的心跳间隔
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.heartbeatInterval = int(interval / time.Millisecond)
+	}
+}
+
+// WithToken 设置合法的 token，格式与 token.GetString() 一致，不设置时只校验 token 不为空
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// NewServer 创建并启动一个模拟网关，使用完毕后需要调用 Close
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		heartbeatInterval: DefaultHeartbeatInterval,
+		sessions:          map[string]*session{},
+		arrived:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveWS))
+	s.URL = "ws" + strings.TrimPrefix(s.Server.URL, "http")
+	return s
+}
+
+// Close 关闭所有连接以及模拟网关
+func (s *Server) Close() {
+	s.lock.Lock()
+	conns := s.allConns
+	s.lock.Unlock()
+	for _, c := range conns {
+		_ = c.ws.Close()
+	}
+	s.Server.Close()
+}
+
+// NextConn 按照建立连接的顺序，等待下一个完成握手的连接，握手被拒绝的连接也会返回，此时 Err 不为空
+func (s *Server) NextConn(ctx context.Context) (*Conn, error) {
+	for {
+		s.lock.Lock()
+		if len(s.pending) > 0 {
+			c := s.pending[0]
+			s.pending = s.pending[1:]
+			s.lock.Unlock()
+			return c, nil
+		}
+		arrived := s.arrived
+		s.lock.Unlock()
+		select {
+		case <-arrived:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// RejectNextHandshake 使用指定的错误码关闭下一个连接，不会对 Identify 或者 Resume 做任何响应
+// 多次调用时按照调用顺序作用于后续的连接
+func (s *Server) RejectNextHandshake(code int, text string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rejects = append(s.rejects, closeFrame{code: code, text: text})
+}
+
+// Identifies 返回收到的 Identify 次数
+func (s *Server) Identifies() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.identifies
+}
+
+// Resumes 返回收到的 Resume 次数
+func (s *Server) Resumes() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.resumes
+}
+
+// InvalidateSession 使 session 失效，后续使用该 session 的 Resume 将会收到 InvalidSession
+func (s *Server) InvalidateSession(sessionID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, sessionID)
+}
+
+type closeFrame struct {
+	code int
+	text string
+}
+
+// session 网关侧的会话，seq 与事件记录跨连接保持，用于 resume 时补发事件
+type session struct {
+	lock    sync.Mutex
+	id      string
+	seq     uint32
+	history [][]byte // 已经分配 seq 的事件，不包括 Ready
+	conn    *Conn
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &Conn{
+		server: s,
+		ws:     ws,
+		done:   make(chan struct{}),
+	}
+	s.lock.Lock()
+	s.allConns = append(s.allConns, c)
+	s.lock.Unlock()
+	hello := &dto.WSPayload{Data: &dto.WSHelloData{HeartbeatInterval: s.heartbeatInterval}}
+	hello.OPCode = dto.WSHello
+	if err := c.writePayload(hello); err != nil {
+		_ = ws.Close()
+		return
+	}
+	c.err = s.handshake(c)
+	// 测试不一定取走所有的连接，不能阻塞
+	s.lock.Lock()
+	s.pending = append(s.pending, c)
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+	s.lock.Unlock()
+	if c.err != nil {
+		_ = ws.Close()
+		close(c.done)
+		return
+	}
+	c.readLoop()
+}
+
+// handshake 读取并校验 Identify 或者 Resume，成功后下发 Ready 或者补发事件
+func (s *Server) handshake(c *Conn) error {
+	_ = c.ws.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	payload, raw, err := c.read()
+	if err != nil {
+		return err
+	}
+	_ = c.ws.SetReadDeadline(time.Time{})
+
+	s.lock.Lock()
+	var reject *closeFrame
+	if len(s.rejects) > 0 {
+		reject = &s.rejects[0]
+		s.rejects = s.rejects[1:]
+	}
+	switch payload.OPCode {
+	case dto.WSIdentity:
+		s.identifies++
+	case dto.WSResume:
+		s.resumes++
+	}
+	s.lock.Unlock()
+	if reject != nil {
+		return c.rejectWith(reject.code, reject.text)
+	}
+
+	switch payload.OPCode {
+	case dto.WSIdentity:
+		data := &dto.WSIdentityData{}
+		if err := parseData(raw, data); err != nil {
+			return c.rejectWith(CloseAuthFailed, "invalid identify data")
+		}
+		c.identify = data
+		return s.handleIdentify(c, data)
+	case dto.WSResume:
+		data := &dto.WSResumeData{}
+		if err := parseData(raw, data); err != nil {
+			return c.rejectWith(CloseAuthFailed, "invalid resume data")
+		}
+		c.resume = data
+		return s.handleResume(c, data)
+	default:
+		return c.rejectWith(CloseAuthFailed, "identify or resume is required, got "+dto.OPMeans(payload.OPCode))
+	}
+}
+
+func (s *Server) checkToken(token string) bool {
+	if s.token == "" {
+		return token != ""
+	}
+	return token == s.token
+}
+
+func (s *Server) handleIdentify(c *Conn, data *dto.WSIdentityData) error {
+	if !s.checkToken(data.Token) {
+		return c.rejectWith(CloseAuthFailed, "authentication failed")
+	}
+	if len(data.Shard) != 2 || data.Shard[1] == 0 || data.Shard[0] >= data.Shard[1] {
+		return c.rejectWith(CloseInvalidShard, "invalid shard")
+	}
+	sess := &session{
+		id: "session-" + strconv.FormatUint(atomic.AddUint64(&s.sessionSeq, 1), 10),
+	}
+	s.lock.Lock()
+	s.sessions[sess.id] = sess
+	s.lock.Unlock()
+
+	ready := &dto.WSReadyData{
+		Version:   1,
+		SessionID: sess.id,
+		Shard:     data.Shard,
+	}
+	ready.User.ID = "10000"
+	ready.User.Username = "fake-bot"
+	ready.User.Bot = true
+
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+	sess.seq++
+	payload := &dto.WSPayload{
+		WSPayloadBase: dto.WSPayloadBase{OPCode: dto.WSDispatchEvent, Seq: sess.seq, Type: dto.EventType("READY")},
+		Data:          ready,
+	}
+	c.session = sess
+	sess.conn = c
+	return c.writePayload(payload)
+}
+
+func (s *Server) handleResume(c *Conn, data *dto.WSResumeData) error {
+	if !s.checkToken(data.Token) {
+		return c.rejectWith(CloseAuthFailed, "authentication failed")
+	}
+	s.lock.Lock()
+	sess, ok := s.sessions[data.SessionID]
+	s.lock.Unlock()
+	if !ok {
+		// 无效的 session 下发 InvalidSession，由客户端重新 Identify
+		invalid := &dto.WSPayload{Data: false}
+		invalid.OPCode = dto.WSInvalidSession
+		if err := c.writePayload(invalid); err != nil {
+			return err
+		}
+		return ErrHandshakeRejected
+	}
+	sess.lock.Lock()
+	defer sess.lock.Unlock()
+	if data.Seq > sess.seq {
+		return c.rejectWith(CloseInvalidSeq, "invalid seq")
+	}
+	c.session = sess
+	sess.conn = c
+	// 补发客户端没有收到的事件
+	for _, raw := range sess.history {
+		seq := payloadSeq(raw)
+		if seq <= data.Seq {
+			continue
+		}
+		if err := c.writeRaw(raw); err != nil {
+			return err
+		}
+	}
+	resumed := &dto.WSPayload{
+		WSPayloadBase: dto.WSPayloadBase{OPCode: dto.WSDispatchEvent, Type: EventResumed},
+		Data:          "",
+	}
+	return c.writePayload(resumed)
+}
+
+func payloadSeq(raw []byte) uint32 {
+	base := &dto.WSPayloadBase{}
+	_ = json.Unmarshal(raw, base)
+	return base.Seq
+}
+
+func parseData(raw []byte, v interface{}) error {
+	payload := &struct {
+		Data json.RawMessage `json:"d"`
+	}{}
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return err
+	}
+	return json.Unmarshal(payload.Data, v)
+}
@@ -0,0 +1,253 @@
+package websockettest_test
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	wss "github.com/gorilla/websocket"
+	"github.com/tencent-connect/botgo/dto"
+	"github.com/tencent-connect/botgo/errs"
+	"github.com/tencent-connect/botgo/sessions/manager"
+	"github.com/tencent-connect/botgo/token"
+	"github.com/tencent-connect/botgo/websocket"
+	"github.com/tencent-connect/botgo/websocket/client"
+	"github.com/tencent-connect/botgo/websocket/websockettest"
+)
+
+const testTimeout = 10 * time.Second
+
+func init() {
+	client.Setup()
+}
+
+// connect 建立连接并完成鉴权，返回客户端，网关侧的连接以及 Listening 的返回值
+func connect(t *testing.T, s *websockettest.Server, session dto.Session) (
+	websocket.WebSocket, *websockettest.Conn, chan error,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	c := websocket.ClientImpl.New(session)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if session.ID != "" {
+		err = c.Resume()
+	} else {
+		err = c.Identify()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- c.Listening()
+	}()
+	conn, err := s.NextConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, conn, listenErr
+}
+
+func newSession(s *websockettest.Server, handlers *dto.EventParse) dto.Session {
+	return dto.Session{
+		URL:      s.URL,
+		Token:    *token.BotToken(1, "token"),
+		Handlers: handlers,
+		Shards:   dto.ShardConfig{ShardID: 0, ShardCount: 1},
+	}
+}
+
+func atMessages() (*dto.EventParse, chan string) {
+	contents := make(chan string, 10)
+	handlers := dto.NewEventParse().AtMessage(func(event *dto.WSPayload, data *dto.WSATMessageData) error {
+		contents <- data.Content
+		return nil
+	})
+	return handlers, contents
+}
+
+func receive(t *testing.T, contents chan string, want string) {
+	select {
+	case got := <-contents:
+		if got != want {
+			t.Errorf("content = %v, want %v", got, want)
+		}
+	case <-time.After(testTimeout):
+		t.Fatalf("timeout waiting for %v", want)
+	}
+}
+
+func waitErr(t *testing.T, listenErr chan error) error {
+	select {
+	case err := <-listenErr:
+		return err
+	case <-time.After(testTimeout):
+		t.Fatal("timeout waiting for Listening to return")
+		return nil
+	}
+}
+
+func TestReconnectAndResume(t *testing.T) {
+	s := websockettest.NewServer(websockettest.WithHeartbeatInterval(50 * time.Millisecond))
+	defer s.Close()
+	handlers, contents := atMessages()
+
+	c, conn, listenErr := connect(t, s, newSession(s, handlers))
+	if conn.Err() != nil || conn.Identify() == nil {
+		t.Fatalf("identify failed, err %v", conn.Err())
+	}
+	if conn.Identify().Intents != handlers.Intent() {
+		t.Errorf("Intents = %v, want %v", conn.Identify().Intents, handlers.Intent())
+	}
+	for _, content := range []string{"a", "b"} {
+		if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, contents, content)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for len(conn.Heartbeats()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hb := conn.Heartbeats(); len(hb) == 0 || hb[len(hb)-1] != 3 {
+		t.Errorf("heartbeats = %v, want last seq 3", hb)
+	}
+	if err := conn.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitErr(t, listenErr); err != errs.ErrNeedReConnect {
+		t.Fatalf("Listening() = %v, want %v", err, errs.ErrNeedReConnect)
+	}
+	<-conn.Done()
+	// 断线期间的事件需要在 resume 之后补发
+	if _, err := conn.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "missed"}); err == nil {
+		t.Error("Dispatch() on closed connection should fail")
+	}
+
+	session := *c.Session()
+	if session.ID != conn.SessionID() || session.LastSeq != 3 {
+		t.Fatalf("session = %s seq %d, want %s seq 3", session.ID, session.LastSeq, conn.SessionID())
+	}
+	_, resumed, listenErr := connect(t, s, session)
+	if resumed.Err() != nil || resumed.Resume() == nil {
+		t.Fatalf("resume failed, err %v", resumed.Err())
+	}
+	receive(t, contents, "missed")
+	if _, err := resumed.Dispatch(dto.EventAtMessageCreate, &dto.Message{Content: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, contents, "c")
+	_ = resumed.CloseWithCode(websockettest.CloseSessionTimeout, "session timeout")
+	waitErr(t, listenErr)
+	if s.Identifies() != 1 || s.Resumes() != 1 {
+		t.Errorf("identifies %d resumes %d, want 1 and 1", s.Identifies(), s.Resumes())
+	}
+}
+
+func TestCloseCodes(t *testing.T) {
+	tests := []struct {
+		name           string
+		code           int
+		cantResume     bool
+		cantIdentify   bool
+		invalidSession bool
+	}{
+		{"session timeout", websockettest.CloseSessionTimeout, false, false, false},
+		{"invalid seq", websockettest.CloseInvalidSeq, true, false, false},
+		{"banned", websockettest.CloseBanned, false, true, false},
+		{"deleted", websockettest.CloseBotDeleted, false, true, false},
+		{"invalid session", 0, true, false, true},
+	}
+	s := websockettest.NewServer()
+	defer s.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, conn, listenErr := connect(t, s, newSession(s, dto.NewEventParse()))
+			if tt.invalidSession {
+				_ = conn.InvalidSession()
+			} else {
+				_ = conn.CloseWithCode(tt.code, tt.name)
+			}
+			err := waitErr(t, listenErr)
+			if got := manager.CanNotResume(err); got != tt.cantResume {
+				t.Errorf("CanNotResume(%v) = %v, want %v", err, got, tt.cantResume)
+			}
+			if got := manager.CanNotIdentify(err); got != tt.cantIdentify {
+				t.Errorf("CanNotIdentify(%v) = %v, want %v", err, got, tt.cantIdentify)
+			}
+		})
+	}
+}
+
+func TestHandshakeValidation(t *testing.T) {
+	s := websockettest.NewServer(websockettest.WithToken(token.BotToken(1, "token").GetString()))
+	defer s.Close()
+
+	t.Run("auth failed", func(t *testing.T) {
+		session := newSession(s, dto.NewEventParse())
+		session.Token = *token.BotToken(1, "wrong")
+		_, conn, listenErr := connect(t, s, session)
+		if conn.Err() == nil {
+			t.Fatal("handshake with wrong token should be rejected")
+		}
+		if err := waitErr(t, listenErr); !manager.CanNotResume(err) {
+			t.Errorf("Listening() = %v, want can not resume error", err)
+		}
+	})
+	t.Run("unknown session", func(t *testing.T) {
+		session := newSession(s, dto.NewEventParse())
+		session.ID = "unknown"
+		_, conn, listenErr := connect(t, s, session)
+		if conn.Err() == nil {
+			t.Fatal("resume with unknown session should be rejected")
+		}
+		if err := waitErr(t, listenErr); err != errs.ErrInvalidSession {
+			t.Errorf("Listening() = %v, want %v", err, errs.ErrInvalidSession)
+		}
+	})
+	t.Run("nil handlers", func(t *testing.T) {
+		_, conn, _ := connect(t, s, newSession(s, nil))
+		if conn.Err() != nil || conn.Identify().Intents != dto.IntentGuilds {
+			t.Errorf("identify %+v, err %v, want default intent", conn.Identify(), conn.Err())
+		}
+	})
+}
+
+func TestUnconsumedConns(t *testing.T) {
+	s := websockettest.NewServer()
+	defer s.Close()
+	// 超过 100 个没有被 NextConn 取走的连接也不会阻塞握手协程
+	const n = 105
+	for i := 0; i < n; i++ {
+		ws, _, err := wss.DefaultDialer.Dial(s.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 客户端关闭连接，握手失败后握手协程退出
+		_ = ws.Close()
+	}
+	deadline := time.Now().Add(testTimeout)
+	for {
+		buf := make([]byte, 1<<20)
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		if !strings.Contains(stacks, "websockettest.(*Server).serveWS") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("handshake goroutines blocked on unconsumed conns")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		if _, err := s.NextConn(ctx); err != nil {
+			t.Fatalf("conn %d: %v", i, err)
+		}
+	}
+}